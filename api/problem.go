@@ -0,0 +1,123 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ProblemContentType is the content type of every error response
+const ProblemContentType = "application/problem+json"
+
+// StatusClientClosedRequest is sent, for the logs and metrics, when the client went away before the response was ready
+const StatusClientClosedRequest = 499
+
+// Codes sent in the problems, they won't change so clients can branch on them rather than on the messages
+const (
+	CodeInvalidRequest = "invalid_request"
+	CodeNotFound       = "not_found"
+	CodeInternal       = "internal_error"
+	CodeMissingToken   = "missing_token"
+	CodeTokenExpired   = "token_expired"
+	CodeTokenInvalid   = "token_invalid"
+	CodeAdminOnly      = "admin_only"
+	CodeGameServerOnly = "game_server_only"
+	CodeTimeout        = "timeout"
+	CodeCanceled       = "request_canceled"
+
+	CodeInvalidCredentials = "invalid_credentials"
+
+	CodeWrongAmount           = "wrong_amount"
+	CodeNotEnoughFunds        = "not_enough_funds"
+	CodeSameWallet            = "same_wallet"
+	CodeLimitExceeded         = "limit_exceeded"
+	CodeVelocityLimitExceeded = "velocity_limit_exceeded"
+
+	CodeNotAMinor             = "not_a_minor"
+	CodeGuardianNotAdult      = "guardian_not_adult"
+	CodeNotGuardian           = "not_guardian"
+	CodeCategoryBlocked       = "category_blocked"
+	CodeSpendLimitReached     = "spend_limit_reached"
+	CodeTransactionNotPending = "transaction_not_pending"
+	CodeMinorAlreadyLinked    = "minor_already_linked"
+
+	CodeSelfExcluded         = "self_excluded"
+	CodeCoolingOff           = "cooling_off"
+	CodeDepositLimitReached  = "deposit_limit_reached"
+	CodeLossLimitReached     = "loss_limit_reached"
+	CodeExclusionActive      = "exclusion_active"
+	CodeInvalidCoolingOff    = "invalid_cooling_off"
+	CodeInvalidSelfExclusion = "invalid_self_exclusion"
+
+	CodeBalanceCapReached     = "balance_cap_reached"
+	CodeTransferNotAllowed    = "transfer_not_allowed"
+	CodeTransferNeedsApproval = "transfer_needs_approval"
+
+	CodeWalletFrozen        = "wallet_frozen"
+	CodeWalletClosed        = "wallet_closed"
+	CodeWalletNotEmpty      = "wallet_not_empty"
+	CodeInvalidStatusChange = "invalid_status_change"
+
+	CodeTooManySubscriptions     = "too_many_subscriptions"
+	CodeInvalidWebhookURL        = "invalid_webhook_url"
+	CodeIdempotencyKeyInProgress = "idempotency_key_in_progress"
+	CodeIdempotencyKeyReused     = "idempotency_key_reused"
+)
+
+// Problem is the RFC 7807 body of error responses. Type is a urn built from Code, Title says what failed and Detail why.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+}
+
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Title
+	}
+
+	return p.Title + ": " + p.Detail
+}
+
+// GenerateProblem builds the problem for the error, errors without a code get a generic one from the status
+func GenerateProblem(status int, code, title string, err error) *Problem {
+	if code == "" {
+		code = StatusCode(status)
+	}
+
+	var detail string
+	if err != nil {
+		detail = err.Error()
+	}
+
+	return &Problem{
+		Type:   "urn:wallet-api:problem:" + code,
+		Title:  title,
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// StatusCode is the generic code of an http status, e.g. too_many_requests for 429
+func StatusCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusInternalServerError:
+		return CodeInternal
+	case StatusClientClosedRequest:
+		return CodeCanceled
+	}
+
+	text := http.StatusText(status)
+	if text == "" {
+		return CodeInternal
+	}
+
+	return strings.ReplaceAll(strings.ToLower(strings.ReplaceAll(text, "-", " ")), " ", "_")
+}
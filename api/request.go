@@ -0,0 +1,128 @@
+package api
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// LoginRequest is the parsed struct of the /login endpoint
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// RefreshRequest swaps the refresh token from the login for a new pair of tokens
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type BalanceRequest struct {
+	UserId   int `json:"user_id"`
+	WalletId int `json:"wallet_id"`
+}
+
+type CreditRequest struct {
+	UserId   int             `json:"user_id"`
+	WalletId int             `json:"wallet_id"`
+	Amount   decimal.Decimal `json:"amount"`
+	Category string          `json:"category,omitempty"`
+}
+
+// WinRequest is a player's win credited by a game server to the player's wallet
+type WinRequest struct {
+	WalletId int             `json:"wallet_id"`
+	Amount   decimal.Decimal `json:"amount"`
+}
+
+type DebitRequest struct {
+	UserId   int             `json:"user_id"`
+	WalletId int             `json:"wallet_id"`
+	Amount   decimal.Decimal `json:"amount"`
+	Category string          `json:"category,omitempty"`
+}
+
+type TransferRequest struct {
+	UserId     int             `json:"user_id"`
+	WalletId   int             `json:"wallet_id"`
+	ToWalletId int             `json:"to_wallet_id"`
+	Amount     decimal.Decimal `json:"amount"`
+}
+
+// LinkMinorRequest is sent by an admin with the username of the minor to link to the guardian
+type LinkMinorRequest struct {
+	Username string `json:"username" validate:"required"`
+}
+
+// WalletControlsRequest sets the guardian restrictions on a minor's wallet, zero amounts disable the check
+type WalletControlsRequest struct {
+	DailySpendLimit   decimal.Decimal `json:"daily_spend_limit"`
+	ApprovalThreshold decimal.Decimal `json:"approval_threshold"`
+	BlockedCategories []string        `json:"blocked_categories"`
+}
+
+// LimitRequest saves the limits of an operation for the scope, amounts of 0 disable the check
+type LimitRequest struct {
+	Scope          string          `json:"scope" validate:"required,oneof=global tier wallet"`
+	Tier           string          `json:"tier,omitempty" validate:"required_if=Scope tier"`
+	WalletID       int             `json:"wallet_id,omitempty" validate:"required_if=Scope wallet"`
+	Operation      string          `json:"operation" validate:"required,oneof=credit debit"`
+	PerTransaction decimal.Decimal `json:"per_transaction"`
+	Daily          decimal.Decimal `json:"daily"`
+	Weekly         decimal.Decimal `json:"weekly"`
+	Monthly        decimal.Decimal `json:"monthly"`
+	PerMinute      int             `json:"per_minute" validate:"gte=0"`
+}
+
+// GamingLimitsRequest sets the user's deposit and net loss limits, amounts of 0 remove the limit and the limits left
+// out stay as they are
+type GamingLimitsRequest struct {
+	DepositLimit  *decimal.Decimal `json:"deposit_limit,omitempty"`
+	DepositPeriod string           `json:"deposit_period" validate:"omitempty,oneof=day week month"`
+	LossLimit     *decimal.Decimal `json:"loss_limit,omitempty"`
+	LossPeriod    string           `json:"loss_period" validate:"omitempty,oneof=day week month"`
+}
+
+// ExclusionRequest starts a cooling-off or self-exclusion period lasting the days sent
+type ExclusionRequest struct {
+	Days int `json:"days" validate:"required,gt=0"`
+}
+
+// KYCDocumentRequest records the metadata of a document an admin checked
+type KYCDocumentRequest struct {
+	Type      string     `json:"type" validate:"required,oneof=passport id_card driving_licence proof_of_address"`
+	Reference string     `json:"reference" validate:"required"`
+	Country   string     `json:"country" validate:"required,len=2"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// KYCVerificationRequest records the outcome of an admin's review, verified users move to the tier sent
+type KYCVerificationRequest struct {
+	Outcome string `json:"outcome" validate:"required,oneof=verified rejected"`
+	Tier    string `json:"tier" validate:"required_if=Outcome verified,omitempty,oneof=basic full"`
+	Notes   string `json:"notes"`
+}
+
+// WalletStatusRequest freezes, unfreezes or closes a wallet, BlockCredits only applies to freezes
+type WalletStatusRequest struct {
+	Reason       string `json:"reason" validate:"required,oneof=fraud legal_hold customer_request investigation_cleared other"`
+	Notes        string `json:"notes"`
+	BlockCredits bool   `json:"block_credits"`
+}
+
+// WebhookRequest registers an endpoint for the user's wallet events, all of them are sent when Events is empty
+type WebhookRequest struct {
+	URL    string   `json:"url" validate:"required,url,startswith=http"`
+	Events []string `json:"events" validate:"dive,oneof=wallet.credited wallet.debited wallet.transferred_out wallet.transferred_in"`
+}
+
+// SocketRequest is a command sent over the websocket, ID is echoed back in the response so clients can match them.
+// Credits and debits sent again with the same IdempotencyKey get the first response back, like the http routes.
+type SocketRequest struct {
+	ID             string          `json:"id"`
+	Type           string          `json:"type"`
+	WalletID       int             `json:"wallet_ID"`
+	Amount         decimal.Decimal `json:"amount"`
+	Category       string          `json:"category,omitempty"`
+	IdempotencyKey string          `json:"idempotency_key,omitempty"`
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// MessageResponse is a generic response struct that'll be marshalled to json and sent to the requester
+type MessageResponse struct {
+	Message string `json:"message"`
+	Result  any    `json:"result,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// LoginResponse carries the access token expiring at ExpiresAt, in unix seconds, and the refresh token to get a new pair
+type LoginResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresAt    int64  `json:"expires_at,omitempty"`
+}
+
+type BalanceResponse struct {
+	UserID   int             `json:"user_ID"`
+	WalletID int             `json:"wallet_ID"`
+	Balance  decimal.Decimal `json:"balance"`
+}
+
+type CreditResponse struct {
+	UserID        int             `json:"user_ID"`
+	WalletID      int             `json:"wallet_ID"`
+	Balance       decimal.Decimal `json:"balance"`
+	TransactionID int             `json:"transaction_ID,omitempty"`
+}
+
+type DebitResponse struct {
+	UserID        int             `json:"user_ID"`
+	WalletID      int             `json:"wallet_ID"`
+	Balance       decimal.Decimal `json:"balance"`
+	TransactionID int             `json:"transaction_ID,omitempty"`
+	Status        string          `json:"status,omitempty"`
+}
+
+type TransferResponse struct {
+	UserID        int             `json:"user_ID"`
+	WalletID      int             `json:"wallet_ID"`
+	ToWalletID    int             `json:"to_wallet_ID"`
+	Balance       decimal.Decimal `json:"balance"`
+	TransactionID int             `json:"transaction_ID,omitempty"`
+}
+
+type TransactionResponse struct {
+	ID        int             `json:"ID"`
+	WalletID  int             `json:"wallet_ID"`
+	Type      string          `json:"type"`
+	Amount    decimal.Decimal `json:"amount"`
+	Balance   decimal.Decimal `json:"balance"`
+	Category  string          `json:"category,omitempty"`
+	Status    string          `json:"status"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type WalletControlsResponse struct {
+	WalletID          int             `json:"wallet_ID"`
+	DailySpendLimit   decimal.Decimal `json:"daily_spend_limit"`
+	ApprovalThreshold decimal.Decimal `json:"approval_threshold"`
+	BlockedCategories []string        `json:"blocked_categories"`
+}
+
+type LimitResponse struct {
+	ID             int             `json:"ID"`
+	Scope          string          `json:"scope"`
+	Tier           string          `json:"tier,omitempty"`
+	WalletID       int             `json:"wallet_ID,omitempty"`
+	Operation      string          `json:"operation"`
+	PerTransaction decimal.Decimal `json:"per_transaction"`
+	Daily          decimal.Decimal `json:"daily"`
+	Weekly         decimal.Decimal `json:"weekly"`
+	Monthly        decimal.Decimal `json:"monthly"`
+	PerMinute      int             `json:"per_minute"`
+}
+
+type GamingControlsResponse struct {
+	UserID               int              `json:"user_ID"`
+	DepositLimit         decimal.Decimal  `json:"deposit_limit"`
+	DepositPeriod        string           `json:"deposit_period"`
+	LossLimit            decimal.Decimal  `json:"loss_limit"`
+	LossPeriod           string           `json:"loss_period"`
+	PendingDepositLimit  *decimal.Decimal `json:"pending_deposit_limit,omitempty"`
+	PendingDepositPeriod string           `json:"pending_deposit_period,omitempty"`
+	PendingLossLimit     *decimal.Decimal `json:"pending_loss_limit,omitempty"`
+	PendingLossPeriod    string           `json:"pending_loss_period,omitempty"`
+	PendingFrom          *time.Time       `json:"pending_from,omitempty"`
+	CoolingOffUntil      *time.Time       `json:"cooling_off_until,omitempty"`
+	SelfExcludedUntil    *time.Time       `json:"self_excluded_until,omitempty"`
+}
+
+type KYCDocumentResponse struct {
+	ID        int        `json:"ID"`
+	Type      string     `json:"type"`
+	Reference string     `json:"reference"`
+	Country   string     `json:"country"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	AdminID   int        `json:"admin_ID"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type KYCVerificationResponse struct {
+	ID        int       `json:"ID"`
+	Outcome   string    `json:"outcome"`
+	Tier      string    `json:"tier,omitempty"`
+	Notes     string    `json:"notes,omitempty"`
+	AdminID   int       `json:"admin_ID"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type KYCResponse struct {
+	UserID        int                       `json:"user_ID"`
+	Status        string                    `json:"status"`
+	Tier          string                    `json:"tier"`
+	Documents     []KYCDocumentResponse     `json:"documents"`
+	Verifications []KYCVerificationResponse `json:"verifications"`
+}
+
+type WalletStatusChangeResponse struct {
+	ID           int       `json:"ID"`
+	AdminID      int       `json:"admin_ID"`
+	FromStatus   string    `json:"from_status"`
+	ToStatus     string    `json:"to_status"`
+	Reason       string    `json:"reason"`
+	Notes        string    `json:"notes,omitempty"`
+	BlockCredits bool      `json:"block_credits"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type WalletStatusResponse struct {
+	WalletID     int                          `json:"wallet_ID"`
+	Status       string                       `json:"status"`
+	BlockCredits bool                         `json:"block_credits"`
+	History      []WalletStatusChangeResponse `json:"history"`
+}
+
+// HealthCheck is the state of one of the dependencies of the api, the migrations one carries the schema's version
+type HealthCheck struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Version  uint   `json:"version,omitempty"`
+	Expected uint   `json:"expected,omitempty"`
+}
+
+// ReadinessResponse is up when every dependency is
+type ReadinessResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks"`
+}
+
+func GenerateMessageResponse(message string, res interface{}, err error) *MessageResponse {
+
+	var errorMessage string
+	if err != nil {
+		errorMessage = err.Error()
+	}
+
+	return &MessageResponse{
+		Message: message,
+		Result:  res,
+		Error:   errorMessage,
+	}
+}
+
+// WalletEvent is the payload of the events published when a wallet's balance changes
+type WalletEvent struct {
+	Type             string          `json:"type"`
+	TransactionID    int             `json:"transaction_ID"`
+	WalletID         int             `json:"wallet_ID"`
+	UserID           int             `json:"user_ID"`
+	Amount           decimal.Decimal `json:"amount"`
+	Balance          decimal.Decimal `json:"balance"`
+	Category         string          `json:"category,omitempty"`
+	TransferWalletID int             `json:"transfer_wallet_ID,omitempty"`
+	OccurredAt       time.Time       `json:"occurred_at"`
+}
+
+// WebhookResponse only carries the secret when the webhook is registered, it's not shown again
+type WebhookResponse struct {
+	ID        int       `json:"ID"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookDeliveryResponse struct {
+	ID             int        `json:"ID"`
+	WebhookID      int        `json:"webhook_ID"`
+	EventID        int        `json:"event_ID"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// SocketMessage is anything sent to websocket clients, responses carry the request's ID and events the raw wallet event.
+// Failed commands have the same Code as the problem the HTTP endpoint would've returned.
+type SocketMessage struct {
+	ID       string          `json:"id,omitempty"`
+	Type     string          `json:"type"`
+	Status   int             `json:"status,omitempty"`
+	WalletID int             `json:"wallet_ID,omitempty"`
+	Result   any             `json:"result,omitempty"`
+	Code     string          `json:"code,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	Event    json.RawMessage `json:"event,omitempty"`
+	Replayed bool            `json:"replayed,omitempty"`
+}
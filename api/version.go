@@ -0,0 +1,82 @@
+package api
+
+// Versions of the http api, each mounted under its own prefix, e.g. /v1/wallet/1/balance
+const (
+	V1 = "v1"
+	V2 = "v2"
+)
+
+// LowerCaseIDs renames the object keys sent by v1 as ID or ending in _ID to id and _id, turning a v1 body into its v2
+// shape. Only the keys are renamed, strings in the values are left as they are. The renamed keys have the same length
+// so the body can be rewritten as it's written, each write holding whole json values like gin's renders and events do.
+func LowerCaseIDs(body []byte) []byte {
+	var renamed []byte
+	for i := 0; i < len(body); i++ {
+		if body[i] != '"' {
+			continue
+		}
+
+		end := stringEnd(body, i)
+		if end < 0 {
+			break
+		}
+
+		if isKey(body, end+1) && LowerCaseID(string(body[i+1:end])) != string(body[i+1:end]) {
+			// the body passed is left untouched, it can be the caller's buffer
+			if renamed == nil {
+				renamed = append([]byte(nil), body...)
+			}
+			renamed[end-2], renamed[end-1] = 'i', 'd'
+		}
+
+		i = end
+	}
+
+	if renamed == nil {
+		return body
+	}
+
+	return renamed
+}
+
+// LowerCaseID returns the v2 name of a v1 key, e.g. wallet_id for wallet_ID and id for ID
+func LowerCaseID(key string) string {
+	switch {
+	case key == "ID":
+		return "id"
+	case len(key) > 3 && key[len(key)-3:] == "_ID":
+		return key[:len(key)-2] + "id"
+	default:
+		return key
+	}
+}
+
+// stringEnd returns the index of the quote closing the string opened at start, or -1 when the string isn't closed
+func stringEnd(body []byte, start int) int {
+	for i := start + 1; i < len(body); i++ {
+		switch body[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+
+	return -1
+}
+
+// isKey checks if the string ending before from is an object key, i.e. it's followed by a colon
+func isKey(body []byte, from int) bool {
+	for i := from; i < len(body); i++ {
+		switch body[i] {
+		case ' ', '\t', '\n', '\r':
+			continue
+		case ':':
+			return true
+		default:
+			return false
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLowerCaseIDs(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Body     string
+		Expected string
+	}{
+		{
+			Name:     "Keys ending in _ID are renamed",
+			Body:     `{"user_ID":1,"wallet_ID":2,"balance":"10.5"}`,
+			Expected: `{"user_id":1,"wallet_id":2,"balance":"10.5"}`,
+		},
+		{
+			Name:     "Bare ID keys are renamed",
+			Body:     `{"data":[{"ID":7, "wallet_ID" : 2}]}`,
+			Expected: `{"data":[{"id":7, "wallet_id" : 2}]}`,
+		},
+		{
+			Name:     "Values are left as they are",
+			Body:     `{"detail":"wallet_ID is missing","category":"ID","name":"\"user_ID\": 1"}`,
+			Expected: `{"detail":"wallet_ID is missing","category":"ID","name":"\"user_ID\": 1"}`,
+		},
+		{
+			Name:     "Keys with escaped quotes before them",
+			Body:     `{"name":"a \"quoted\" \\","to_wallet_ID":3}`,
+			Expected: `{"name":"a \"quoted\" \\","to_wallet_id":3}`,
+		},
+		{
+			Name:     "Server sent events",
+			Body:     "event:transaction\ndata:{\"transaction_ID\":1,\"category\":\"user_ID\"}\n\n",
+			Expected: "event:transaction\ndata:{\"transaction_id\":1,\"category\":\"user_ID\"}\n\n",
+		},
+		{
+			Name:     "Keys that don't end in _ID",
+			Body:     `{"IDs":[1],"VALID":true,"_ID":1}`,
+			Expected: `{"IDs":[1],"VALID":true,"_ID":1}`,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			body := []byte(test.Body)
+
+			require.Equal(t, test.Expected, string(LowerCaseIDs(body)))
+			require.Equal(t, test.Body, string(body), "the body passed is left untouched")
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"wallet-api/api"
+)
+
+// Login gets the tokens used by the other calls, they're refreshed before expiring as long as the refresh token is valid
+func (c *Client) Login(ctx context.Context, username, password string) (*api.LoginResponse, error) {
+	var res api.LoginResponse
+	if err := c.call(ctx, http.MethodPost, "/login", api.LoginRequest{Username: username, Password: password}, false, &res); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.setTokens(&res)
+	c.mu.Unlock()
+
+	return &res, nil
+}
+
+// RefreshToken swaps the refresh token for a new pair straight away, calls already do it when the token is about to expire
+func (c *Client) RefreshToken(ctx context.Context) (*api.LoginResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.refresh(ctx)
+}
+
+// Token returns the tokens in use so they can be saved and passed to WithToken later
+func (c *Client) Token() (token, refreshToken string, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.token, c.refreshToken, c.expiresAt
+}
+
+// validToken returns the access token, refreshing it first when it expires soon
+func (c *Client) validToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token == "" {
+		return "", ErrNotLoggedIn
+	}
+
+	if c.refreshToken != "" && !c.expiresAt.IsZero() && time.Until(c.expiresAt) < refreshBefore {
+		if _, err := c.refresh(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	return c.token, nil
+}
+
+// refresh must be called with mu held
+func (c *Client) refresh(ctx context.Context) (*api.LoginResponse, error) {
+	if c.refreshToken == "" {
+		return nil, ErrNotLoggedIn
+	}
+
+	var res api.LoginResponse
+	if err := c.call(ctx, http.MethodPost, "/token/refresh", api.RefreshRequest{RefreshToken: c.refreshToken}, false, &res); err != nil {
+		return nil, err
+	}
+
+	c.setTokens(&res)
+
+	return &res, nil
+}
+
+func (c *Client) setTokens(res *api.LoginResponse) {
+	c.token = res.Token
+	c.refreshToken = res.RefreshToken
+	c.expiresAt = time.Time{}
+	if res.ExpiresAt > 0 {
+		c.expiresAt = time.Unix(res.ExpiresAt, 0)
+	}
+}
@@ -0,0 +1,277 @@
+// Package client is a typed Go client for wallet-api, taking care of the tokens, retries and idempotency keys.
+//
+//	c := client.New("http://localhost:8080")
+//	if _, err := c.Login(ctx, "alex", "secret"); err != nil {
+//		return err
+//	}
+//	res, err := c.Credit(ctx, &api.CreditRequest{WalletId: 1, Amount: decimal.NewFromInt(10)})
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"wallet-api/api"
+)
+
+const (
+	defaultTimeout   = 10 * time.Second
+	defaultRetries   = 3
+	defaultRetryWait = 200 * time.Millisecond
+
+	// refreshBefore is how long before the token expires it's refreshed, so requests don't race the expiry
+	refreshBefore = time.Minute
+
+	idempotencyKeyHeader = "Idempotency-Key"
+
+	// versionPrefix is the version of the api the client's types are for
+	versionPrefix = "/" + api.V1
+)
+
+// ErrNotLoggedIn is returned by the calls needing a token before Login or WithToken
+var ErrNotLoggedIn = errors.New("client is not logged in")
+
+// Error is a problem returned by the api. Code is one of the api.Code constants to branch on, Message what failed and
+// Err why.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Err        string
+}
+
+func (e *Error) Error() string {
+	if e.Err == "" {
+		return fmt.Sprintf("wallet-api: %d %s (%s)", e.StatusCode, e.Message, e.Code)
+	}
+
+	return fmt.Sprintf("wallet-api: %d %s (%s): %s", e.StatusCode, e.Message, e.Code, e.Err)
+}
+
+// Client is safe for concurrent use, the tokens are shared between the calls
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	retries    int
+	retryWait  time.Duration
+	language   string
+
+	// mu is held while the token is refreshed so concurrent calls wait for the new one instead of all refreshing it
+	mu           sync.Mutex
+	token        string
+	refreshToken string
+	expiresAt    time.Time
+}
+
+type Option func(*Client)
+
+// WithHTTPClient replaces the default client, which times out after 10 seconds
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetries sets how many times failed calls are retried and the wait before the first retry, doubling after each one
+func WithRetries(retries int, wait time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.retryWait = wait
+	}
+}
+
+// WithLanguage asks for the messages of the responses and errors in the language, e.g. "es", English is the fallback
+func WithLanguage(language string) Option {
+	return func(c *Client) {
+		c.language = language
+	}
+}
+
+// WithToken starts the client with tokens saved from an earlier login
+func WithToken(token, refreshToken string, expiresAt time.Time) Option {
+	return func(c *Client) {
+		c.token = token
+		c.refreshToken = refreshToken
+		c.expiresAt = expiresAt
+	}
+}
+
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		retries:    defaultRetries,
+		retryWait:  defaultRetryWait,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+type idempotencyKey struct{}
+
+// WithIdempotencyKey sets the key sent with a credit, debit or transfer. Without one a random key is used for the call's
+// retries, setting it lets a caller retry safely after its own crash by sending the same key again.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// envelope holds either the api's MessageResponse, with the result left raw to decode it into the call's type, or a
+// problem
+type envelope struct {
+	Message string          `json:"message"`
+	Result  json.RawMessage `json:"result"`
+
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+	Code   string `json:"code"`
+}
+
+// call sends the request, retrying network errors and the statuses worth retrying, and decodes the result into out
+func (c *Client) call(ctx context.Context, method, path string, body any, auth bool, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	// mutating wallet calls all carry a key so retrying them can't move money twice
+	var key string
+	if method == http.MethodPost && auth {
+		key, _ = ctx.Value(idempotencyKey{}).(string)
+		if key == "" {
+			key = newIdempotencyKey()
+		}
+	}
+	idempotent := method == http.MethodGet || key != ""
+
+	wait := c.retryWait
+
+	for attempt := 0; ; attempt++ {
+		var token string
+		if auth {
+			var err error
+			if token, err = c.validToken(ctx); err != nil {
+				return err
+			}
+		}
+
+		status, env, err := c.send(ctx, method, path, payload, token, key)
+
+		if err == nil && status < http.StatusMultipleChoices {
+			if out == nil || len(env.Result) == 0 {
+				return nil
+			}
+			return json.Unmarshal(env.Result, out)
+		}
+
+		if err == nil {
+			err = &Error{StatusCode: status, Code: env.Code, Message: env.Title, Err: env.Detail}
+		}
+
+		if attempt >= c.retries || !retryable(err, idempotent) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, path string, payload []byte, token, key string) (int, *envelope, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+versionPrefix+path, body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if key != "" {
+		req.Header.Set(idempotencyKeyHeader, key)
+	}
+	if c.language != "" {
+		req.Header.Set("Accept-Language", c.language)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+
+	var env envelope
+	if err = json.NewDecoder(res.Body).Decode(&env); err != nil && res.StatusCode < http.StatusMultipleChoices {
+		return 0, nil, fmt.Errorf("something went wrong decoding the response: %w", err)
+	}
+
+	// errors from proxies in front of the api aren't problems
+	if env.Title == "" {
+		env.Title = http.StatusText(res.StatusCode)
+	}
+	if env.Code == "" {
+		env.Code = api.StatusCode(res.StatusCode)
+	}
+
+	return res.StatusCode, &env, nil
+}
+
+// retryable tells whether sending the call again could work. Rate limited calls and keys still in progress didn't run,
+// other client errors would get the same answer. Network and server errors may come after the call ran, so they're only
+// retried for idempotent calls.
+func retryable(err error, idempotent bool) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		// network errors
+		return idempotent
+	}
+
+	if apiErr.Code == api.CodeIdempotencyKeyInProgress || apiErr.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+
+	switch apiErr.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent
+	}
+
+	return false
+}
+
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,168 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+
+	"wallet-api/api"
+)
+
+// testServer records the requests it gets and answers them with respond
+type testServer struct {
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+func (s *testServer) start(t *testing.T, respond func(n int, r *http.Request) (int, any)) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r)
+		n := len(s.requests)
+		s.mu.Unlock()
+
+		status, body := respond(n, r)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func (s *testServer) sent() []*http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+func problem(status int, code string) api.Problem {
+	return api.Problem{Title: http.StatusText(status), Status: status, Code: code}
+}
+
+func TestRefresh(t *testing.T) {
+	var server testServer
+	srv := server.start(t, func(n int, r *http.Request) (int, any) {
+		if r.URL.Path == "/v1/token/refresh" {
+			return http.StatusOK, api.MessageResponse{Result: api.LoginResponse{Token: "new-token", RefreshToken: "new-refresh", ExpiresAt: time.Now().Add(time.Hour).Unix()}}
+		}
+		return http.StatusOK, api.MessageResponse{Result: api.BalanceResponse{UserID: 1, WalletID: 1, Balance: decimal.NewFromInt(10)}}
+	})
+
+	t.Run("Token about to expire is refreshed first", func(t *testing.T) {
+		c := New(srv.URL, WithToken("old-token", "old-refresh", time.Now().Add(30*time.Second)))
+
+		res, err := c.Balance(context.Background(), 1)
+		require.NoError(t, err)
+		require.True(t, decimal.NewFromInt(10).Equal(res.Balance))
+
+		sent := server.sent()
+		require.Len(t, sent, 2)
+		require.Equal(t, "/v1/token/refresh", sent[0].URL.Path)
+		require.Equal(t, "Bearer new-token", sent[1].Header.Get("Authorization"))
+
+		token, refreshToken, _ := c.Token()
+		require.Equal(t, "new-token", token)
+		require.Equal(t, "new-refresh", refreshToken)
+	})
+
+	t.Run("Calls before logging in fail", func(t *testing.T) {
+		_, err := New(srv.URL).Balance(context.Background(), 1)
+		require.ErrorIs(t, err, ErrNotLoggedIn)
+	})
+}
+
+func TestRetries(t *testing.T) {
+	credited := api.MessageResponse{Result: api.CreditResponse{UserID: 1, WalletID: 1, Balance: decimal.NewFromInt(10)}}
+
+	t.Run("Server errors are retried with the same idempotency key", func(t *testing.T) {
+		var server testServer
+		srv := server.start(t, func(n int, r *http.Request) (int, any) {
+			if n == 1 {
+				return http.StatusInternalServerError, problem(http.StatusInternalServerError, api.CodeInternal)
+			}
+			return http.StatusOK, credited
+		})
+
+		c := New(srv.URL, WithToken("token", "", time.Time{}), WithRetries(2, time.Millisecond))
+
+		_, err := c.Credit(context.Background(), &api.CreditRequest{WalletId: 1, Amount: decimal.NewFromInt(10)})
+		require.NoError(t, err)
+
+		sent := server.sent()
+		require.Len(t, sent, 2)
+		require.NotEmpty(t, sent[0].Header.Get(idempotencyKeyHeader))
+		require.Equal(t, sent[0].Header.Get(idempotencyKeyHeader), sent[1].Header.Get(idempotencyKeyHeader))
+	})
+
+	t.Run("The caller's idempotency key is sent", func(t *testing.T) {
+		var server testServer
+		srv := server.start(t, func(n int, r *http.Request) (int, any) {
+			return http.StatusOK, credited
+		})
+
+		c := New(srv.URL, WithToken("token", "", time.Time{}))
+
+		_, err := c.Credit(WithIdempotencyKey(context.Background(), "order-1"), &api.CreditRequest{WalletId: 1, Amount: decimal.NewFromInt(10)})
+		require.NoError(t, err)
+		require.Equal(t, "order-1", server.sent()[0].Header.Get(idempotencyKeyHeader))
+	})
+
+	t.Run("Server errors of calls without a key aren't retried", func(t *testing.T) {
+		var server testServer
+		srv := server.start(t, func(n int, r *http.Request) (int, any) {
+			return http.StatusInternalServerError, problem(http.StatusInternalServerError, api.CodeInternal)
+		})
+
+		c := New(srv.URL, WithRetries(2, time.Millisecond))
+
+		_, err := c.Login(context.Background(), "alex", "secret")
+
+		var apiErr *Error
+		require.True(t, errors.As(err, &apiErr))
+		require.Equal(t, http.StatusInternalServerError, apiErr.StatusCode)
+		require.Len(t, server.sent(), 1)
+	})
+
+	t.Run("Rate limited calls without a key are retried", func(t *testing.T) {
+		var server testServer
+		srv := server.start(t, func(n int, r *http.Request) (int, any) {
+			if n == 1 {
+				return http.StatusTooManyRequests, problem(http.StatusTooManyRequests, api.StatusCode(http.StatusTooManyRequests))
+			}
+			return http.StatusOK, api.MessageResponse{Result: api.LoginResponse{Token: "token"}}
+		})
+
+		c := New(srv.URL, WithRetries(2, time.Millisecond))
+
+		_, err := c.Login(context.Background(), "alex", "secret")
+		require.NoError(t, err)
+		require.Len(t, server.sent(), 2)
+	})
+
+	t.Run("Client errors aren't retried", func(t *testing.T) {
+		var server testServer
+		srv := server.start(t, func(n int, r *http.Request) (int, any) {
+			return http.StatusBadRequest, problem(http.StatusBadRequest, api.CodeWrongAmount)
+		})
+
+		c := New(srv.URL, WithToken("token", "", time.Time{}), WithRetries(2, time.Millisecond))
+
+		_, err := c.Debit(context.Background(), &api.DebitRequest{WalletId: 1, Amount: decimal.NewFromInt(10)})
+
+		var apiErr *Error
+		require.True(t, errors.As(err, &apiErr))
+		require.Equal(t, api.CodeWrongAmount, apiErr.Code)
+		require.Len(t, server.sent(), 1)
+	})
+}
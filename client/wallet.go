@@ -0,0 +1,48 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"wallet-api/api"
+)
+
+func (c *Client) Balance(ctx context.Context, walletID int) (*api.BalanceResponse, error) {
+	var res api.BalanceResponse
+	if err := c.call(ctx, http.MethodGet, fmt.Sprintf("/wallet/%d/balance", walletID), nil, true, &res); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// Credit adds the amount to req.WalletId, the user comes from the token
+func (c *Client) Credit(ctx context.Context, req *api.CreditRequest) (*api.CreditResponse, error) {
+	var res api.CreditResponse
+	if err := c.call(ctx, http.MethodPost, fmt.Sprintf("/wallet/%d/credit", req.WalletId), req, true, &res); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// Debit takes the amount from req.WalletId, debits waiting for the guardian's approval come back with the pending status
+func (c *Client) Debit(ctx context.Context, req *api.DebitRequest) (*api.DebitResponse, error) {
+	var res api.DebitResponse
+	if err := c.call(ctx, http.MethodPost, fmt.Sprintf("/wallet/%d/debit", req.WalletId), req, true, &res); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// Transfer moves the amount from req.WalletId to req.ToWalletId
+func (c *Client) Transfer(ctx context.Context, req *api.TransferRequest) (*api.TransferResponse, error) {
+	var res api.TransferResponse
+	if err := c.call(ctx, http.MethodPost, fmt.Sprintf("/wallet/%d/transfer", req.WalletId), req, true, &res); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
@@ -1,111 +1,108 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"strconv"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/gin-gonic/gin"
-	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
-	"gorm.io/gorm"
 
+	"wallet-api/internal/app"
 	"wallet-api/internal/config"
-	"wallet-api/internal/handlers"
-	"wallet-api/internal/services"
+	"wallet-api/internal/metrics"
+	"wallet-api/internal/tracing"
 	"wallet-api/internal/utils"
 )
 
 func main() {
-	logger, err := utils.SetUpLogger()
+	// info until the configuration is read, then LOG_LEVEL, changed on reload
+	level := zap.NewAtomicLevel()
+
+	logger, err := utils.SetUpLogger(level)
 	if err != nil {
 		log.Fatalf("somethign went wrong setting up logger for api: %+v", err)
 	}
 
 	defer logger.Sync()
 
-	logger.Info("🚀 connecting to db")
-
-	dbConnection, err := utils.SetUpDBConnection(
-		config.WalletConfigs.DBUser,
-		config.WalletConfigs.DBPassword,
-		config.WalletConfigs.Host,
-		config.WalletConfigs.DBName,
-		logger,
-	)
+	cfg, err := config.LoadConfig(".")
 	if err != nil {
-		logger.Fatal("exiting application...", zap.Error(err))
+		logger.Fatal("❌ something went wrong reading the configuration", zap.Error(err))
 	}
 
-	logger.Info(fmt.Sprintf("✅ Setup connection to %s db.", dbConnection.Migrator().CurrentDatabase()))
+	// every problem is reported at once, prod refuses the defaults meant for running locally
+	if err = cfg.Validate(); err != nil {
+		logger.Fatal("❌ invalid configuration", zap.String("profile", cfg.Profile), zap.Error(err))
+	}
 
-	logger.Info("🚀 Running migrations")
+	logger.Info(fmt.Sprintf("✅ Loaded the %s configuration", cfg.Profile))
 
-	if err = utils.SetUpSchema(dbConnection, logger); err != nil {
-		logger.Fatal(err.Error())
-	}
+	// caught from the start, a SIGHUP sent before the watcher runs would otherwise kill the process
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
 
-	db, err := dbConnection.DB()
-	if err != nil {
-		logger.Fatal("something went wrong getting the database conn from gorm", zap.Error(err))
+	if err = level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		logger.Fatal("something went wrong setting the log level", zap.Error(err))
 	}
 
-	if err = utils.RunUpMigrations(db, logger); err != nil {
-		logger.Fatal(err.Error())
+	if cfg.Profile == config.ProfileProd {
+		gin.SetMode(gin.ReleaseMode)
 	}
 
-	logger.Info(fmt.Sprintf("✅ Applied migrations to %s db.", dbConnection.Migrator().CurrentDatabase()))
-
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:     config.WalletConfigs.RedisAddress,
-		Password: config.WalletConfigs.RedisPassword,
-		DB:       config.WalletConfigs.RedisDB,
+	// the tracer provider and the metrics registry are global to the process, set up here rather than per app
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Settings{
+		Exporter:    cfg.TracingExporter,
+		Endpoint:    cfg.TracingEndpoint,
+		Insecure:    cfg.TracingInsecure,
+		SampleRatio: cfg.TracingSampleRatio,
 	})
-
-	routes, err := setUpRoutes(dbConnection, redisClient, logger)
 	if err != nil {
-		logger.Fatal(err.Error())
+		logger.Fatal("something went wrong setting up tracing", zap.Error(err))
 	}
 
-	if err = routes.Run(); err != nil {
-		logger.Fatal("something went wrong setting up router")
+	application, err := app.New(cfg, logger)
+	if err != nil {
+		logger.Fatal("exiting application...", zap.Error(err))
 	}
-}
-
-// setUpRoutes adds routes and returns gin engine
-func setUpRoutes(dbConn *gorm.DB, rc *redis.Client, logger *zap.Logger) (*gin.Engine, error) {
 
-	portNum, err := strconv.Atoi(config.WalletConfigs.Port)
+	db, err := application.DB.DB()
 	if err != nil {
-		logger.Error(fmt.Sprintf("port config not int %d", err))
-		return nil, err
+		logger.Fatal("something went wrong getting the database conn from gorm", zap.Error(err))
 	}
 
-	userService := services.NewUserService(dbConn, rc, logger, services.UserServiceSettings{
-		Port:      portNum,
-		Hostname:  config.WalletConfigs.Host,
-		JWTSecret: config.WalletConfigs.JWTSecret,
-	})
+	if err = metrics.RegisterDB(db, cfg.DBName); err != nil {
+		logger.Fatal("something went wrong registering the db metrics", zap.Error(err))
+	}
 
-	walletService := services.NewWalletService(dbConn, rc, logger, services.WalletServiceSettings{
-		Port:              portNum,
-		Hostname:          config.WalletConfigs.Host,
-		RedisCacheTimeout: config.WalletConfigs.RedisExpiry,
-	}, userService)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
 
-	r := gin.New()
+	// the limits, cache expiry, log level and feature flags are reloaded when an env file changes or on SIGHUP
+	go config.NewWatcher(".", logger).Run(ctx, hangup, func(next config.Configurations) {
+		effective := application.Reload(next)
+		_ = level.UnmarshalText([]byte(effective.LogLevel))
+	})
 
-	r.Use(gin.Logger())
+	err = application.Run(ctx)
 
-	// r.Use(gin.Middleware)
-	r.GET("/ping", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"message": "pong",
-		})
-	})
+	// flushes the spans still batched, once the shutdown is traced
+	flushCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if tracingErr := shutdownTracing(flushCtx); tracingErr != nil {
+		logger.Error("something went wrong flushing the spans", zap.Error(tracingErr))
+	}
 
-	handlers.NewUserHandler(userService).UserRoutes(r.Group("/"))
-	handlers.NewWalletHandler(walletService, config.WalletConfigs.JWTSecret).WalletRoutes(r.Group("/"))
+	if err != nil {
+		logger.Error("❌ something went wrong shutting down", zap.Error(err))
+		_ = logger.Sync()
+		os.Exit(1)
+	}
 
-	return r, nil
+	logger.Info("👋 stopped")
 }
@@ -0,0 +1,63 @@
+// Command secrets seals an env file of secrets for SECRETS_FILE, so they can be kept on disk locally without being
+// written in plain text.
+//
+//	secrets key > secrets.key
+//	SECRETS_KEY=$(cat secrets.key) secrets seal < secrets.env > secrets.env.sealed
+//	SECRETS_KEY=$(cat secrets.key) secrets open < secrets.env.sealed
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"wallet-api/internal/config"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "secrets:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, in io.Reader, out io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: secrets key|seal|open")
+	}
+
+	if args[0] == "key" {
+		key, err := config.NewSecretsKey()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, key)
+		return err
+	}
+
+	key := os.Getenv("SECRETS_KEY")
+	if key == "" {
+		return fmt.Errorf("SECRETS_KEY must be set, see secrets key")
+	}
+
+	content, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	var result []byte
+	switch args[0] {
+	case "seal":
+		result, err = config.SealSecrets(key, content)
+	case "open":
+		result, err = config.OpenSecrets(key, content)
+	default:
+		return fmt.Errorf("unknown command %q, usage: secrets key|seal|open", args[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(result)
+	return err
+}
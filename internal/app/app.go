@@ -0,0 +1,247 @@
+// Package app builds the api from a configuration, its services, routes, servers and workers wired to the db and redis,
+// so main and the integration tests run the same thing and two differently configured apps can live in one process.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"gorm.io/gorm"
+
+	"wallet-api/internal/config"
+	"wallet-api/internal/lifecycle"
+	"wallet-api/internal/metrics"
+	"wallet-api/internal/services"
+	"wallet-api/internal/tracing"
+	"wallet-api/internal/utils"
+)
+
+// App is the api built from its configuration, nothing is served until Run
+type App struct {
+	// Config is the configuration the app was built from, see Effective for the one it runs with
+	Config config.Configurations
+	DB     *gorm.DB
+	Redis  *redis.Client
+	// Router serves the http api, the integration tests send their requests straight to it
+	Router *gin.Engine
+
+	grpc      *grpc.Server
+	logger    *zap.Logger
+	lifecycle *lifecycle.App
+
+	// the services whose settings are reloaded
+	users   *services.UserService
+	wallets *services.WalletService
+	limits  *services.LimitService
+	gaming  *services.GamingService
+	kyc     *services.KYCService
+
+	effective atomic.Pointer[config.Configurations]
+	reloading sync.Mutex
+}
+
+// New connects to the db and redis of the configuration, migrates the db and builds the app on them. The connections
+// are closed when the app stops.
+func New(cfg config.Configurations, logger *zap.Logger) (_ *App, err error) {
+	logger.Info("🚀 connecting to db")
+
+	dbConnection, err := utils.SetUpDBConnection(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := dbConnection.DB()
+	if err != nil {
+		logger.Error("something went wrong getting the database conn from gorm", zap.Error(err))
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = db.Close()
+		}
+	}()
+
+	logger.Info(fmt.Sprintf("✅ Setup connection to %s db.", dbConnection.Migrator().CurrentDatabase()))
+
+	if err = tracing.InstrumentGORM(dbConnection); err != nil {
+		logger.Error("something went wrong tracing the db", zap.Error(err))
+		return nil, err
+	}
+
+	logger.Info("🚀 Running migrations")
+
+	if err = utils.SetUpSchema(dbConnection, logger); err != nil {
+		return nil, err
+	}
+
+	if err = utils.RunUpMigrations(db, cfg.MigrationsDir, logger); err != nil {
+		return nil, err
+	}
+
+	logger.Info(fmt.Sprintf("✅ Applied migrations to %s db.", dbConnection.Migrator().CurrentDatabase()))
+
+	// admins are only named by the configuration, never by the dummy data
+	if err = utils.SetUpAdmins(dbConnection, cfg.AdminUsernames, logger); err != nil {
+		return nil, err
+	}
+
+	redisClient := redis.NewClient(&redis.Options{
+		Addr:     cfg.RedisAddress,
+		Password: cfg.RedisPassword,
+		DB:       cfg.RedisDB,
+	})
+
+	defer func() {
+		if err != nil {
+			_ = redisClient.Close()
+		}
+	}()
+
+	if err = tracing.InstrumentRedis(redisClient); err != nil {
+		logger.Error("something went wrong tracing redis", zap.Error(err))
+		return nil, err
+	}
+
+	app, err := Build(cfg, logger, dbConnection, redisClient)
+	if err != nil {
+		return nil, err
+	}
+
+	// closed last, in reverse, once the servers and the workers are done with them
+	app.lifecycle.OnClose("mysql", func(context.Context) error { return db.Close() })
+	app.lifecycle.OnClose("redis", func(context.Context) error { return redisClient.Close() })
+
+	return app, nil
+}
+
+// Build wires the app on connections already open, which are left to the caller to close. Nothing listens or runs in
+// the background until Run.
+func Build(cfg config.Configurations, logger *zap.Logger, db *gorm.DB, rc *redis.Client) (*App, error) {
+	app := &App{
+		Config: cfg,
+		DB:     db,
+		Redis:  rc,
+		logger: logger,
+		lifecycle: lifecycle.New(logger, lifecycle.Settings{
+			ShutdownTimeout: cfg.ShutdownTimeout,
+		}),
+	}
+	app.effective.Store(&cfg)
+
+	if err := app.setUpRoutes(); err != nil {
+		return nil, err
+	}
+
+	app.serveHTTP()
+	app.serveGRPC()
+	app.serveMetrics()
+
+	return app, nil
+}
+
+// Run serves http and grpc and runs the workers until the context is done or a server fails, then shuts everything down
+// in order
+func (app *App) Run(ctx context.Context) error {
+	return app.lifecycle.Run(ctx)
+}
+
+// Effective returns the configuration the app currently runs with, the one it was built from with the settings reloaded
+// since
+func (app *App) Effective() config.Configurations {
+	return *app.effective.Load()
+}
+
+// Reload applies the reloadable settings of the configuration to the running services, see config.Reload. The other
+// settings changed are logged and wait for a restart. It returns the effective configuration.
+func (app *App) Reload(next config.Configurations) config.Configurations {
+	app.reloading.Lock()
+	defer app.reloading.Unlock()
+
+	cfg, restart := app.Effective().Reload(next)
+	if len(restart) > 0 {
+		app.logger.Warn("settings changed which are only applied on restart", zap.Strings("settings", restart))
+	}
+
+	app.users.UpdateSettings(userSettings(cfg))
+	app.wallets.UpdateSettings(walletSettings(cfg))
+	app.limits.UpdateSettings(limitSettings(cfg))
+	app.gaming.UpdateSettings(gamingSettings(cfg))
+	app.kyc.UpdateSettings(kycSettings(cfg))
+
+	app.effective.Store(&cfg)
+
+	app.logger.Info("✅ Reloaded the configuration")
+
+	return cfg
+}
+
+// serveHTTP serves the router on the configured port
+func (app *App) serveHTTP() {
+	app.serve("http", &http.Server{Addr: fmt.Sprintf(":%d", app.Config.Port), Handler: app.Router})
+}
+
+// serveMetrics serves the prometheus metrics on their own port, kept off the public ingress and unauthenticated for the
+// scraper
+func (app *App) serveMetrics() {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+
+	app.serve("metrics", &http.Server{Addr: fmt.Sprintf(":%d", app.Config.MetricsPort), Handler: mux})
+}
+
+// serve runs the http server with the app
+func (app *App) serve(name string, server *http.Server) {
+	app.lifecycle.Serve(name, func() error {
+		app.logger.Info(fmt.Sprintf("✅ %s listening on %s", name, server.Addr))
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}, func(ctx context.Context) error {
+		// stops accepting requests and waits for the ones in flight, cutting them once the deadline is up so their db
+		// transactions roll back
+		if err := server.Shutdown(ctx); err != nil {
+			return errors.Join(err, server.Close())
+		}
+		return nil
+	})
+}
+
+// serveGRPC serves grpc alongside gin, the server is stopped gracefully with the app
+func (app *App) serveGRPC() {
+	app.lifecycle.Serve("grpc", func() error {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", app.Config.GRPCPort))
+		if err != nil {
+			app.logger.Error("something went wrong listening for grpc", zap.Error(err))
+			return err
+		}
+
+		app.logger.Info(fmt.Sprintf("✅ grpc listening on %s", listener.Addr()))
+		return app.grpc.Serve(listener)
+	}, func(ctx context.Context) error {
+		stopped := make(chan struct{})
+		go func() {
+			app.grpc.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+			return nil
+		case <-ctx.Done():
+			// cancels the calls still running
+			app.grpc.Stop()
+			return ctx.Err()
+		}
+	})
+}
@@ -0,0 +1,216 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redismock/v9"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"wallet-api/internal/config"
+	"wallet-api/internal/middleware"
+	"wallet-api/internal/pkg"
+	"wallet-api/internal/utils"
+)
+
+type appTestCase struct {
+	Name           string
+	App            *App
+	Path           string
+	Token          string
+	Expect         func(sqlMock sqlmock.Sqlmock, redisMock redismock.ClientMock)
+	ExpectedStatus int
+	ExpectedSunset string
+}
+
+// testApp builds an app from the config on its own mocked db and redis
+func testApp(t *testing.T, cfg config.Configurations) (*App, sqlmock.Sqlmock, redismock.ClientMock) {
+	mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = mockDB.Close() })
+
+	gormDB, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "sqlmock_db_0",
+		DriverName:                "mysql",
+		Conn:                      mockDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{})
+	require.NoError(t, err)
+
+	rd, redisMock := redismock.NewClientMock()
+
+	app, err := Build(cfg, zap.NewNop(), gormDB, rd)
+	require.NoError(t, err)
+
+	return app, sqlMock, redisMock
+}
+
+func testConfig(sunset string) config.Configurations {
+	cfg := config.Defaults()
+	cfg.JWTSecret = "access-secret"
+	cfg.RefreshSecret = "refresh-secret"
+	cfg.MigrationsDir = "../migrations"
+	cfg.LegacyRoutesSunset = sunset
+
+	return cfg
+}
+
+func TestBuild(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	migrationVersion, err := utils.LatestMigrationVersion("../migrations")
+	require.NoError(t, err)
+
+	// two apps in one process, each answering with its own configuration
+	first, firstSQL, firstRedis := testApp(t, testConfig("2027-04-19"))
+	second, _, _ := testApp(t, testConfig("2027-10-19"))
+
+	// signed with the access secret, as when both secrets are the same
+	refreshToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": 1,
+		"typ": pkg.TokenRefresh,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("access-secret"))
+	require.NoError(t, err)
+
+	testCases := []appTestCase{
+		{
+			App:            first,
+			Name:           "Liveness",
+			Path:           "/healthz",
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			App:  first,
+			Name: "Readiness checks the db, redis and the migrations",
+			Path: "/readyz",
+			Expect: func(sqlMock sqlmock.Sqlmock, redisMock redismock.ClientMock) {
+				redisMock.ExpectPing().SetVal("PONG")
+				sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT version, dirty FROM schema_migrations LIMIT 1")).
+					WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(migrationVersion, false))
+			},
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			App:            first,
+			Name:           "Wallet routes need a token",
+			Path:           "/v1/wallet/1/balance",
+			ExpectedStatus: http.StatusBadRequest,
+		},
+		{
+			App:            first,
+			Name:           "Refresh tokens aren't access tokens",
+			Path:           "/v1/wallet/1/balance",
+			Token:          refreshToken,
+			ExpectedStatus: http.StatusForbidden,
+		},
+		{
+			App:            first,
+			Name:           "Metrics aren't served with the api",
+			Path:           "/metrics",
+			ExpectedStatus: http.StatusNotFound,
+		},
+		{
+			App:            first,
+			Name:           "Legacy routes carry the first app's sunset",
+			Path:           "/openapi.json",
+			ExpectedStatus: http.StatusOK,
+			ExpectedSunset: "Mon, 19 Apr 2027 00:00:00 GMT",
+		},
+		{
+			App:            second,
+			Name:           "Legacy routes carry the second app's sunset",
+			Path:           "/openapi.json",
+			ExpectedStatus: http.StatusOK,
+			ExpectedSunset: "Tue, 19 Oct 2027 00:00:00 GMT",
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			if test.Expect != nil {
+				test.Expect(firstSQL, firstRedis)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, test.Path, nil)
+			if test.Token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.Token)
+			}
+
+			w := httptest.NewRecorder()
+			test.App.Router.ServeHTTP(w, req)
+
+			require.NoError(t, firstSQL.ExpectationsWereMet())
+			require.NoError(t, firstRedis.ExpectationsWereMet())
+
+			require.Equal(t, test.ExpectedStatus, w.Code, w.Body.String())
+			require.NotEmpty(t, w.Header().Get(middleware.RequestIDHeader))
+			if test.ExpectedSunset != "" {
+				require.Equal(t, test.ExpectedSunset, w.Header().Get("Sunset"))
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	app, _, _ := testApp(t, testConfig("2027-04-19"))
+
+	next := app.Effective()
+	next.LimitDaily = 50000
+	next.RedisExpiry = 5 * time.Minute
+	next.FeatureBalanceCache = false
+	next.LimitIncreaseDelay = time.Hour
+	next.KYCUnverifiedMaxBalance = 50000
+	next.JWTSecret = "another-secret"
+
+	effective := app.Reload(next)
+
+	// the reloadable settings reach the running services, the others wait for a restart
+	require.Equal(t, 50000, app.limits.Settings().Daily)
+	require.Equal(t, 5*time.Minute, app.wallets.Settings().RedisCacheTimeout)
+	require.True(t, app.wallets.Settings().BypassCache)
+	require.Equal(t, time.Hour, app.gaming.Settings().LimitIncreaseDelay)
+	require.Equal(t, 50000, app.kyc.Settings().UnverifiedMaxBalance)
+	require.Equal(t, "access-secret", effective.JWTSecret)
+	require.Equal(t, effective, app.Effective())
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":  1,
+		"role": pkg.RoleAdmin,
+		"typ":  pkg.TokenAccess,
+		"exp":  time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("access-secret"))
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/admin/config", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var res struct {
+		Result map[string]any `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+
+	require.EqualValues(t, 50000, res.Result["LIMIT_DAILY"])
+	require.Equal(t, "5m0s", res.Result["REDIS_EXPIRY"])
+	require.Equal(t, false, res.Result["FEATURE_BALANCE_CACHE"])
+	require.Equal(t, "[redacted]", res.Result["JWT_SECRET"])
+	require.Equal(t, "[redacted]", res.Result["REFRESH_SECRET"])
+	require.Equal(t, "", res.Result["REDIS_PASSWORD"])
+}
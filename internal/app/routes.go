@@ -0,0 +1,236 @@
+package app
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"wallet-api/api"
+	"wallet-api/internal/config"
+	"wallet-api/internal/events"
+	"wallet-api/internal/handlers"
+	"wallet-api/internal/middleware"
+	"wallet-api/internal/openapi"
+	"wallet-api/internal/rpc"
+	"wallet-api/internal/services"
+	"wallet-api/internal/utils"
+)
+
+// apiVersion is a version of the http api, its routes are mounted under /{name} behind the middleware
+type apiVersion struct {
+	name       string
+	routes     []func(*gin.RouterGroup)
+	middleware []gin.HandlerFunc
+}
+
+// setUpRoutes builds the services on the app's connections and routes them on its router and grpc server, the workers
+// are added to be run with the app
+func (app *App) setUpRoutes() error {
+	cfg, dbConn, rc, logger := app.Config, app.DB, app.Redis, app.logger
+
+	userService := services.NewUserService(dbConn, rc, logger, userSettings(cfg))
+	walletService := services.NewWalletService(dbConn, rc, logger, walletSettings(cfg), userService)
+	guardianService := services.NewGuardianService(dbConn, logger, userService, walletService)
+	limitService := services.NewLimitService(dbConn, logger, limitSettings(cfg), walletService)
+
+	gamingService := services.NewGamingService(dbConn, logger, gamingSettings(cfg), walletService)
+	kycService := services.NewKYCService(dbConn, logger, kycSettings(cfg), walletService)
+
+	// kept for Reload to update their settings
+	app.users, app.wallets, app.limits, app.gaming, app.kyc = userService, walletService, limitService, gamingService, kycService
+
+	walletStatusService := services.NewWalletStatusService(dbConn, logger, walletService)
+
+	migrationVersion, err := utils.LatestMigrationVersion(cfg.MigrationsDir)
+	if err != nil {
+		logger.Error("something went wrong reading the migrations version", zap.Error(err))
+		return err
+	}
+
+	healthService := services.NewHealthService(dbConn, rc, logger, services.HealthServiceSettings{
+		MigrationVersion: migrationVersion,
+		Timeout:          cfg.HealthCheckTimeout,
+	})
+
+	webhookService := services.NewWebhookService(dbConn, logger, services.WebhookServiceSettings{
+		Timeout:     cfg.WebhookTimeout,
+		Interval:    cfg.WebhookDeliveryInterval,
+		BatchSize:   cfg.OutboxBatchSize,
+		MaxAttempts: cfg.WebhookMaxAttempts,
+		BackoffBase: cfg.WebhookBackoffBase,
+		BackoffMax:  cfg.WebhookBackoffMax,
+		// receivers run locally in development
+		AllowInsecure: cfg.Profile == config.ProfileDev,
+	})
+
+	relay := services.NewOutboxRelay(dbConn, logger, services.OutboxRelaySettings{
+		Interval:  cfg.OutboxRelayInterval,
+		BatchSize: cfg.OutboxBatchSize,
+		Lease:     cfg.OutboxClaimLease,
+	}, events.Fanout{
+		events.NewRedisStreamPublisher(rc, cfg.EventsStream, cfg.EventsStreamMaxLen),
+		events.NewRedisPubSubPublisher(rc),
+		webhookService,
+	})
+
+	app.lifecycle.Worker("outbox relay", relay.Run)
+	app.lifecycle.Worker("webhook deliveries", webhookService.Run)
+
+	app.grpc = rpc.NewServer(walletService, userService, cfg.JWTSecret, cfg.IdempotencyTTL, logger)
+
+	doc, err := openapi.Load()
+	if err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+
+	validateRequests, err := middleware.ValidateRequests(doc)
+	if err != nil {
+		logger.Error("something went wrong routing the openapi spec", zap.Error(err))
+		return err
+	}
+
+	routeTimeouts, err := middleware.ParseRouteTimeouts(cfg.RouteTimeouts)
+	if err != nil {
+		logger.Error("something went wrong reading the route timeouts", zap.Error(err))
+		return err
+	}
+
+	r := gin.New()
+
+	r.Use(middleware.RequestID())
+	r.Use(middleware.Trace())
+	r.Use(middleware.AccessLog(logger))
+	r.Use(middleware.Metrics())
+	r.Use(middleware.Localize())
+	r.Use(middleware.Timeout(cfg.RequestTimeout, routeTimeouts))
+	r.Use(validateRequests)
+
+	// r.Use(gin.Middleware)
+	r.GET("/ping", func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"message": "pong",
+		})
+	})
+
+	handlers.NewHealthHandler(healthService).HealthRoutes(&r.RouterGroup)
+
+	deprecatedAt, err := time.Parse(time.DateOnly, cfg.LegacyRoutesDeprecatedAt)
+	if err != nil {
+		logger.Error("legacy routes deprecation date not yyyy-mm-dd", zap.Error(err))
+		return err
+	}
+
+	sunset, err := time.Parse(time.DateOnly, cfg.LegacyRoutesSunset)
+	if err != nil {
+		logger.Error("legacy routes sunset date not yyyy-mm-dd", zap.Error(err))
+		return err
+	}
+
+	// the streams and websockets are long lived, they're told to end when shutting down instead of holding the server
+	walletHandler := handlers.NewWalletHandler(walletService, cfg.JWTSecret, cfg.IdempotencyTTL)
+	socketHandler := handlers.NewSocketHandler(walletService, cfg.JWTSecret, cfg.IdempotencyTTL, logger)
+
+	app.lifecycle.OnShutdown("wallet streams", walletHandler.Shutdown)
+	app.lifecycle.OnShutdown("websockets", socketHandler.Shutdown)
+
+	v1 := []func(*gin.RouterGroup){
+		handlers.NewUserHandler(userService).UserRoutes,
+		walletHandler.WalletRoutes,
+		handlers.NewGuardianHandler(guardianService, cfg.JWTSecret).GuardianRoutes,
+		handlers.NewLimitHandler(limitService, cfg.JWTSecret).LimitRoutes,
+		handlers.NewGamingHandler(gamingService, cfg.JWTSecret).GamingRoutes,
+		handlers.NewKYCHandler(kycService, cfg.JWTSecret).KYCRoutes,
+		handlers.NewWalletStatusHandler(walletStatusService, cfg.JWTSecret).WalletStatusRoutes,
+		handlers.NewWebhookHandler(webhookService, cfg.JWTSecret).WebhookRoutes,
+		handlers.NewConfigHandler(app.Effective, cfg.JWTSecret).ConfigRoutes,
+		socketHandler.SocketRoutes,
+	}
+
+	// versions are mounted side by side, a handler whose behaviour changes gets a new entry in the versions after it while
+	// the others keep sharing theirs
+	versions := []apiVersion{
+		{name: api.V1, routes: v1},
+		{name: api.V2, routes: v1, middleware: []gin.HandlerFunc{middleware.LowerCaseIDs()}},
+	}
+
+	for _, version := range versions {
+		versionDoc, err := openapi.ForVersion(doc, version.name)
+		if err != nil {
+			logger.Error(err.Error())
+			return err
+		}
+
+		group := r.Group("/"+version.name, version.middleware...)
+		for _, routes := range version.routes {
+			routes(group)
+		}
+		handlers.NewOpenAPIHandler(versionDoc).OpenAPIRoutes(group)
+	}
+
+	// the unversioned routes are kept for the clients written before v1 until the sunset
+	v1Doc, err := openapi.ForVersion(doc, api.V1)
+	if err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+
+	legacy := r.Group("/", middleware.Deprecated(deprecatedAt, sunset, "/"+api.V1))
+	for _, routes := range v1 {
+		routes(legacy)
+	}
+	handlers.NewOpenAPIHandler(v1Doc).OpenAPIRoutes(legacy)
+
+	for _, route := range openapi.Undocumented(doc, r.Routes()) {
+		logger.Warn("route missing from the openapi spec", zap.String("route", route))
+	}
+
+	app.Router = r
+
+	return nil
+}
+
+// the settings of the services reloaded with the configuration are built the same way on start and on Reload
+
+func userSettings(cfg config.Configurations) services.UserServiceSettings {
+	return services.UserServiceSettings{
+		Port:          cfg.Port,
+		Hostname:      cfg.Host,
+		JWTSecret:     cfg.JWTSecret,
+		RefreshSecret: cfg.RefreshSecret,
+		RefreshExpiry: cfg.RefreshExpiry,
+	}
+}
+
+func walletSettings(cfg config.Configurations) services.WalletServiceSettings {
+	return services.WalletServiceSettings{
+		Port:              cfg.Port,
+		Hostname:          cfg.Host,
+		RedisCacheTimeout: cfg.RedisExpiry,
+		BypassCache:       !cfg.FeatureBalanceCache,
+	}
+}
+
+func limitSettings(cfg config.Configurations) services.LimitServiceSettings {
+	return services.LimitServiceSettings{
+		PerTransaction: cfg.LimitPerTransaction,
+		Daily:          cfg.LimitDaily,
+		Weekly:         cfg.LimitWeekly,
+		Monthly:        cfg.LimitMonthly,
+		PerMinute:      cfg.LimitPerMinute,
+	}
+}
+
+func gamingSettings(cfg config.Configurations) services.GamingServiceSettings {
+	return services.GamingServiceSettings{
+		LimitIncreaseDelay: cfg.LimitIncreaseDelay,
+	}
+}
+
+func kycSettings(cfg config.Configurations) services.KYCServiceSettings {
+	return services.KYCServiceSettings{
+		UnverifiedMaxBalance: cfg.KYCUnverifiedMaxBalance,
+		BasicMaxBalance:      cfg.KYCBasicMaxBalance,
+	}
+}
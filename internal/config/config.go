@@ -1,78 +1,233 @@
 package config
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
-func fallbackConfigs() {
-	viper.SetDefault("DB_CONNECTION_FORMAT", "%s:%s@tcp(%s:3306)/%s?charset=utf8mb4&parseTime=True&loc=Local&multiStatements=true")
-	viper.SetDefault("DB", "wallet")
-	viper.SetDefault("DB_USER", "alex")
-	viper.SetDefault("DB_PASSWORD", "alexsecret")
-	viper.SetDefault("DB_HOST", "localhost")
-	viper.SetDefault("MIGRATIONS_DIR", "/internal/migrations")
-	viper.SetDefault("PORT", 8080)
-	viper.SetDefault("MAX_CONNECTIONS", 100)
-	viper.SetDefault("MAX_IDLE_CONNECTIONS", 10)
-	viper.SetDefault("MAX_LIFETIME", 1)
-	viper.SetDefault("REDIS_ADDRESS", "localhost:6379")
-	viper.SetDefault("REDIS_PASSWORD", "")
-	viper.SetDefault("REDIS_DB", 0)
-	viper.SetDefault("REDIS_EXPIRY", 60)
-	viper.SetDefault("JWT_SECRET", "")
+const (
+	ProfileDev  = "dev"
+	ProfileTest = "test"
+	ProfileProd = "prod"
+
+	// the credentials of the docker-compose db, fine locally but refused in prod
+	defaultDBUser     = "alex"
+	defaultDBPassword = "alexsecret"
+)
+
+// dummyUsers are the users inserted by the migrations with their passwords in plain text, refused as admins in prod
+var dummyUsers = []string{"alexm1496", "johndoe14", "ssmith38"}
+
+// profileFiles are the env files read on top of the defaults for each profile, the environment overriding both
+var profileFiles = map[string]string{
+	ProfileDev:  "app",
+	ProfileTest: "app.test",
+	ProfileProd: "app.prod",
+}
+
+func fallbackConfigs(v *viper.Viper) {
+	v.SetDefault("APP_ENV", ProfileDev)
+	v.SetDefault("DB_CONNECTION_FORMAT", "%s:%s@tcp(%s:3306)/%s?charset=utf8mb4&parseTime=True&loc=Local&multiStatements=true")
+	v.SetDefault("DB", "wallet")
+	v.SetDefault("DB_USER", defaultDBUser)
+	v.SetDefault("DB_PASSWORD", defaultDBPassword)
+	v.SetDefault("DB_HOST", "localhost")
+	v.SetDefault("MIGRATIONS_DIR", "/internal/migrations")
+	v.SetDefault("PORT", 8080)
+	v.SetDefault("GRPC_PORT", 9090)
+	v.SetDefault("METRICS_PORT", 9100)
+	v.SetDefault("MAX_CONNECTIONS", 100)
+	v.SetDefault("MAX_IDLE_CONNECTIONS", 10)
+	v.SetDefault("MAX_LIFETIME", time.Hour)
+	v.SetDefault("REDIS_ADDRESS", "localhost:6379")
+	v.SetDefault("REDIS_PASSWORD", "")
+	v.SetDefault("REDIS_DB", 0)
+	v.SetDefault("REDIS_EXPIRY", time.Hour)
+	v.SetDefault("JWT_SECRET", "")
+	v.SetDefault("REFRESH_SECRET", "")
+	v.SetDefault("REFRESH_EXPIRY", 7*24*time.Hour)
+	v.SetDefault("ADMIN_USERNAMES", "")
+	v.SetDefault("IDEMPOTENCY_TTL", 24*time.Hour)
+	v.SetDefault("REQUEST_TIMEOUT", 10*time.Second)
+	v.SetDefault("ROUTE_TIMEOUTS", "GET /wallet/:walletid/stream=0")
+	v.SetDefault("HEALTH_CHECK_TIMEOUT", 2*time.Second)
+	v.SetDefault("SHUTDOWN_TIMEOUT", 25*time.Second)
+	v.SetDefault("LEGACY_ROUTES_DEPRECATED_AT", "2026-10-19")
+	v.SetDefault("LEGACY_ROUTES_SUNSET", "2027-04-19")
+	v.SetDefault("LIMIT_PER_TRANSACTION", 0)
+	v.SetDefault("LIMIT_DAILY", 0)
+	v.SetDefault("LIMIT_WEEKLY", 0)
+	v.SetDefault("LIMIT_MONTHLY", 0)
+	v.SetDefault("LIMIT_PER_MINUTE", 0)
+	v.SetDefault("LIMIT_INCREASE_DELAY", 24*time.Hour)
+	v.SetDefault("KYC_UNVERIFIED_MAX_BALANCE", 100000)
+	v.SetDefault("KYC_BASIC_MAX_BALANCE", 1000000)
+	v.SetDefault("EVENTS_STREAM", "wallet-events")
+	v.SetDefault("EVENTS_STREAM_MAX_LEN", 100000)
+	v.SetDefault("OUTBOX_RELAY_INTERVAL", time.Second)
+	v.SetDefault("OUTBOX_BATCH_SIZE", 100)
+	v.SetDefault("OUTBOX_CLAIM_LEASE", time.Minute)
+	v.SetDefault("WEBHOOK_TIMEOUT", 5*time.Second)
+	v.SetDefault("WEBHOOK_DELIVERY_INTERVAL", time.Second)
+	v.SetDefault("WEBHOOK_MAX_ATTEMPTS", 8)
+	v.SetDefault("WEBHOOK_BACKOFF_BASE", 30*time.Second)
+	v.SetDefault("WEBHOOK_BACKOFF_MAX", 6*time.Hour)
+	v.SetDefault("TRACING_EXPORTER", "none")
+	v.SetDefault("TRACING_ENDPOINT", "localhost:4317")
+	v.SetDefault("TRACING_INSECURE", true)
+	v.SetDefault("TRACING_SAMPLE_RATIO", 1)
+	v.SetDefault("SECRETS_FILE", "")
+	v.SetDefault("LOG_LEVEL", "info")
+	v.SetDefault("FEATURE_BALANCE_CACHE", true)
 }
 
-// Configurations app configs from env file, env params or fallback configs
+// Configurations app configs from env file, env params or fallback configs. The durations are written as "90s", "24h"...
 type Configurations struct {
-	DBConnectionFormat string `mapstructure:"DB_CONNECTION_FORMAT"`
-	DBName             string `mapstructure:"DB"`
-	DBUser             string `mapstructure:"DB_USER"`
-	DBPassword         string `mapstructure:"DB_PASSWORD"`
-	Host               string `mapstructure:"DB_HOST"`
-	MigrationsDir      string `mapstructure:"MIGRATIONS_DIR"`
-	Port               string `mapstructure:"PORT"`
-	MaxConnections     int    `mapstructure:"MAX_CONNECTIONS"`
-	MaxIdleConnections int    `mapstructure:"MAX_IDLE_CONNECTIONS"`
-	MaxLifetime        int    `mapstructure:"MAX_LIFETIME"`
-	RedisAddress       string `mapstructure:"REDIS_ADDRESS"`
-	RedisPassword      string `mapstructure:"REDIS_PASSWORD"`
-	RedisDB            int    `mapstructure:"REDIS_DB"`
-	RedisExpiry        int    `mapstructure:"REDIS_EXPIRY"`
-	JWTSecret          string `mapstructure:"JWT_SECRET"`
+	// dev, test or prod, picks the env file read and how strict the validation is
+	Profile            string        `mapstructure:"APP_ENV"`
+	DBConnectionFormat string        `mapstructure:"DB_CONNECTION_FORMAT"`
+	DBName             string        `mapstructure:"DB"`
+	DBUser             string        `mapstructure:"DB_USER"`
+	DBPassword         string        `mapstructure:"DB_PASSWORD"`
+	Host               string        `mapstructure:"DB_HOST"`
+	MigrationsDir      string        `mapstructure:"MIGRATIONS_DIR"`
+	Port               int           `mapstructure:"PORT"`
+	GRPCPort           int           `mapstructure:"GRPC_PORT"`
+	MetricsPort        int           `mapstructure:"METRICS_PORT"`
+	MaxConnections     int           `mapstructure:"MAX_CONNECTIONS"`
+	MaxIdleConnections int           `mapstructure:"MAX_IDLE_CONNECTIONS"`
+	MaxLifetime        time.Duration `mapstructure:"MAX_LIFETIME"`
+	RedisAddress       string        `mapstructure:"REDIS_ADDRESS"`
+	RedisPassword      string        `mapstructure:"REDIS_PASSWORD"`
+	RedisDB            int           `mapstructure:"REDIS_DB"`
+	RedisExpiry        time.Duration `mapstructure:"REDIS_EXPIRY"`
+	JWTSecret          string        `mapstructure:"JWT_SECRET"`
+	// refresh tokens are signed with their own secret and last REFRESH_EXPIRY
+	RefreshSecret string        `mapstructure:"REFRESH_SECRET"`
+	RefreshExpiry time.Duration `mapstructure:"REFRESH_EXPIRY"`
+	// comma separated usernames given the admin role on start, leaving one out later doesn't take the role back
+	AdminUsernames string `mapstructure:"ADMIN_USERNAMES"`
+	// how long the responses of requests sent with an Idempotency-Key are kept for replays
+	IdempotencyTTL time.Duration `mapstructure:"IDEMPOTENCY_TTL"`
+	// time before the work of a request is canceled, 0 disables it, and the routes with their own as a comma separated
+	// list of "METHOD /route=duration", the event stream must stay at 0
+	RequestTimeout time.Duration `mapstructure:"REQUEST_TIMEOUT"`
+	RouteTimeouts  string        `mapstructure:"ROUTE_TIMEOUTS"`
+	// time each dependency gets to answer the readiness checks
+	HealthCheckTimeout time.Duration `mapstructure:"HEALTH_CHECK_TIMEOUT"`
+	// time the requests in flight and the workers get to finish on SIGTERM, keep it below the orchestrator's grace period
+	ShutdownTimeout time.Duration `mapstructure:"SHUTDOWN_TIMEOUT"`
+	// dates (yyyy-mm-dd) the unversioned routes were deprecated and will be removed, sent in their Deprecation and Sunset headers
+	LegacyRoutesDeprecatedAt string `mapstructure:"LEGACY_ROUTES_DEPRECATED_AT"`
+	LegacyRoutesSunset       string `mapstructure:"LEGACY_ROUTES_SUNSET"`
+	// global limits in 100s applied to credits and debits for the checks no limit saved in the db sets, 0 disables them
+	LimitPerTransaction int `mapstructure:"LIMIT_PER_TRANSACTION"`
+	LimitDaily          int `mapstructure:"LIMIT_DAILY"`
+	LimitWeekly         int `mapstructure:"LIMIT_WEEKLY"`
+	LimitMonthly        int `mapstructure:"LIMIT_MONTHLY"`
+	LimitPerMinute      int `mapstructure:"LIMIT_PER_MINUTE"`
+	// time before a user's increase of their deposit or loss limit applies
+	LimitIncreaseDelay time.Duration `mapstructure:"LIMIT_INCREASE_DELAY"`
+	// maximum balance in 100s, summed across their wallets, of the users below the full KYC tier, 0 disables the cap
+	KYCUnverifiedMaxBalance int `mapstructure:"KYC_UNVERIFIED_MAX_BALANCE"`
+	KYCBasicMaxBalance      int `mapstructure:"KYC_BASIC_MAX_BALANCE"`
+	// redis stream the wallet events are published to, trimmed around the max length
+	EventsStream       string `mapstructure:"EVENTS_STREAM"`
+	EventsStreamMaxLen int64  `mapstructure:"EVENTS_STREAM_MAX_LEN"`
+	// time between polls of the outbox, events sent per poll and how long a relay has to publish the events it claimed
+	// before another one can take them
+	OutboxRelayInterval time.Duration `mapstructure:"OUTBOX_RELAY_INTERVAL"`
+	OutboxBatchSize     int           `mapstructure:"OUTBOX_BATCH_SIZE"`
+	OutboxClaimLease    time.Duration `mapstructure:"OUTBOX_CLAIM_LEASE"`
+	// webhook request timeout and poll interval, attempts per delivery, time before the first retry and the longest
+	// time between retries
+	WebhookTimeout          time.Duration `mapstructure:"WEBHOOK_TIMEOUT"`
+	WebhookDeliveryInterval time.Duration `mapstructure:"WEBHOOK_DELIVERY_INTERVAL"`
+	WebhookMaxAttempts      int           `mapstructure:"WEBHOOK_MAX_ATTEMPTS"`
+	WebhookBackoffBase      time.Duration `mapstructure:"WEBHOOK_BACKOFF_BASE"`
+	WebhookBackoffMax       time.Duration `mapstructure:"WEBHOOK_BACKOFF_MAX"`
+	// where the spans are sent, otlp, stdout or none, the otlp collector's grpc host:port and the share of traces kept
+	TracingExporter    string  `mapstructure:"TRACING_EXPORTER"`
+	TracingEndpoint    string  `mapstructure:"TRACING_ENDPOINT"`
+	TracingInsecure    bool    `mapstructure:"TRACING_INSECURE"`
+	TracingSampleRatio float64 `mapstructure:"TRACING_SAMPLE_RATIO"`
+	// env file sealed with SECRETS_KEY holding the secrets, which can also be read from the files named by their _FILE
+	// variant, e.g. JWT_SECRET_FILE
+	SecretsFile string `mapstructure:"SECRETS_FILE"`
+	// debug, info, warn or error
+	LogLevel string `mapstructure:"LOG_LEVEL"`
+	// feature flags, the balances are read from redis before the db, turned off to serve them from the db while redis
+	// misbehaves
+	FeatureBalanceCache bool `mapstructure:"FEATURE_BALANCE_CACHE"`
 }
 
-var WalletConfigs Configurations
+// LoadConfig reads the configuration in layers, the fallback configs, then the env file of the APP_ENV profile in path
+// (app.env for dev, app.test.env, app.prod.env), then the environment variables. The secrets are then taken from the
+// first provider having them, the _FILE variants, the SECRETS_FILE and the providers passed, in that order. It isn't
+// validated, see Validate.
+func LoadConfig(path string, providers ...SecretProvider) (config Configurations, err error) {
+	v := viper.New()
+	fallbackConfigs(v)
+	v.AutomaticEnv()
 
-// initConfig reads in config file and ENV variables if set.
-func init() {
+	profile := v.GetString("APP_ENV")
+	file, ok := profileFiles[profile]
+	if !ok {
+		return config, fmt.Errorf("APP_ENV %q isn't one of %s, %s or %s", profile, ProfileDev, ProfileTest, ProfileProd)
+	}
 
-	var err error
+	v.AddConfigPath(path)
+	v.SetConfigName(file)
+	v.SetConfigType("env")
 
-	WalletConfigs, err = LoadConfig(".")
-	if err != nil {
-		log.Fatalf("something went wrong setting up configs: %+v", err)
+	if err = v.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if !errors.As(err, &notFound) {
+			return
+		}
 	}
-}
 
-// LoadConfig reads configuration from file or environment variables.
-func LoadConfig(path string) (config Configurations, err error) {
-	viper.AddConfigPath(path)
-	viper.SetConfigName("app")
-	viper.SetConfigType("env")
+	if err = v.Unmarshal(&config); err != nil {
+		return
+	}
 
-	viper.AutomaticEnv()
+	files := FileSecrets{lookup: v.GetString}
+	secretProviders := []SecretProvider{files}
 
-	if err = viper.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			fallbackConfigs()
-		} else {
-			return
+	if config.SecretsFile != "" {
+		// the key of the sealed file is a secret too, best mounted as a file
+		key, ok, err := files.Secret("SECRETS_KEY")
+		if err != nil {
+			return config, err
+		}
+		if !ok {
+			key = v.GetString("SECRETS_KEY")
+		}
+
+		sealed, err := NewEncryptedFileSecrets(config.SecretsFile, key)
+		if err != nil {
+			return config, fmt.Errorf("SECRETS_FILE: %w", err)
 		}
+		secretProviders = append(secretProviders, sealed)
 	}
 
-	err = viper.Unmarshal(&config)
+	err = config.resolveSecrets(append(secretProviders, providers...))
 
 	return
 }
+
+// Defaults returns the fallback configs alone, without reading any file or the environment, for the tests to start from
+func Defaults() Configurations {
+	v := viper.New()
+	fallbackConfigs(v)
+
+	var config Configurations
+	if err := v.Unmarshal(&config); err != nil {
+		panic(fmt.Sprintf("the fallback configs don't decode: %v", err))
+	}
+
+	return config
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"reflect"
+	"time"
+)
+
+// redacted replaces the secrets set when the configuration is shown
+const redacted = "[redacted]"
+
+// reloadable are the settings applied to the running app when the configuration is reloaded, the others are read once
+// by the servers, pools and workers and need a restart
+var reloadable = map[string]bool{
+	"LOG_LEVEL":                  true,
+	"REDIS_EXPIRY":               true,
+	"REFRESH_EXPIRY":             true,
+	"LIMIT_PER_TRANSACTION":      true,
+	"LIMIT_DAILY":                true,
+	"LIMIT_WEEKLY":               true,
+	"LIMIT_MONTHLY":              true,
+	"LIMIT_PER_MINUTE":           true,
+	"LIMIT_INCREASE_DELAY":       true,
+	"KYC_UNVERIFIED_MAX_BALANCE": true,
+	"KYC_BASIC_MAX_BALANCE":      true,
+	"FEATURE_BALANCE_CACHE":      true,
+}
+
+// Reload returns the configuration with the reloadable settings of next, along with the other settings next changes
+// which wait for a restart
+func (config Configurations) Reload(next Configurations) (Configurations, []string) {
+	current, updated := reflect.ValueOf(&config).Elem(), reflect.ValueOf(next)
+
+	var restart []string
+	for i := 0; i < current.NumField(); i++ {
+		key := current.Type().Field(i).Tag.Get("mapstructure")
+
+		switch {
+		case reloadable[key]:
+			current.Field(i).Set(updated.Field(i))
+		case !reflect.DeepEqual(current.Field(i).Interface(), updated.Field(i).Interface()):
+			restart = append(restart, key)
+		}
+	}
+
+	return config, restart
+}
+
+// Redacted returns the settings by their variable, the durations written the way they're configured and the secrets
+// which are set replaced, for showing the configuration
+func (config Configurations) Redacted() map[string]any {
+	secrets := make(map[string]bool)
+	for _, secret := range config.secrets() {
+		secrets[secret.key] = *secret.value != ""
+	}
+
+	fields := reflect.ValueOf(config)
+	settings := make(map[string]any, fields.NumField())
+	for i := 0; i < fields.NumField(); i++ {
+		key := fields.Type().Field(i).Tag.Get("mapstructure")
+
+		switch value := fields.Field(i).Interface().(type) {
+		case time.Duration:
+			settings[key] = value.String()
+		default:
+			settings[key] = value
+		}
+
+		if secrets[key] {
+			settings[key] = redacted
+		}
+	}
+
+	return settings
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type reloadTestCase struct {
+	Name            string
+	Change          func(config *Configurations)
+	Expected        func(config *Configurations)
+	ExpectedRestart []string
+}
+
+func TestReload(t *testing.T) {
+	testCases := []reloadTestCase{
+		{
+			Name:   "Nothing changed",
+			Change: func(config *Configurations) {},
+		},
+		{
+			Name: "Reloadable settings are applied",
+			Change: func(config *Configurations) {
+				config.LimitDaily = 50000
+				config.LimitIncreaseDelay = time.Hour
+				config.KYCBasicMaxBalance = 500000
+				config.RedisExpiry = 5 * time.Minute
+				config.LogLevel = "debug"
+				config.FeatureBalanceCache = false
+			},
+			Expected: func(config *Configurations) {
+				require.Equal(t, 50000, config.LimitDaily)
+				require.Equal(t, time.Hour, config.LimitIncreaseDelay)
+				require.Equal(t, 500000, config.KYCBasicMaxBalance)
+				require.Equal(t, 5*time.Minute, config.RedisExpiry)
+				require.Equal(t, "debug", config.LogLevel)
+				require.False(t, config.FeatureBalanceCache)
+			},
+		},
+		{
+			Name: "Other settings wait for a restart",
+			Change: func(config *Configurations) {
+				config.Port = 8081
+				config.JWTSecret = "another-secret"
+				config.ShutdownTimeout = time.Minute
+			},
+			Expected: func(config *Configurations) {
+				require.Equal(t, 8080, config.Port)
+				require.Equal(t, "dev-only-access-secret", config.JWTSecret)
+				require.Equal(t, 25*time.Second, config.ShutdownTimeout)
+			},
+			ExpectedRestart: []string{"PORT", "JWT_SECRET", "SHUTDOWN_TIMEOUT"},
+		},
+		{
+			Name: "Both at once",
+			Change: func(config *Configurations) {
+				config.LimitWeekly = 70000
+				config.WebhookMaxAttempts = 3
+			},
+			Expected: func(config *Configurations) {
+				require.Equal(t, 70000, config.LimitWeekly)
+				require.Equal(t, 8, config.WebhookMaxAttempts)
+			},
+			ExpectedRestart: []string{"WEBHOOK_MAX_ATTEMPTS"},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			current := validConfig()
+			next := validConfig()
+			test.Change(&next)
+
+			reloaded, restart := current.Reload(next)
+
+			require.ElementsMatch(t, test.ExpectedRestart, restart)
+			if test.Expected != nil {
+				test.Expected(&reloaded)
+			}
+		})
+	}
+}
+
+func TestReloadableKeys(t *testing.T) {
+	keys := make(map[string]bool)
+	for key := range Defaults().Redacted() {
+		keys[key] = true
+	}
+
+	// a typo in the list would silently make the setting restart only
+	for key := range reloadable {
+		require.True(t, keys[key], "%s isn't a setting", key)
+	}
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// SecretProvider looks up the secrets of the configuration somewhere safer than app.env, e.g. the files docker and
+// kubernetes mount them in. ok is false when the provider doesn't have the secret, letting the next one answer.
+type SecretProvider interface {
+	Secret(name string) (value string, ok bool, err error)
+}
+
+// FileSecrets reads each secret from the file named by its _FILE variant, e.g. JWT_SECRET_FILE=/run/secrets/jwt_secret.
+// lookup reads the variants, from the env file or the environment.
+type FileSecrets struct {
+	lookup func(key string) string
+}
+
+func (provider FileSecrets) Secret(name string) (string, bool, error) {
+	path := provider.lookup(name + "_FILE")
+	if path == "" {
+		return "", false, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+	}
+
+	// editors and `echo` leave a trailing newline which isn't part of the secret
+	return strings.TrimRight(string(content), "\r\n"), true, nil
+}
+
+// EncryptedFileSecrets holds the secrets of an env file sealed with SealSecrets, for keeping them on disk locally without
+// writing them in plain text
+type EncryptedFileSecrets struct {
+	secrets *viper.Viper
+}
+
+// NewEncryptedFileSecrets opens the sealed file with the base64 AES-256 key
+func NewEncryptedFileSecrets(path, key string) (*EncryptedFileSecrets, error) {
+	sealed, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := OpenSecrets(key, sealed)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+
+	secrets := viper.New()
+	secrets.SetConfigType("env")
+	if err = secrets.ReadConfig(bytes.NewReader(plain)); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	return &EncryptedFileSecrets{secrets: secrets}, nil
+}
+
+func (provider *EncryptedFileSecrets) Secret(name string) (string, bool, error) {
+	if !provider.secrets.IsSet(name) {
+		return "", false, nil
+	}
+
+	return provider.secrets.GetString(name), true, nil
+}
+
+// SealSecrets encrypts the env file's content with AES-256-GCM, returning the nonce and the ciphertext in base64
+func SealSecrets(key string, plain []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plain, nil)
+
+	return []byte(base64.StdEncoding.EncodeToString(sealed) + "\n"), nil
+}
+
+// OpenSecrets decrypts what SealSecrets returned, failing if it was sealed with another key or changed since
+func OpenSecrets(key string, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sealed)))
+	if err != nil {
+		return nil, fmt.Errorf("not base64: %w", err)
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("too short to be sealed secrets")
+	}
+
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("sealed with another key or changed since")
+	}
+
+	return plain, nil
+}
+
+// NewSecretsKey returns a random key for SealSecrets, in base64
+func NewSecretsKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+func newGCM(key string) (cipher.AEAD, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(raw) != 32 {
+		return nil, errors.New("the secrets key must be 32 bytes in base64")
+	}
+
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// resolveSecrets replaces the secrets of the configuration with the ones of the first provider having them, the plain
+// values are only kept for the secrets no provider has
+func (config *Configurations) resolveSecrets(providers []SecretProvider) error {
+	var errs []error
+	for _, secret := range config.secrets() {
+		for _, provider := range providers {
+			value, ok, err := provider.Secret(secret.key)
+			if err != nil {
+				errs = append(errs, err)
+				break
+			}
+			if ok {
+				*secret.value = value
+				break
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// secrets are the settings the SecretProviders can answer, redacted wherever the configuration is shown
+func (config *Configurations) secrets() []setting[*string] {
+	return []setting[*string]{
+		{"DB_PASSWORD", &config.DBPassword},
+		{"REDIS_PASSWORD", &config.RedisPassword},
+		{"JWT_SECRET", &config.JWTSecret},
+		{"REFRESH_SECRET", &config.RefreshSecret},
+	}
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type openSecretsTestCase struct {
+	Name          string
+	Key           string
+	Sealed        func(sealed []byte) []byte
+	ExpectedError string
+}
+
+func TestOpenSecrets(t *testing.T) {
+	key, err := NewSecretsKey()
+	require.NoError(t, err)
+	otherKey, err := NewSecretsKey()
+	require.NoError(t, err)
+
+	plain := []byte("JWT_SECRET=sealed-access-secret\n")
+	sealed, err := SealSecrets(key, plain)
+	require.NoError(t, err)
+
+	testCases := []openSecretsTestCase{
+		{
+			Name:   "Opens with the key it was sealed with",
+			Key:    key,
+			Sealed: func(sealed []byte) []byte { return sealed },
+		},
+		{
+			Name:          "Another key",
+			Key:           otherKey,
+			Sealed:        func(sealed []byte) []byte { return sealed },
+			ExpectedError: "sealed with another key or changed since",
+		},
+		{
+			Name: "Changed since sealed",
+			Key:  key,
+			Sealed: func(sealed []byte) []byte {
+				data, _ := base64.StdEncoding.DecodeString(string(sealed[:len(sealed)-1]))
+				data[len(data)-1] ^= 1
+				return []byte(base64.StdEncoding.EncodeToString(data))
+			},
+			ExpectedError: "sealed with another key or changed since",
+		},
+		{
+			Name:          "Not base64",
+			Key:           key,
+			Sealed:        func(sealed []byte) []byte { return []byte("JWT_SECRET=plain") },
+			ExpectedError: "not base64",
+		},
+		{
+			Name:          "Too short",
+			Key:           key,
+			Sealed:        func(sealed []byte) []byte { return []byte(base64.StdEncoding.EncodeToString([]byte("short"))) },
+			ExpectedError: "too short to be sealed secrets",
+		},
+		{
+			Name:          "Key that isn't 32 bytes",
+			Key:           base64.StdEncoding.EncodeToString([]byte("short key")),
+			Sealed:        func(sealed []byte) []byte { return sealed },
+			ExpectedError: "the secrets key must be 32 bytes in base64",
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			opened, err := OpenSecrets(test.Key, test.Sealed(sealed))
+
+			if test.ExpectedError == "" {
+				require.NoError(t, err)
+				require.Equal(t, plain, opened)
+				return
+			}
+
+			require.ErrorContains(t, err, test.ExpectedError)
+		})
+	}
+}
+
+func TestEncryptedFileSecrets(t *testing.T) {
+	key, err := NewSecretsKey()
+	require.NoError(t, err)
+	otherKey, err := NewSecretsKey()
+	require.NoError(t, err)
+
+	sealed, err := SealSecrets(key, []byte("JWT_SECRET=sealed-access-secret\n"))
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "secrets.env.sealed")
+	require.NoError(t, os.WriteFile(path, sealed, 0o600))
+
+	t.Run("Secrets in the file answer, the others are left to the next provider", func(t *testing.T) {
+		provider, err := NewEncryptedFileSecrets(path, key)
+		require.NoError(t, err)
+
+		value, ok, err := provider.Secret("JWT_SECRET")
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, "sealed-access-secret", value)
+
+		_, ok, err = provider.Secret("REFRESH_SECRET")
+		require.NoError(t, err)
+		require.False(t, ok)
+	})
+
+	t.Run("The wrong key names the file", func(t *testing.T) {
+		_, err := NewEncryptedFileSecrets(path, otherKey)
+		require.ErrorContains(t, err, "opening "+path+": sealed with another key or changed since")
+	})
+
+	t.Run("A missing file fails", func(t *testing.T) {
+		_, err := NewEncryptedFileSecrets(filepath.Join(t.TempDir(), "missing"), key)
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestFileSecrets(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "jwt_secret"), []byte("file-access-secret\n"), 0o600))
+
+	files := map[string]string{
+		"JWT_SECRET_FILE":     filepath.Join(dir, "jwt_secret"),
+		"REFRESH_SECRET_FILE": filepath.Join(dir, "missing"),
+	}
+	provider := FileSecrets{lookup: func(key string) string { return files[key] }}
+
+	value, ok, err := provider.Secret("JWT_SECRET")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "file-access-secret", value)
+
+	_, _, err = provider.Secret("REFRESH_SECRET")
+	require.ErrorContains(t, err, "REFRESH_SECRET_FILE")
+
+	_, ok, err = provider.Secret("DB_PASSWORD")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// minSecretLength is the shortest JWT secret accepted in prod, 256 bits for HS256
+const minSecretLength = 32
+
+// maxWebhookAttempts bounds how long a failing receiver keeps being retried
+const maxWebhookAttempts = 20
+
+// Validate checks the configuration before anything is started, returning every problem found at once so a deploy
+// isn't fixed one variable at a time. In prod the insecure defaults meant for running locally are refused too.
+func (config Configurations) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(config.JWTSecret != "", "JWT_SECRET must be set")
+	check(config.RefreshSecret != "", "REFRESH_SECRET must be set")
+	// with the same secret a refresh token's signature is valid for an access token
+	check(config.JWTSecret == "" || config.JWTSecret != config.RefreshSecret, "JWT_SECRET and REFRESH_SECRET must differ")
+	check(config.DBName != "", "DB must be set")
+	check(config.Host != "", "DB_HOST must be set")
+	check(config.MigrationsDir != "", "MIGRATIONS_DIR must be set")
+	check(config.RedisAddress != "", "REDIS_ADDRESS must be set")
+	check(config.EventsStream != "", "EVENTS_STREAM must be set")
+
+	check(validPort(config.Port), "PORT %d isn't a port", config.Port)
+	check(validPort(config.GRPCPort), "GRPC_PORT %d isn't a port", config.GRPCPort)
+	check(validPort(config.MetricsPort), "METRICS_PORT %d isn't a port", config.MetricsPort)
+	check(config.Port != config.GRPCPort, "PORT and GRPC_PORT are both %d", config.Port)
+	check(config.MetricsPort != config.Port && config.MetricsPort != config.GRPCPort, "METRICS_PORT %d is taken by PORT or GRPC_PORT", config.MetricsPort)
+
+	check(config.MaxConnections > 0, "MAX_CONNECTIONS must be positive")
+	check(config.MaxIdleConnections >= 0 && config.MaxIdleConnections <= config.MaxConnections,
+		"MAX_IDLE_CONNECTIONS must be between 0 and MAX_CONNECTIONS")
+	check(config.RedisDB >= 0, "REDIS_DB can't be negative")
+	check(config.OutboxBatchSize > 0, "OUTBOX_BATCH_SIZE must be positive")
+	check(config.WebhookMaxAttempts > 0 && config.WebhookMaxAttempts <= maxWebhookAttempts,
+		"WEBHOOK_MAX_ATTEMPTS must be between 1 and %d", maxWebhookAttempts)
+	check(config.EventsStreamMaxLen >= 0, "EVENTS_STREAM_MAX_LEN can't be negative")
+
+	limits := []setting[int]{
+		{"LIMIT_PER_TRANSACTION", config.LimitPerTransaction},
+		{"LIMIT_DAILY", config.LimitDaily},
+		{"LIMIT_WEEKLY", config.LimitWeekly},
+		{"LIMIT_MONTHLY", config.LimitMonthly},
+		{"LIMIT_PER_MINUTE", config.LimitPerMinute},
+		{"KYC_UNVERIFIED_MAX_BALANCE", config.KYCUnverifiedMaxBalance},
+		{"KYC_BASIC_MAX_BALANCE", config.KYCBasicMaxBalance},
+	}
+	for _, limit := range limits {
+		check(limit.value >= 0, "%s can't be negative, 0 disables it", limit.key)
+	}
+
+	// these can't be 0, a ticker or a timeout of 0 would panic or fail everything
+	durations := []setting[time.Duration]{
+		{"MAX_LIFETIME", config.MaxLifetime},
+		{"REDIS_EXPIRY", config.RedisExpiry},
+		{"REFRESH_EXPIRY", config.RefreshExpiry},
+		{"IDEMPOTENCY_TTL", config.IdempotencyTTL},
+		{"HEALTH_CHECK_TIMEOUT", config.HealthCheckTimeout},
+		{"SHUTDOWN_TIMEOUT", config.ShutdownTimeout},
+		{"OUTBOX_RELAY_INTERVAL", config.OutboxRelayInterval},
+		{"OUTBOX_CLAIM_LEASE", config.OutboxClaimLease},
+		{"WEBHOOK_TIMEOUT", config.WebhookTimeout},
+		{"WEBHOOK_DELIVERY_INTERVAL", config.WebhookDeliveryInterval},
+		{"WEBHOOK_BACKOFF_BASE", config.WebhookBackoffBase},
+		{"WEBHOOK_BACKOFF_MAX", config.WebhookBackoffMax},
+	}
+	for _, duration := range durations {
+		check(duration.value > 0, "%s must be a positive duration, e.g. 30s", duration.key)
+	}
+	check(config.WebhookBackoffMax >= config.WebhookBackoffBase, "WEBHOOK_BACKOFF_MAX can't be below WEBHOOK_BACKOFF_BASE")
+	check(config.RequestTimeout >= 0, "REQUEST_TIMEOUT can't be negative, 0 disables it")
+	check(config.LimitIncreaseDelay >= 0, "LIMIT_INCREASE_DELAY can't be negative")
+
+	switch config.TracingExporter {
+	case "none", "otlp", "stdout":
+	default:
+		errs = append(errs, fmt.Errorf("TRACING_EXPORTER %q isn't one of none, otlp or stdout", config.TracingExporter))
+	}
+	check(config.TracingSampleRatio >= 0 && config.TracingSampleRatio <= 1, "TRACING_SAMPLE_RATIO must be between 0 and 1")
+
+	_, err := zapcore.ParseLevel(config.LogLevel)
+	check(err == nil, "LOG_LEVEL %q isn't one of debug, info, warn or error", config.LogLevel)
+
+	deprecatedAt, err := time.Parse(time.DateOnly, config.LegacyRoutesDeprecatedAt)
+	check(err == nil, "LEGACY_ROUTES_DEPRECATED_AT %q isn't yyyy-mm-dd", config.LegacyRoutesDeprecatedAt)
+	sunset, err := time.Parse(time.DateOnly, config.LegacyRoutesSunset)
+	check(err == nil, "LEGACY_ROUTES_SUNSET %q isn't yyyy-mm-dd", config.LegacyRoutesSunset)
+	check(!sunset.Before(deprecatedAt), "LEGACY_ROUTES_SUNSET is before LEGACY_ROUTES_DEPRECATED_AT")
+
+	if config.Profile == ProfileProd {
+		check(len(config.JWTSecret) >= minSecretLength, "JWT_SECRET must be at least %d characters in prod", minSecretLength)
+		check(len(config.RefreshSecret) >= minSecretLength, "REFRESH_SECRET must be at least %d characters in prod", minSecretLength)
+		check(config.DBPassword != "" && config.DBPassword != defaultDBPassword, "DB_PASSWORD must be set to a real password in prod")
+		for _, username := range strings.Split(config.AdminUsernames, ",") {
+			username = strings.TrimSpace(username)
+			check(!slices.Contains(dummyUsers, username), "ADMIN_USERNAMES can't name the dummy user %s in prod", username)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+// setting is a value checked along with the variable it's read from, listed in order so the errors always are
+type setting[V any] struct {
+	key   string
+	value V
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type validateTestCase struct {
+	Name           string
+	Change         func(config *Configurations)
+	ExpectedErrors []string
+}
+
+// validConfig is the dev defaults with the secrets app.env sets
+func validConfig() Configurations {
+	config := Defaults()
+	config.JWTSecret = "dev-only-access-secret"
+	config.RefreshSecret = "dev-only-refresh-secret"
+
+	return config
+}
+
+func TestValidate(t *testing.T) {
+	prodSecret := strings.Repeat("a", minSecretLength)
+
+	testCases := []validateTestCase{
+		{
+			Name:   "Dev defaults with secrets are valid",
+			Change: func(config *Configurations) {},
+		},
+		{
+			Name: "Missing secrets",
+			Change: func(config *Configurations) {
+				config.JWTSecret, config.RefreshSecret = "", ""
+			},
+			ExpectedErrors: []string{"JWT_SECRET must be set", "REFRESH_SECRET must be set"},
+		},
+		{
+			Name: "Same secrets fail in dev",
+			Change: func(config *Configurations) {
+				config.RefreshSecret = config.JWTSecret
+			},
+			ExpectedErrors: []string{"JWT_SECRET and REFRESH_SECRET must differ"},
+		},
+		{
+			Name: "Same secrets fail in test",
+			Change: func(config *Configurations) {
+				config.Profile = ProfileTest
+				config.RefreshSecret = config.JWTSecret
+			},
+			ExpectedErrors: []string{"JWT_SECRET and REFRESH_SECRET must differ"},
+		},
+		{
+			Name: "Prod refuses the local defaults",
+			Change: func(config *Configurations) {
+				config.Profile = ProfileProd
+			},
+			ExpectedErrors: []string{
+				"JWT_SECRET must be at least 32 characters in prod",
+				"REFRESH_SECRET must be at least 32 characters in prod",
+				"DB_PASSWORD must be set to a real password in prod",
+			},
+		},
+		{
+			Name: "Prod refuses the dummy users as admins",
+			Change: func(config *Configurations) {
+				config.Profile = ProfileProd
+				config.JWTSecret, config.RefreshSecret = prodSecret, prodSecret+"b"
+				config.DBPassword = "a-real-password"
+				config.AdminUsernames = "ops-admin, alexm1496"
+			},
+			ExpectedErrors: []string{"ADMIN_USERNAMES can't name the dummy user alexm1496 in prod"},
+		},
+		{
+			Name: "Prod with real secrets is valid",
+			Change: func(config *Configurations) {
+				config.Profile = ProfileProd
+				config.JWTSecret, config.RefreshSecret = prodSecret, prodSecret+"b"
+				config.DBPassword = "a-real-password"
+				config.AdminUsernames = "ops-admin"
+			},
+		},
+		{
+			Name: "Ports",
+			Change: func(config *Configurations) {
+				config.Port, config.GRPCPort, config.MetricsPort = 70000, 70000, 70000
+			},
+			ExpectedErrors: []string{
+				"PORT 70000 isn't a port",
+				"GRPC_PORT 70000 isn't a port",
+				"METRICS_PORT 70000 isn't a port",
+				"PORT and GRPC_PORT are both 70000",
+				"METRICS_PORT 70000 is taken by PORT or GRPC_PORT",
+			},
+		},
+		{
+			Name: "Negative limits and zero durations",
+			Change: func(config *Configurations) {
+				config.LimitDaily = -1
+				config.KYCBasicMaxBalance = -1
+				config.ShutdownTimeout = 0
+				config.RequestTimeout = -time.Second
+			},
+			ExpectedErrors: []string{
+				"LIMIT_DAILY can't be negative",
+				"KYC_BASIC_MAX_BALANCE can't be negative",
+				"SHUTDOWN_TIMEOUT must be a positive duration",
+				"REQUEST_TIMEOUT can't be negative",
+			},
+		},
+		{
+			Name: "Webhook retries",
+			Change: func(config *Configurations) {
+				config.WebhookMaxAttempts = 100
+				config.WebhookBackoffMax = time.Second
+			},
+			ExpectedErrors: []string{
+				"WEBHOOK_MAX_ATTEMPTS must be between 1 and 20",
+				"WEBHOOK_BACKOFF_MAX can't be below WEBHOOK_BACKOFF_BASE",
+			},
+		},
+		{
+			Name: "Unknown values",
+			Change: func(config *Configurations) {
+				config.TracingExporter = "jaeger"
+				config.LogLevel = "verbose"
+				config.TracingSampleRatio = 2
+			},
+			ExpectedErrors: []string{
+				`TRACING_EXPORTER "jaeger" isn't one of none, otlp or stdout`,
+				"TRACING_SAMPLE_RATIO must be between 0 and 1",
+				`LOG_LEVEL "verbose" isn't one of debug, info, warn or error`,
+			},
+		},
+		{
+			Name: "Sunset before the deprecation",
+			Change: func(config *Configurations) {
+				config.LegacyRoutesSunset = "2026-01-01"
+			},
+			ExpectedErrors: []string{"LEGACY_ROUTES_SUNSET is before LEGACY_ROUTES_DEPRECATED_AT"},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			config := validConfig()
+			test.Change(&config)
+
+			err := config.Validate()
+
+			if len(test.ExpectedErrors) == 0 {
+				require.NoError(t, err)
+				return
+			}
+
+			require.Error(t, err)
+			problems := strings.Split(err.Error(), "\n")
+			require.Len(t, problems, len(test.ExpectedErrors), err.Error())
+			for _, expected := range test.ExpectedErrors {
+				require.Contains(t, err.Error(), expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// reloadDelay lets an editor or kubernetes finish writing the env files before they're read
+const reloadDelay = 200 * time.Millisecond
+
+// Watcher reads the configuration again when an env file of its directory changes or the process gets a SIGHUP
+type Watcher struct {
+	path      string
+	providers []SecretProvider
+	logger    *zap.Logger
+}
+
+// NewWatcher watches the env files in path, loaded like LoadConfig with the providers
+func NewWatcher(path string, logger *zap.Logger, providers ...SecretProvider) *Watcher {
+	return &Watcher{
+		path:      path,
+		providers: providers,
+		logger:    logger,
+	}
+}
+
+// Run hands every valid configuration read to reload until the context is done, on the env file changes and the
+// signals of hangup. The caller registers hangup for SIGHUP early, before anything is served, since the default action
+// of a SIGHUP arriving before Run is to kill the process. An invalid configuration is logged and skipped, a typo in the
+// env file doesn't reach the running app.
+func (watcher *Watcher) Run(ctx context.Context, hangup <-chan os.Signal, reload func(Configurations)) {
+	// without the file events the configuration is still reloaded on SIGHUP
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	if files, err := watcher.watchFiles(); err != nil {
+		watcher.logger.Warn("something went wrong watching the env files, reloading on SIGHUP only", zap.Error(err))
+	} else {
+		defer files.Close()
+		events, errs = files.Events, files.Errors
+	}
+
+	var changed <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			watcher.reload(reload, "SIGHUP")
+		case event := <-events:
+			if watched(event) {
+				changed = time.After(reloadDelay)
+			}
+		case <-changed:
+			changed = nil
+			watcher.reload(reload, "env file changed")
+		case err := <-errs:
+			watcher.logger.Warn("something went wrong watching the env files", zap.Error(err))
+		}
+	}
+}
+
+// watchFiles watches the directory rather than the env files, editors and kubernetes replace them instead of writing
+func (watcher *Watcher) watchFiles() (*fsnotify.Watcher, error) {
+	files, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = files.Add(watcher.path); err != nil {
+		_ = files.Close()
+		return nil, err
+	}
+
+	return files, nil
+}
+
+func (watcher *Watcher) reload(reload func(Configurations), reason string) {
+	logger := watcher.logger.With(zap.String("reason", reason))
+
+	config, err := LoadConfig(watcher.path, watcher.providers...)
+	if err == nil {
+		err = config.Validate()
+	}
+	if err != nil {
+		logger.Error("❌ configuration not reloaded", zap.Error(err))
+		return
+	}
+
+	logger.Info("🔄 reloading the configuration")
+	reload(config)
+}
+
+// watched says whether the event changes an env file, kubernetes swaps its ..data link to update the mounted ones
+func watched(event fsnotify.Event) bool {
+	if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) && !event.Has(fsnotify.Rename) {
+		return false
+	}
+
+	name := filepath.Base(event.Name)
+
+	return strings.HasSuffix(name, ".env") || name == "..data"
+}
@@ -0,0 +1,35 @@
+package events
+
+import (
+	"context"
+	"sync"
+
+	"wallet-api/internal/pkg"
+)
+
+// MemoryPublisher keeps the published events in memory, meant for tests and local runs
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	events []pkg.OutboxEvent
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+func (publisher *MemoryPublisher) Publish(_ context.Context, event *pkg.OutboxEvent) error {
+	publisher.mu.Lock()
+	defer publisher.mu.Unlock()
+
+	publisher.events = append(publisher.events, *event)
+
+	return nil
+}
+
+// Events returns a copy of everything published so far
+func (publisher *MemoryPublisher) Events() []pkg.OutboxEvent {
+	publisher.mu.Lock()
+	defer publisher.mu.Unlock()
+
+	return append([]pkg.OutboxEvent(nil), publisher.events...)
+}
@@ -0,0 +1,26 @@
+package events
+
+import (
+	"context"
+
+	"wallet-api/internal/pkg"
+)
+
+// EventPublisher sends the outbox events to whoever listens downstream, delivery is at least once
+// so consumers should ignore events whose ID they've already seen.
+type EventPublisher interface {
+	Publish(ctx context.Context, event *pkg.OutboxEvent) error
+}
+
+// Fanout sends the event to every publisher in order, stopping at the first failure so the relay retries it
+type Fanout []EventPublisher
+
+func (publishers Fanout) Publish(ctx context.Context, event *pkg.OutboxEvent) error {
+	for _, publisher := range publishers {
+		if err := publisher.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
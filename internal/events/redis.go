@@ -0,0 +1,55 @@
+package events
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+
+	"wallet-api/internal/pkg"
+	"wallet-api/internal/utils"
+)
+
+// RedisStreamPublisher adds the events to a redis stream, MaxLen trims it approximately when above 0
+type RedisStreamPublisher struct {
+	Client *redis.Client
+	Stream string
+	MaxLen int64
+}
+
+func NewRedisStreamPublisher(client *redis.Client, stream string, maxLen int64) *RedisStreamPublisher {
+	return &RedisStreamPublisher{
+		Client: client,
+		Stream: stream,
+		MaxLen: maxLen,
+	}
+}
+
+func (publisher *RedisStreamPublisher) Publish(ctx context.Context, event *pkg.OutboxEvent) error {
+	return publisher.Client.XAdd(ctx, &redis.XAddArgs{
+		Stream: publisher.Stream,
+		MaxLen: publisher.MaxLen,
+		Approx: publisher.MaxLen > 0,
+		Values: map[string]interface{}{
+			"id":        event.ID,
+			"type":      event.Type,
+			"wallet_id": event.WalletID,
+			"payload":   event.Payload,
+		},
+	}).Err()
+}
+
+// RedisPubSubPublisher sends the event payloads to the wallet's pub/sub channel, so every api instance
+// can push them to the clients streaming that wallet, nothing is kept when no one is listening
+type RedisPubSubPublisher struct {
+	Client *redis.Client
+}
+
+func NewRedisPubSubPublisher(client *redis.Client) *RedisPubSubPublisher {
+	return &RedisPubSubPublisher{
+		Client: client,
+	}
+}
+
+func (publisher *RedisPubSubPublisher) Publish(ctx context.Context, event *pkg.OutboxEvent) error {
+	return publisher.Client.Publish(ctx, utils.GenerateEventsChannel(event.WalletID), event.Payload).Err()
+}
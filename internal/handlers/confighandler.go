@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"wallet-api/api"
+	"wallet-api/internal/config"
+	"wallet-api/internal/middleware"
+)
+
+type ConfigHandler struct {
+	// Effective returns the configuration the api runs with, reloaded settings included
+	Effective func() config.Configurations
+	JwtSecret string
+}
+
+func NewConfigHandler(effective func() config.Configurations, jwtSecret string) *ConfigHandler {
+	return &ConfigHandler{
+		Effective: effective,
+		JwtSecret: jwtSecret,
+	}
+}
+
+// ConfigRoutes sets up the admin route showing the effective configuration
+func (handler *ConfigHandler) ConfigRoutes(r *gin.RouterGroup) {
+
+	r.Group("admin/config", middleware.RequireAdmin(handler.JwtSecret)).
+		GET("", handler.getConfig)
+
+	return
+}
+
+// getConfig answers the settings by their variable with the secrets redacted
+func (handler *ConfigHandler) getConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "successfully grabbed config"), handler.Effective().Redacted(), nil))
+}
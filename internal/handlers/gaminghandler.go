@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+
+	"wallet-api/api"
+	"wallet-api/internal/i18n"
+	"wallet-api/internal/middleware"
+	"wallet-api/internal/pkg"
+	"wallet-api/internal/services"
+)
+
+type GamingHandler struct {
+	GamingService services.GamingServices
+	Validator     *validator.Validate
+	JwtSecret     string
+}
+
+func NewGamingHandler(service *services.GamingService, jwtSecret string) *GamingHandler {
+	return &GamingHandler{
+		GamingService: service,
+		Validator:     i18n.Validator(),
+		JwtSecret:     jwtSecret,
+	}
+}
+
+// GamingRoutes sets up the responsible gaming routes for the user in the token
+func (handler *GamingHandler) GamingRoutes(r *gin.RouterGroup) {
+
+	r.Group("gaming", middleware.RequireAuth(handler.JwtSecret)).
+		GET("controls", handler.getControls).
+		PUT("limits", handler.setLimits).
+		POST("cooling-off", handler.coolOff).
+		POST("self-exclusion", handler.selfExclude)
+
+	return
+}
+
+func (handler *GamingHandler) getControls(c *gin.Context) {
+	uID, ok := tokenUserID(c)
+	if !ok {
+		return
+	}
+
+	controls, err := handler.GamingService.GetControls(c.Request.Context(), uID)
+	if err != nil {
+		middleware.AbortWithProblem(c, http.StatusInternalServerError, "failed to get gaming controls", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "successfully grabbed gaming controls"), controls, nil))
+	return
+}
+
+func (handler *GamingHandler) setLimits(c *gin.Context) {
+	uID, ok := tokenUserID(c)
+	if !ok {
+		return
+	}
+
+	var limitsRequest api.GamingLimitsRequest
+	if err := c.ShouldBindJSON(&limitsRequest); err != nil {
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "failed to get json body", err)
+		return
+	}
+
+	if err := handler.Validator.Struct(limitsRequest); err != nil {
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "missing or incorrect data received", err)
+		return
+	}
+
+	controls, err := handler.GamingService.SetLimits(c.Request.Context(), uID, &limitsRequest)
+	if err != nil {
+		middleware.AbortWithProblem(c, gamingErrorCode(err), "failed to set gaming limits", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "successfully set gaming limits"), controls, nil))
+	return
+}
+
+func (handler *GamingHandler) coolOff(c *gin.Context) {
+	uID, ok := tokenUserID(c)
+	if !ok {
+		return
+	}
+
+	var exclusionRequest api.ExclusionRequest
+	if err := c.ShouldBindJSON(&exclusionRequest); err != nil {
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "failed to get json body", err)
+		return
+	}
+
+	controls, err := handler.GamingService.CoolOff(c.Request.Context(), uID, &exclusionRequest)
+	if err != nil {
+		middleware.AbortWithProblem(c, gamingErrorCode(err), "failed to start cooling-off", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "cooling-off started"), controls, nil))
+	return
+}
+
+func (handler *GamingHandler) selfExclude(c *gin.Context) {
+	uID, ok := tokenUserID(c)
+	if !ok {
+		return
+	}
+
+	var exclusionRequest api.ExclusionRequest
+	if err := c.ShouldBindJSON(&exclusionRequest); err != nil {
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "failed to get json body", err)
+		return
+	}
+
+	controls, err := handler.GamingService.SelfExclude(c.Request.Context(), uID, &exclusionRequest)
+	if err != nil {
+		middleware.AbortWithProblem(c, gamingErrorCode(err), "failed to start self-exclusion", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "self-exclusion started"), controls, nil))
+	return
+}
+
+func gamingErrorCode(err error) int {
+	switch {
+	case errors.Is(err, pkg.ErrWrongAmount), errors.Is(err, pkg.ErrInvalidCoolingOff), errors.Is(err, pkg.ErrInvalidSelfExclusion):
+		return http.StatusBadRequest
+	case errors.Is(err, pkg.ErrExclusionActive):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
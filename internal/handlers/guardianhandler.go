@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+
+	"wallet-api/api"
+	"wallet-api/internal/i18n"
+	"wallet-api/internal/middleware"
+	"wallet-api/internal/pkg"
+	"wallet-api/internal/services"
+)
+
+type GuardianHandler struct {
+	GuardianService services.GuardianServices
+	Validator       *validator.Validate
+	JwtSecret       string
+}
+
+func NewGuardianHandler(service *services.GuardianService, jwtSecret string) *GuardianHandler {
+	return &GuardianHandler{
+		GuardianService: service,
+		Validator:       i18n.Validator(),
+		JwtSecret:       jwtSecret,
+	}
+}
+
+// GuardianRoutes sets up the parental control routes, the user in the token is always the guardian apart from the
+// admin route linking minors to their guardian
+func (handler *GuardianHandler) GuardianRoutes(r *gin.RouterGroup) {
+
+	r.Group("admin/users/:userid/minors", middleware.RequireAdmin(handler.JwtSecret)).
+		POST("", handler.linkMinor)
+
+	r.Group("guardian", middleware.RequireAuth(handler.JwtSecret)).
+		GET("minors", handler.getMinors).
+		GET("wallets/:walletid/controls", handler.getWalletControls).
+		PUT("wallets/:walletid/controls", handler.setWalletControls).
+		GET("wallets/:walletid/transactions", handler.getWalletTransactions).
+		POST("transactions/:txid/approve", handler.approveDebit).
+		POST("transactions/:txid/reject", handler.rejectDebit)
+
+	return
+}
+
+func (handler *GuardianHandler) getMinors(c *gin.Context) {
+	uID, ok := tokenUserID(c)
+	if !ok {
+		return
+	}
+
+	minors, err := handler.GuardianService.GetMinors(c.Request.Context(), uID)
+	if err != nil {
+		middleware.AbortWithProblem(c, http.StatusInternalServerError, "failed to get minors", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "successfully grabbed minors"), minors, nil))
+	return
+}
+
+func (handler *GuardianHandler) linkMinor(c *gin.Context) {
+	uID, ok := pathID(c, "userid")
+	if !ok {
+		return
+	}
+
+	var linkRequest api.LinkMinorRequest
+	if err := c.ShouldBindJSON(&linkRequest); err != nil {
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "failed to get json body", err)
+		return
+	}
+
+	if err := handler.Validator.Struct(linkRequest); err != nil {
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "missing or incorrect data received", err)
+		return
+	}
+
+	link, err := handler.GuardianService.LinkMinor(c.Request.Context(), uID, linkRequest)
+	if err != nil {
+		middleware.AbortWithProblem(c, guardianErrorCode(err), "failed to link minor", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "successfully linked minor"), link, nil))
+	return
+}
+
+func (handler *GuardianHandler) getWalletControls(c *gin.Context) {
+	uID, ok := tokenUserID(c)
+	if !ok {
+		return
+	}
+
+	wID, ok := pathID(c, "walletid")
+	if !ok {
+		return
+	}
+
+	controls, err := handler.GuardianService.GetWalletControls(c.Request.Context(), uID, wID)
+	if err != nil {
+		middleware.AbortWithProblem(c, guardianErrorCode(err), "failed to get wallet controls", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "successfully grabbed wallet controls"), controls, nil))
+	return
+}
+
+func (handler *GuardianHandler) setWalletControls(c *gin.Context) {
+	uID, ok := tokenUserID(c)
+	if !ok {
+		return
+	}
+
+	wID, ok := pathID(c, "walletid")
+	if !ok {
+		return
+	}
+
+	var controlsRequest api.WalletControlsRequest
+	if err := c.ShouldBindJSON(&controlsRequest); err != nil {
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "failed to get json body", err)
+		return
+	}
+
+	controls, err := handler.GuardianService.SetWalletControls(c.Request.Context(), uID, wID, &controlsRequest)
+	if err != nil {
+		middleware.AbortWithProblem(c, guardianErrorCode(err), "failed to set wallet controls", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "successfully set wallet controls"), controls, nil))
+	return
+}
+
+func (handler *GuardianHandler) getWalletTransactions(c *gin.Context) {
+	uID, ok := tokenUserID(c)
+	if !ok {
+		return
+	}
+
+	wID, ok := pathID(c, "walletid")
+	if !ok {
+		return
+	}
+
+	history, err := handler.GuardianService.GetWalletTransactions(c.Request.Context(), uID, wID)
+	if err != nil {
+		middleware.AbortWithProblem(c, guardianErrorCode(err), "failed to get wallet transactions", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "successfully grabbed wallet transactions"), history, nil))
+	return
+}
+
+func (handler *GuardianHandler) approveDebit(c *gin.Context) {
+	uID, ok := tokenUserID(c)
+	if !ok {
+		return
+	}
+
+	txID, ok := pathID(c, "txid")
+	if !ok {
+		return
+	}
+
+	res, err := handler.GuardianService.ApproveDebit(c.Request.Context(), uID, txID)
+	if err != nil {
+		middleware.AbortWithProblem(c, guardianErrorCode(err), "failed to approve debit", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "debit approved"), res, nil))
+	return
+}
+
+func (handler *GuardianHandler) rejectDebit(c *gin.Context) {
+	uID, ok := tokenUserID(c)
+	if !ok {
+		return
+	}
+
+	txID, ok := pathID(c, "txid")
+	if !ok {
+		return
+	}
+
+	res, err := handler.GuardianService.RejectDebit(c.Request.Context(), uID, txID)
+	if err != nil {
+		middleware.AbortWithProblem(c, guardianErrorCode(err), "failed to reject debit", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "debit rejected"), res, nil))
+	return
+}
+
+func guardianErrorCode(err error) int {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, pkg.ErrWrongAmount), errors.Is(err, pkg.ErrNotAMinor), errors.Is(err, pkg.ErrGuardianNotAdult):
+		return http.StatusBadRequest
+	case errors.Is(err, pkg.ErrNotGuardian):
+		return http.StatusForbidden
+	case errors.Is(err, pkg.ErrNotEnoughFunds):
+		return http.StatusNotAcceptable
+	case errors.Is(err, pkg.ErrTransactionNotPending), errors.Is(err, pkg.ErrMinorAlreadyLinked):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
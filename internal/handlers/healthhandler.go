@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"wallet-api/api"
+	"wallet-api/internal/pkg"
+	"wallet-api/internal/services"
+)
+
+type HealthHandler struct {
+	HealthService services.HealthServices
+}
+
+func NewHealthHandler(service *services.HealthService) *HealthHandler {
+	return &HealthHandler{
+		HealthService: service,
+	}
+}
+
+// HealthRoutes sets up the probes of the orchestrator, they aren't versioned nor need a token
+func (handler *HealthHandler) HealthRoutes(r *gin.RouterGroup) {
+
+	r.GET("healthz", handler.live)
+	r.GET("readyz", handler.ready)
+
+	return
+}
+
+// live only says the process answers, a dependency being down is no reason to restart it
+func (handler *HealthHandler) live(c *gin.Context) {
+	c.JSON(http.StatusOK, api.HealthCheck{Status: pkg.HealthUp})
+}
+
+// ready answers 503 while a dependency is down so no traffic is routed to the api until it's back
+func (handler *HealthHandler) ready(c *gin.Context) {
+	res := handler.HealthService.Ready(c.Request.Context())
+
+	status := http.StatusOK
+	if res.Status != pkg.HealthUp {
+		status = http.StatusServiceUnavailable
+	}
+
+	c.JSON(status, res)
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+
+	"wallet-api/api"
+	"wallet-api/internal/i18n"
+	"wallet-api/internal/middleware"
+	"wallet-api/internal/services"
+)
+
+type KYCHandler struct {
+	KYCService services.KYCServices
+	Validator  *validator.Validate
+	JwtSecret  string
+}
+
+func NewKYCHandler(service *services.KYCService, jwtSecret string) *KYCHandler {
+	return &KYCHandler{
+		KYCService: service,
+		Validator:  i18n.Validator(),
+		JwtSecret:  jwtSecret,
+	}
+}
+
+// KYCRoutes sets up the admin routes recording the users' verifications
+func (handler *KYCHandler) KYCRoutes(r *gin.RouterGroup) {
+
+	r.Group("admin/users/:userid/kyc", middleware.RequireAdmin(handler.JwtSecret)).
+		GET("", handler.getKYC).
+		POST("documents", handler.addDocument).
+		POST("verifications", handler.verify)
+
+	return
+}
+
+func (handler *KYCHandler) getKYC(c *gin.Context) {
+	uID, ok := pathID(c, "userid")
+	if !ok {
+		return
+	}
+
+	kyc, err := handler.KYCService.GetKYC(c.Request.Context(), uID)
+	if err != nil {
+		middleware.AbortWithProblem(c, kycErrorCode(err), "failed to get kyc", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "successfully grabbed kyc"), kyc, nil))
+	return
+}
+
+func (handler *KYCHandler) addDocument(c *gin.Context) {
+	adminID, ok := tokenUserID(c)
+	if !ok {
+		return
+	}
+
+	uID, ok := pathID(c, "userid")
+	if !ok {
+		return
+	}
+
+	var documentRequest api.KYCDocumentRequest
+	if err := c.ShouldBindJSON(&documentRequest); err != nil {
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "failed to get json body", err)
+		return
+	}
+
+	if err := handler.Validator.Struct(documentRequest); err != nil {
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "missing or incorrect data received", err)
+		return
+	}
+
+	document, err := handler.KYCService.AddDocument(c.Request.Context(), adminID, uID, &documentRequest)
+	if err != nil {
+		middleware.AbortWithProblem(c, kycErrorCode(err), "failed to add kyc document", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "successfully added kyc document"), document, nil))
+	return
+}
+
+func (handler *KYCHandler) verify(c *gin.Context) {
+	adminID, ok := tokenUserID(c)
+	if !ok {
+		return
+	}
+
+	uID, ok := pathID(c, "userid")
+	if !ok {
+		return
+	}
+
+	var verificationRequest api.KYCVerificationRequest
+	if err := c.ShouldBindJSON(&verificationRequest); err != nil {
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "failed to get json body", err)
+		return
+	}
+
+	if err := handler.Validator.Struct(verificationRequest); err != nil {
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "missing or incorrect data received", err)
+		return
+	}
+
+	kyc, err := handler.KYCService.Verify(c.Request.Context(), adminID, uID, &verificationRequest)
+	if err != nil {
+		middleware.AbortWithProblem(c, kycErrorCode(err), "failed to record kyc verification", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "successfully recorded kyc verification"), kyc, nil))
+	return
+}
+
+func kycErrorCode(err error) int {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return http.StatusNotFound
+	}
+
+	return http.StatusInternalServerError
+}
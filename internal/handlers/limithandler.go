@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+
+	"wallet-api/api"
+	"wallet-api/internal/i18n"
+	"wallet-api/internal/middleware"
+	"wallet-api/internal/pkg"
+	"wallet-api/internal/services"
+)
+
+type LimitHandler struct {
+	LimitService services.LimitServices
+	Validator    *validator.Validate
+	JwtSecret    string
+}
+
+func NewLimitHandler(service *services.LimitService, jwtSecret string) *LimitHandler {
+	return &LimitHandler{
+		LimitService: service,
+		Validator:    i18n.Validator(),
+		JwtSecret:    jwtSecret,
+	}
+}
+
+// LimitRoutes sets up the admin routes managing the credit and debit limits
+func (handler *LimitHandler) LimitRoutes(r *gin.RouterGroup) {
+
+	r.Group("admin/limits", middleware.RequireAdmin(handler.JwtSecret)).
+		GET("", handler.getLimits).
+		PUT("", handler.setLimit).
+		DELETE(":limitid", handler.deleteLimit)
+
+	return
+}
+
+func (handler *LimitHandler) getLimits(c *gin.Context) {
+
+	limits, err := handler.LimitService.GetLimits(c.Request.Context())
+	if err != nil {
+		middleware.AbortWithProblem(c, http.StatusInternalServerError, "failed to get limits", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "successfully grabbed limits"), limits, nil))
+	return
+}
+
+func (handler *LimitHandler) setLimit(c *gin.Context) {
+
+	var limitRequest api.LimitRequest
+	if err := c.ShouldBindJSON(&limitRequest); err != nil {
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "failed to get json body", err)
+		return
+	}
+
+	if err := handler.Validator.Struct(limitRequest); err != nil {
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "missing or incorrect data received", err)
+		return
+	}
+
+	limit, err := handler.LimitService.SetLimit(c.Request.Context(), &limitRequest)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, pkg.ErrWrongAmount) {
+			code = http.StatusBadRequest
+		}
+
+		middleware.AbortWithProblem(c, code, "failed to set limit", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "successfully set limit"), limit, nil))
+	return
+}
+
+func (handler *LimitHandler) deleteLimit(c *gin.Context) {
+
+	limitID, ok := pathID(c, "limitid")
+	if !ok {
+		return
+	}
+
+	if err := handler.LimitService.DeleteLimit(c.Request.Context(), limitID); err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			code = http.StatusNotFound
+		}
+
+		middleware.AbortWithProblem(c, code, "failed to delete limit", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "successfully deleted limit"), nil, nil))
+	return
+}
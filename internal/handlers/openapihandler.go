@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+)
+
+// swaggerUI renders the spec served next to it at openapi.json, the assets come from the swagger-ui-dist package
+const swaggerUI = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8" />
+  <title>Wallet API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css" />
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.onload = () => {
+      window.ui = SwaggerUIBundle({ url: "openapi.json", dom_id: "#swagger-ui" });
+    };
+  </script>
+</body>
+</html>`
+
+type OpenAPIHandler struct {
+	Doc *openapi3.T
+}
+
+func NewOpenAPIHandler(doc *openapi3.T) *OpenAPIHandler {
+	return &OpenAPIHandler{
+		Doc: doc,
+	}
+}
+
+// OpenAPIRoutes serves the spec and a swagger ui page to browse it, neither need a token
+func (handler *OpenAPIHandler) OpenAPIRoutes(r *gin.RouterGroup) {
+
+	r.GET("openapi.json", handler.getSpec).
+		GET("docs", handler.getDocs)
+
+	return
+}
+
+func (handler *OpenAPIHandler) getSpec(c *gin.Context) {
+	c.JSON(http.StatusOK, handler.Doc)
+}
+
+func (handler *OpenAPIHandler) getDocs(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUI))
+}
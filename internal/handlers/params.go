@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"wallet-api/internal/middleware"
+)
+
+// tokenUserID gets the user id saved from the token, aborting the request if it's missing
+func tokenUserID(c *gin.Context) (int, bool) {
+	userID, _ := c.Get("user_id")
+	uID := userID.(int)
+	if uID == 0 {
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "invalid user id", fmt.Errorf("no user id saved from token or cannot be parsed: %d", uID))
+		return 0, false
+	}
+
+	return uID, true
+}
+
+// pathID parses the url param as a positive id, aborting the request if it can't
+func pathID(c *gin.Context, param string) (int, bool) {
+	id, err := strconv.Atoi(c.Param(param))
+	if id < 1 || err != nil {
+		middleware.AbortWithProblem(c, http.StatusBadRequest, fmt.Sprintf("failed to get %s from url", param), fmt.Errorf("missing url"))
+		return 0, false
+	}
+
+	return id, true
+}
@@ -0,0 +1,446 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"wallet-api/api"
+	"wallet-api/internal/i18n"
+	"wallet-api/internal/logging"
+	"wallet-api/internal/middleware"
+	"wallet-api/internal/pkg"
+	"wallet-api/internal/services"
+)
+
+const (
+	SocketSubscribe   = "subscribe"
+	SocketUnsubscribe = "unsubscribe"
+	SocketBalance     = "balance"
+	SocketCredit      = "credit"
+	SocketDebit       = "debit"
+	SocketResponse    = "response"
+	SocketEvent       = "event"
+
+	// maxSubscriptions caps the wallets one connection can follow
+	maxSubscriptions = 50
+	// socketPongWait is how long the connection can stay silent, pings are sent often enough to get a pong before it
+	socketPongWait   = 60 * time.Second
+	socketPingPeriod = socketPongWait * 9 / 10
+	socketWriteWait  = 10 * time.Second
+)
+
+type SocketHandler struct {
+	WalletService  services.WalletServices
+	JwtSecret      string
+	Upgrader       websocket.Upgrader
+	Cache          *redis.Client
+	IdempotencyTTL time.Duration
+	logger         *zap.Logger
+	// the connections are hijacked from the http server, which doesn't wait for them when shutting down. mu guards
+	// stopped so no session is added once Shutdown waits for them.
+	sessions sync.WaitGroup
+	mu       sync.Mutex
+	stopped  bool
+	stopping chan struct{}
+}
+
+func NewSocketHandler(service *services.WalletService, jwtSecret string, idempotencyTTL time.Duration, logger *zap.Logger) *SocketHandler {
+	return &SocketHandler{
+		WalletService:  service,
+		JwtSecret:      jwtSecret,
+		Upgrader:       websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024},
+		Cache:          service.Cache,
+		IdempotencyTTL: idempotencyTTL,
+		logger:         logger,
+		stopping:       make(chan struct{}),
+	}
+}
+
+// SocketRoutes sets up the websocket taking wallet commands and subscriptions on one connection
+func (handler *SocketHandler) SocketRoutes(r *gin.RouterGroup) {
+
+	r.Group("ws", middleware.RequireAuth(handler.JwtSecret)).
+		GET("", handler.connect)
+
+	return
+}
+
+// Shutdown stops reading commands from the connections, lets the ones in flight answer and closes the connections as
+// going away, waiting for them until the context is done. New connections are refused.
+func (handler *SocketHandler) Shutdown(ctx context.Context) error {
+	handler.mu.Lock()
+	if !handler.stopped {
+		handler.stopped = true
+		close(handler.stopping)
+	}
+	handler.mu.Unlock()
+
+	closed := make(chan struct{})
+	go func() {
+		handler.sessions.Wait()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// socketSession is one client connection, everything written goes through out as gorilla allows a single writer, done
+// is closed once no more commands are read. mu guards the subscriptions and closing, set once the reads are stopped so a
+// pong doesn't push the deadline back.
+type socketSession struct {
+	handler       *SocketHandler
+	userID        int
+	lang          string
+	lowerCaseIDs  bool
+	ctx           context.Context
+	out           chan api.SocketMessage
+	done          chan struct{}
+	mu            sync.Mutex
+	subscriptions map[int]context.CancelFunc
+	closing       bool
+	expired       bool
+}
+
+func (handler *SocketHandler) connect(c *gin.Context) {
+	uID, ok := tokenUserID(c)
+	if !ok {
+		return
+	}
+
+	handler.mu.Lock()
+	if handler.stopped {
+		handler.mu.Unlock()
+		middleware.AbortWithProblem(c, http.StatusServiceUnavailable, "server shutting down", nil)
+		return
+	}
+	handler.sessions.Add(1)
+	handler.mu.Unlock()
+	defer handler.sessions.Done()
+
+	conn, err := handler.Upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// the upgrader already replied to the client
+		logging.From(c.Request.Context(), handler.logger).Error("something went wrong upgrading to websocket", zap.Error(err), zap.Int("user_id", uID))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	session := &socketSession{
+		handler:       handler,
+		userID:        uID,
+		lang:          middleware.Language(c),
+		lowerCaseIDs:  middleware.LowersIDs(c),
+		ctx:           ctx,
+		out:           make(chan api.SocketMessage, 16),
+		done:          make(chan struct{}),
+		subscriptions: make(map[int]context.CancelFunc),
+	}
+
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		session.write(conn, cancel)
+	}()
+
+	// the token isn't checked again once upgraded, the connection ends when it expires
+	expiry := time.NewTimer(time.Until(middleware.TokenExpiresAt(c)))
+	go func() {
+		defer expiry.Stop()
+
+		select {
+		case <-handler.stopping:
+			session.stopReading(conn, false)
+		case <-expiry.C:
+			session.stopReading(conn, true)
+		case <-ctx.Done():
+		}
+	}()
+
+	session.read(conn)
+	close(session.done)
+	<-written
+}
+
+// read handles the commands in the order they're received until the client goes away
+func (session *socketSession) read(conn *websocket.Conn) {
+	_ = session.extendRead(conn)
+	conn.SetPongHandler(func(string) error {
+		return session.extendRead(conn)
+	})
+
+	for {
+		var req api.SocketRequest
+		if err := conn.ReadJSON(&req); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				session.send(api.SocketMessage{Type: SocketResponse, Status: http.StatusBadRequest, Code: api.CodeInvalidRequest, Error: err.Error()})
+				continue
+			}
+			return
+		}
+
+		session.send(session.handle(&req))
+	}
+}
+
+func (session *socketSession) extendRead(conn *websocket.Conn) error {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if session.closing {
+		return nil
+	}
+
+	return conn.SetReadDeadline(time.Now().Add(socketPongWait))
+}
+
+// stopReading lets the command in flight answer, the next read fails straight away
+func (session *socketSession) stopReading(conn *websocket.Conn, expired bool) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	session.closing = true
+	session.expired = expired
+	_ = conn.SetReadDeadline(time.Now())
+}
+
+// write sends the queued messages and the pings, closing the session when the connection breaks
+func (session *socketSession) write(conn *websocket.Conn, cancel context.CancelFunc) {
+	ping := time.NewTicker(socketPingPeriod)
+	defer func() {
+		ping.Stop()
+		cancel()
+		_ = conn.Close()
+	}()
+
+	for {
+		select {
+		case <-session.ctx.Done():
+			_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(socketWriteWait))
+			return
+		case <-session.done:
+			session.flush(conn)
+			return
+		case msg := <-session.out:
+			if err := session.writeMessage(conn, msg); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// flush sends the responses still queued once the reads stopped, closing the connection as going away on a shutdown and
+// as a policy violation once the token expired
+func (session *socketSession) flush(conn *websocket.Conn) {
+	for {
+		select {
+		case msg := <-session.out:
+			if err := session.writeMessage(conn, msg); err != nil {
+				return
+			}
+		default:
+			session.mu.Lock()
+			expired := session.expired
+			session.mu.Unlock()
+
+			code, text := websocket.CloseNormalClosure, ""
+			if expired {
+				code, text = websocket.ClosePolicyViolation, "token expired"
+			} else {
+				select {
+				case <-session.handler.stopping:
+					code = websocket.CloseGoingAway
+				default:
+				}
+			}
+			_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(socketWriteWait))
+			return
+		}
+	}
+}
+
+// writeMessage sends the message in the casing of the version the connection was opened with, the hijacked connection
+// isn't written through the version's middleware
+func (session *socketSession) writeMessage(conn *websocket.Conn, msg api.SocketMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	if session.lowerCaseIDs {
+		body = api.LowerCaseIDs(body)
+	}
+
+	_ = conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+
+	return conn.WriteMessage(websocket.TextMessage, body)
+}
+
+func (session *socketSession) send(msg api.SocketMessage) {
+	select {
+	case session.out <- msg:
+	case <-session.ctx.Done():
+	}
+}
+
+func (session *socketSession) handle(req *api.SocketRequest) api.SocketMessage {
+	if req.IdempotencyKey != "" && (req.Type == SocketCredit || req.Type == SocketDebit) {
+		return session.idempotent(req)
+	}
+
+	return session.run(req)
+}
+
+// idempotent runs the credit or debit once for the key, answering the first response again when it's sent again
+func (session *socketSession) idempotent(req *api.SocketRequest) api.SocketMessage {
+	command := *req
+	command.ID, command.IdempotencyKey = "", ""
+	body, _ := json.Marshal(command)
+
+	saved, replayed, err := middleware.Idempotent(session.ctx, session.handler.Cache, session.handler.IdempotencyTTL, session.userID,
+		req.IdempotencyKey, middleware.IdempotencyFingerprint("ws "+req.Type, body), func() (int, []byte) {
+			res := session.run(req)
+			body, _ := json.Marshal(res)
+			return res.Status, body
+		})
+	if err != nil {
+		res := api.SocketMessage{ID: req.ID, Type: SocketResponse, WalletID: req.WalletID}
+		switch {
+		case errors.Is(err, middleware.ErrIdempotencyKeyTooLong):
+			return session.fail(res, http.StatusBadRequest, err)
+		case errors.Is(err, pkg.ErrIdempotencyKeyReused):
+			return session.fail(res, http.StatusUnprocessableEntity, err)
+		case errors.Is(err, pkg.ErrIdempotencyKeyInProgress):
+			return session.fail(res, http.StatusConflict, err)
+		default:
+			return session.fail(res, http.StatusInternalServerError, err)
+		}
+	}
+
+	var res api.SocketMessage
+	if err = json.Unmarshal(saved, &res); err != nil {
+		return session.fail(api.SocketMessage{ID: req.ID, Type: SocketResponse, WalletID: req.WalletID}, http.StatusInternalServerError, err)
+	}
+	res.ID, res.Replayed = req.ID, replayed
+
+	return res
+}
+
+// fail fills the message with the error, its code being the one the http endpoint would've returned
+func (session *socketSession) fail(res api.SocketMessage, status int, err error) api.SocketMessage {
+	res.Result = nil
+	res.Status, res.Error = status, i18n.Error(session.lang, err)
+	if res.Code = pkg.ErrorCode(err); res.Code == "" {
+		res.Code = api.StatusCode(res.Status)
+	}
+
+	return res
+}
+
+func (session *socketSession) run(req *api.SocketRequest) api.SocketMessage {
+	res := api.SocketMessage{ID: req.ID, Type: SocketResponse, WalletID: req.WalletID}
+
+	if req.WalletID < 1 {
+		res.Status, res.Code, res.Error = http.StatusBadRequest, api.CodeInvalidRequest, i18n.Translate(session.lang, "missing wallet_ID")
+		return res
+	}
+
+	var err error
+	switch req.Type {
+	case SocketSubscribe:
+		res.Result, err = session.subscribe(req.WalletID)
+	case SocketUnsubscribe:
+		session.unsubscribe(req.WalletID)
+	case SocketBalance:
+		res.Result, err = session.handler.WalletService.Balance(session.ctx, session.userID, req.WalletID)
+	case SocketCredit:
+		res.Result, err = session.handler.WalletService.Credit(session.ctx, &api.CreditRequest{
+			UserId:   session.userID,
+			WalletId: req.WalletID,
+			Amount:   req.Amount,
+			Category: req.Category,
+		})
+	case SocketDebit:
+		res.Result, err = session.handler.WalletService.Debit(session.ctx, &api.DebitRequest{
+			UserId:   session.userID,
+			WalletId: req.WalletID,
+			Amount:   req.Amount,
+			Category: req.Category,
+		})
+	default:
+		res.Status, res.Code, res.Error = http.StatusBadRequest, api.CodeInvalidRequest, i18n.Translate(session.lang, "unknown command type")
+		return res
+	}
+
+	if err != nil {
+		return session.fail(res, walletErrorCode(err), err)
+	}
+
+	if debit, ok := res.Result.(*api.DebitResponse); ok && debit.Status == pkg.TransactionPending {
+		res.Status = http.StatusAccepted
+		return res
+	}
+
+	res.Status = http.StatusOK
+	return res
+}
+
+// subscribe starts forwarding the wallet's events, returning the current balance like the stream endpoint does
+func (session *socketSession) subscribe(walletID int) (*api.BalanceResponse, error) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if _, ok := session.subscriptions[walletID]; !ok {
+		if len(session.subscriptions) >= maxSubscriptions {
+			return nil, pkg.ErrTooManySubscriptions
+		}
+
+		ctx, cancel := context.WithCancel(session.ctx)
+		payloads, err := session.handler.WalletService.Subscribe(ctx, session.userID, walletID)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		session.subscriptions[walletID] = cancel
+
+		go func() {
+			for payload := range payloads {
+				session.send(api.SocketMessage{Type: SocketEvent, WalletID: walletID, Event: json.RawMessage(payload)})
+			}
+		}()
+	}
+
+	return session.handler.WalletService.Balance(session.ctx, session.userID, walletID)
+}
+
+func (session *socketSession) unsubscribe(walletID int) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if cancel, ok := session.subscriptions[walletID]; ok {
+		cancel()
+		delete(session.subscriptions, walletID)
+	}
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redismock/v9"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"wallet-api/api"
+	"wallet-api/internal/middleware"
+	"wallet-api/internal/pkg"
+	"wallet-api/internal/services"
+)
+
+const socketTestSecret = "access-secret"
+
+// fakeWallets answers the commands without a db, counting the credits
+type fakeWallets struct {
+	services.WalletServices
+	mu      sync.Mutex
+	credits int
+}
+
+func (f *fakeWallets) Balance(_ context.Context, userID, walletID int) (*api.BalanceResponse, error) {
+	return &api.BalanceResponse{UserID: userID, WalletID: walletID, Balance: decimal.NewFromInt(10)}, nil
+}
+
+func (f *fakeWallets) Credit(_ context.Context, req *api.CreditRequest) (*api.CreditResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.credits++
+
+	return &api.CreditResponse{UserID: req.UserId, WalletID: req.WalletId, Balance: req.Amount, TransactionID: f.credits}, nil
+}
+
+// socketServer serves the websocket under /v1 and /v2 like the app does
+func socketServer(t *testing.T) (*SocketHandler, *fakeWallets, redismock.ClientMock, string) {
+	gin.SetMode(gin.TestMode)
+
+	rd, redisMock := redismock.NewClientMock()
+	wallets := &fakeWallets{}
+	handler := &SocketHandler{
+		WalletService:  wallets,
+		JwtSecret:      socketTestSecret,
+		Cache:          rd,
+		IdempotencyTTL: time.Hour,
+		logger:         zap.NewNop(),
+		stopping:       make(chan struct{}),
+	}
+
+	router := gin.New()
+	handler.SocketRoutes(router.Group("/v1"))
+	handler.SocketRoutes(router.Group("/v2", middleware.LowerCaseIDs()))
+
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	return handler, wallets, redisMock, "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func dialSocket(t *testing.T, url string, expiresAt time.Time) (*websocket.Conn, *http.Response, error) {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":  1,
+		"role": pkg.RoleUser,
+		"typ":  pkg.TokenAccess,
+		"exp":  expiresAt.Unix(),
+	}).SignedString([]byte(socketTestSecret))
+	require.NoError(t, err)
+
+	conn, res, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {"Bearer " + token}})
+	if err == nil {
+		t.Cleanup(func() { _ = conn.Close() })
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	}
+
+	return conn, res, err
+}
+
+// matchKey matches the redis command by its key, saving the value it was sent with
+func matchKey(key string, value *string) redismock.CustomMatch {
+	return func(expected, actual []interface{}) error {
+		if fmt.Sprint(actual[1]) != key {
+			return fmt.Errorf("unexpected key %v", actual[1])
+		}
+		if value != nil {
+			*value = fmt.Sprint(actual[2])
+		}
+		return nil
+	}
+}
+
+func TestSocketCasing(t *testing.T) {
+	_, _, _, url := socketServer(t)
+
+	testCases := []struct {
+		Name     string
+		Path     string
+		Expected string
+	}{
+		{Name: "v1 keeps the ID keys", Path: "/v1/ws", Expected: `"wallet_ID":1`},
+		{Name: "v2 sends the ID keys in lower case", Path: "/v2/ws", Expected: `"wallet_id":1`},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			conn, _, err := dialSocket(t, url+test.Path, time.Now().Add(time.Hour))
+			require.NoError(t, err)
+
+			require.NoError(t, conn.WriteJSON(api.SocketRequest{ID: "1", Type: SocketBalance, WalletID: 1}))
+
+			_, raw, err := conn.ReadMessage()
+			require.NoError(t, err)
+			require.Contains(t, string(raw), test.Expected)
+			require.Contains(t, string(raw), `"status":200`)
+		})
+	}
+}
+
+func TestSocketIdempotency(t *testing.T) {
+	_, wallets, redisMock, url := socketServer(t)
+
+	conn, _, err := dialSocket(t, url+"/v1/ws", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	key := "idempotency:1:order-1"
+	credit := api.SocketRequest{Type: SocketCredit, WalletID: 1, Amount: decimal.NewFromInt(10), IdempotencyKey: "order-1"}
+
+	var saved string
+	redisMock.CustomMatch(matchKey(key, nil)).ExpectSetNX(key, "", time.Minute).SetVal(true)
+	redisMock.CustomMatch(matchKey(key, &saved)).ExpectSet(key, "", time.Hour).SetVal("OK")
+
+	credit.ID = "1"
+	require.NoError(t, conn.WriteJSON(credit))
+
+	var first api.SocketMessage
+	require.NoError(t, conn.ReadJSON(&first))
+	require.Equal(t, http.StatusOK, first.Status)
+	require.False(t, first.Replayed)
+
+	t.Run("The same credit sent again is replayed", func(t *testing.T) {
+		redisMock.CustomMatch(matchKey(key, nil)).ExpectSetNX(key, "", time.Minute).SetVal(false)
+		redisMock.ExpectGet(key).SetVal(saved)
+
+		credit.ID = "2"
+		require.NoError(t, conn.WriteJSON(credit))
+
+		var res api.SocketMessage
+		require.NoError(t, conn.ReadJSON(&res))
+		require.Equal(t, "2", res.ID)
+		require.Equal(t, http.StatusOK, res.Status)
+		require.True(t, res.Replayed)
+		require.Equal(t, 1, wallets.credits)
+	})
+
+	t.Run("The key sent with another amount is refused", func(t *testing.T) {
+		redisMock.CustomMatch(matchKey(key, nil)).ExpectSetNX(key, "", time.Minute).SetVal(false)
+		redisMock.ExpectGet(key).SetVal(saved)
+
+		other := credit
+		other.ID, other.Amount = "3", decimal.NewFromInt(20)
+		require.NoError(t, conn.WriteJSON(other))
+
+		var res api.SocketMessage
+		require.NoError(t, conn.ReadJSON(&res))
+		require.Equal(t, http.StatusUnprocessableEntity, res.Status)
+		require.Equal(t, api.CodeIdempotencyKeyReused, res.Code)
+		require.Equal(t, 1, wallets.credits)
+	})
+
+	require.NoError(t, redisMock.ExpectationsWereMet())
+}
+
+func TestSocketTokenExpiry(t *testing.T) {
+	_, _, _, url := socketServer(t)
+
+	conn, _, err := dialSocket(t, url+"/v1/ws", time.Now().Add(time.Second))
+	require.NoError(t, err)
+
+	_, _, err = conn.ReadMessage()
+
+	var closeErr *websocket.CloseError
+	require.True(t, errors.As(err, &closeErr), err)
+	require.Equal(t, websocket.ClosePolicyViolation, closeErr.Code)
+}
+
+func TestSocketShutdown(t *testing.T) {
+	handler, _, _, url := socketServer(t)
+
+	conn, _, err := dialSocket(t, url+"/v1/ws", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- handler.Shutdown(ctx) }()
+
+	t.Run("Open connections are closed as going away", func(t *testing.T) {
+		_, _, err := conn.ReadMessage()
+
+		var closeErr *websocket.CloseError
+		require.True(t, errors.As(err, &closeErr), err)
+		require.Equal(t, websocket.CloseGoingAway, closeErr.Code)
+		require.NoError(t, <-stopped)
+	})
+
+	t.Run("New connections are refused", func(t *testing.T) {
+		_, res, err := dialSocket(t, url+"/v1/ws", time.Now().Add(time.Hour))
+		require.Error(t, err)
+		require.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	})
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -9,7 +10,10 @@ import (
 	"github.com/go-playground/validator/v10"
 	"gorm.io/gorm"
 
-	"wallet-api/internal/api"
+	"wallet-api/api"
+	"wallet-api/internal/i18n"
+	"wallet-api/internal/middleware"
+	"wallet-api/internal/pkg"
 	"wallet-api/internal/services"
 )
 
@@ -21,7 +25,7 @@ type UserHandler struct {
 func NewUserHandler(service *services.UserService) *UserHandler {
 	return &UserHandler{
 		UserService: service,
-		Validator:   validator.New(),
+		Validator:   i18n.Validator(),
 	}
 }
 
@@ -29,6 +33,7 @@ func NewUserHandler(service *services.UserService) *UserHandler {
 func (handler *UserHandler) UserRoutes(r *gin.RouterGroup) {
 
 	r.POST("login", handler.login)
+	r.POST("token/refresh", handler.refreshToken)
 
 	// TODO add validation for correct token and return 401 accordingly
 	// r.Group("users").
@@ -42,13 +47,13 @@ func (handler *UserHandler) UserRoutes(r *gin.RouterGroup) {
 
 func (handler *UserHandler) getUsers(c *gin.Context) {
 
-	users, err := handler.UserService.GetUsers()
+	users, err := handler.UserService.GetUsers(c.Request.Context())
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.GenerateMessageResponse("failed to get users", nil, err))
+		middleware.AbortWithProblem(c, http.StatusInternalServerError, "failed to get users", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, api.GenerateMessageResponse("successfully grabbed all users", users, nil))
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "successfully grabbed all users"), users, nil))
 	return
 }
 
@@ -57,17 +62,17 @@ func (handler *UserHandler) getUserByUsername(c *gin.Context) {
 	username := c.Param("username")
 
 	if username == "" {
-		c.AbortWithStatusJSON(http.StatusBadRequest, api.GenerateMessageResponse("failed to get username from url", nil, fmt.Errorf("missing url")))
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "failed to get username from url", fmt.Errorf("missing url"))
 		return
 	}
 
-	user, err := handler.UserService.GetUserByUsername(username)
+	user, err := handler.UserService.GetUserByUsername(c.Request.Context(), username)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.GenerateMessageResponse("failed to get user by username", nil, err))
+		middleware.AbortWithProblem(c, http.StatusInternalServerError, "failed to get user by username", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, api.GenerateMessageResponse("successfully got user", user, nil))
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "successfully got user"), user, nil))
 	return
 }
 
@@ -77,20 +82,20 @@ func (handler *UserHandler) getUserByID(c *gin.Context) {
 	userIDint, err := strconv.Atoi(userID)
 
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, api.GenerateMessageResponse("failed to get userID", nil, err))
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "failed to get userID", err)
 		return
 	} else if userIDint < 1 {
-		c.AbortWithStatusJSON(http.StatusBadRequest, api.GenerateMessageResponse("failed to get user", nil, fmt.Errorf("invalid user id")))
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "failed to get user", fmt.Errorf("invalid user id"))
 		return
 	}
 
-	user, err := handler.UserService.GetUserByID(uint(userIDint))
+	user, err := handler.UserService.GetUserByID(c.Request.Context(), uint(userIDint))
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.GenerateMessageResponse("failed to get user", nil, err))
+		middleware.AbortWithProblem(c, http.StatusInternalServerError, "failed to get user", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, api.GenerateMessageResponse("successfully got user", user, nil))
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "successfully got user"), user, nil))
 	return
 }
 
@@ -99,22 +104,22 @@ func (handler *UserHandler) newUser(c *gin.Context) {
 	var user api.User
 
 	if err := c.ShouldBindJSON(&user); err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.GenerateMessageResponse("failed to parse new user request", nil, err))
+		middleware.AbortWithProblem(c, http.StatusInternalServerError, "failed to parse new user request", err)
 		return
 	}
 
 	if err := handler.Validator.Struct(user); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, api.GenerateMessageResponse("missing or incorrect data received", nil, err))
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "missing or incorrect data received", err)
 		return
 	}
 
-	res, err := handler.UserService.InsertUser(&user)
+	res, err := handler.UserService.InsertUser(c.Request.Context(), &user)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.GenerateMessageResponse("failed to add user", nil, err))
+		middleware.AbortWithProblem(c, http.StatusInternalServerError, "failed to add user", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, api.GenerateMessageResponse("successfully inserted user", res, nil))
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "successfully inserted user"), res, nil))
 	return
 }
 
@@ -123,19 +128,54 @@ func (handler *UserHandler) login(c *gin.Context) {
 	var loginReq api.LoginRequest
 
 	if err := c.ShouldBindJSON(&loginReq); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, api.GenerateMessageResponse("failed to login", nil, err))
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "failed to login", err)
 		return
 	}
 
-	user, err := handler.UserService.Login(loginReq)
-	if err != nil && err == gorm.ErrRecordNotFound {
-		c.AbortWithStatusJSON(http.StatusNotFound, api.GenerateMessageResponse("failed to login requested user", nil, err))
+	user, err := handler.UserService.Login(c.Request.Context(), loginReq)
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		middleware.AbortWithProblem(c, http.StatusNotFound, "failed to login requested user", err)
+		return
+	} else if err != nil && errors.Is(err, pkg.ErrInvalidCredentials) {
+		middleware.AbortWithProblem(c, http.StatusUnauthorized, "failed to login requested user", err)
 		return
 	} else if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.GenerateMessageResponse("failed to login requested user", nil, err))
+		middleware.AbortWithProblem(c, http.StatusInternalServerError, "failed to login requested user", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "login successful"), user, nil))
+	return
+}
+
+// refreshToken swaps the refresh token sent for a new pair so clients don't need to keep the user's password
+func (handler *UserHandler) refreshToken(c *gin.Context) {
+	var refreshReq api.RefreshRequest
+
+	if err := c.ShouldBindJSON(&refreshReq); err != nil {
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "failed to get json body", err)
+		return
+	}
+
+	if err := handler.Validator.Struct(refreshReq); err != nil {
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "missing or incorrect data received", err)
+		return
+	}
+
+	tokens, err := handler.UserService.RefreshToken(c.Request.Context(), refreshReq.RefreshToken)
+	if err != nil {
+		code := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			code = http.StatusNotFound
+		case errors.Is(err, pkg.ErrTokenExpired), errors.Is(err, pkg.ErrTokenInvalid):
+			code = http.StatusForbidden
+		}
+
+		middleware.AbortWithProblem(c, code, "failed to refresh token", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, api.GenerateMessageResponse("login successful", user, nil))
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "token refreshed"), tokens, nil))
 	return
 }
@@ -1,43 +1,73 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 
-	"wallet-api/internal/api"
+	"wallet-api/api"
+	"wallet-api/internal/i18n"
 	"wallet-api/internal/middleware"
 	"wallet-api/internal/pkg"
 	"wallet-api/internal/services"
 )
 
+// streamHeartbeat is how often idle streams get a comment line
+const streamHeartbeat = 15 * time.Second
+
 type WalletHandler struct {
-	WalletService services.WalletServices
-	Validator     *validator.Validate
-	JwtSecret     string
+	WalletService  services.WalletServices
+	Validator      *validator.Validate
+	JwtSecret      string
+	Cache          *redis.Client
+	IdempotencyTTL time.Duration
+	// closed on shutdown so the streams end instead of holding the server until its deadline
+	stopping chan struct{}
+	stopOnce sync.Once
 }
 
-func NewWalletHandler(service *services.WalletService, jwtSecret string) *WalletHandler {
+func NewWalletHandler(service *services.WalletService, jwtSecret string, idempotencyTTL time.Duration) *WalletHandler {
 	return &WalletHandler{
-		WalletService: service,
-		Validator:     validator.New(),
-		JwtSecret:     jwtSecret,
+		WalletService:  service,
+		Validator:      i18n.Validator(),
+		JwtSecret:      jwtSecret,
+		Cache:          service.Cache,
+		IdempotencyTTL: idempotencyTTL,
+		stopping:       make(chan struct{}),
 	}
 }
 
+// Shutdown ends the event streams, the server waits for them to return like any other request
+func (handler *WalletHandler) Shutdown(context.Context) error {
+	handler.stopOnce.Do(func() { close(handler.stopping) })
+	return nil
+}
+
 // WalletRoutes sets up user routes with accompanying methods for processing
 func (handler *WalletHandler) WalletRoutes(r *gin.RouterGroup) {
 
-	r.Group("wallet", middleware.RequireAuth(handler.JwtSecret)).
+	r.Group("wallet", middleware.RequireAuth(handler.JwtSecret), middleware.Idempotency(handler.Cache, handler.IdempotencyTTL)).
 		// GET("", handler.getUserWallets).
 		// POST("new", handler.newWallet).
 		GET(":walletid/balance", handler.getWalletBalance).
 		POST(":walletid/credit", handler.creditWallet).
-		POST(":walletid/debit", handler.debitWallet)
+		POST(":walletid/debit", handler.debitWallet).
+		POST(":walletid/transfer", handler.transferFunds).
+		GET(":walletid/stream", handler.streamWallet)
+
+	// the game servers credit the wins to the players' wallets, the players can't send their credits as wins
+	r.Group("gaming/wallets", middleware.RequireGameServer(handler.JwtSecret), middleware.Idempotency(handler.Cache, handler.IdempotencyTTL)).
+		POST(":walletid/wins", handler.creditWin)
 
 	return
 }
@@ -46,24 +76,24 @@ func (handler *WalletHandler) getWalletBalance(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	uID := userID.(int)
 	if uID == 0 {
-		c.AbortWithStatusJSON(http.StatusBadRequest, api.GenerateMessageResponse("invalid user id", nil, fmt.Errorf("no user id saved from token or cannot be parsed: %d", uID)))
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "invalid user id", fmt.Errorf("no user id saved from token or cannot be parsed: %d", uID))
 		return
 	}
 
 	walletID := c.Param("walletid")
 	wID, err := strconv.Atoi(walletID)
 	if wID == 0 || err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, api.GenerateMessageResponse("failed to get walletID from url", nil, fmt.Errorf("missing url")))
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "failed to get walletID from url", fmt.Errorf("missing url"))
 		return
 	}
 
-	user, err := handler.WalletService.Balance(uID, wID)
+	user, err := handler.WalletService.Balance(c.Request.Context(), uID, wID)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.GenerateMessageResponse("failed to get user by walletID", nil, err))
+		middleware.AbortWithProblem(c, walletErrorCode(err), "failed to get user by walletID", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, api.GenerateMessageResponse("successfully grabbed wallet balance", user, nil))
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "successfully grabbed wallet balance"), user, nil))
 	return
 }
 
@@ -71,46 +101,57 @@ func (handler *WalletHandler) creditWallet(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	uID := userID.(int)
 	if uID == 0 {
-		c.AbortWithStatusJSON(http.StatusBadRequest, api.GenerateMessageResponse("invalid user id", nil, fmt.Errorf("no user id saved from token or cannot be parsed: %d", uID)))
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "invalid user id", fmt.Errorf("no user id saved from token or cannot be parsed: %d", uID))
 		return
 	}
 
 	walletID := c.Param("walletid")
 	wID, err := strconv.Atoi(walletID)
 	if wID == 0 || err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, api.GenerateMessageResponse("failed to get walletID from url", nil, fmt.Errorf("missing url")))
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "failed to get walletID from url", fmt.Errorf("missing url"))
 		return
 	}
 
 	var creditRequest api.CreditRequest
 	if err = c.ShouldBindJSON(&creditRequest); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, api.GenerateMessageResponse("failed to get json body", nil, err))
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "failed to get json body", err)
 		return
 	}
 
 	creditRequest.WalletId = wID
 	creditRequest.UserId = uID
 
-	user, err := handler.WalletService.Credit(&creditRequest)
+	user, err := handler.WalletService.Credit(c.Request.Context(), &creditRequest)
 	if err != nil {
-		var code int
-
-		switch err.Error() {
-		case gorm.ErrRecordNotFound.Error():
-			code = http.StatusNotFound
-		case pkg.WrongAmount:
-			code = http.StatusBadRequest
-		case pkg.NotEnoughFunds:
-			code = http.StatusNotAcceptable
-		default:
-			code = http.StatusInternalServerError
-		}
+		middleware.AbortWithProblem(c, walletErrorCode(err), "failed to credit wallet", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "credit wallet successful"), user, nil))
+	return
+}
+
+func (handler *WalletHandler) creditWin(c *gin.Context) {
+	wID, ok := pathID(c, "walletid")
+	if !ok {
+		return
+	}
+
+	var winRequest api.WinRequest
+	if err := c.ShouldBindJSON(&winRequest); err != nil {
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "failed to get json body", err)
+		return
+	}
 
-		c.AbortWithStatusJSON(code, api.GenerateMessageResponse("failed to credit wallet", nil, err))
+	winRequest.WalletId = wID
+
+	credit, err := handler.WalletService.CreditWin(c.Request.Context(), &winRequest)
+	if err != nil {
+		middleware.AbortWithProblem(c, walletErrorCode(err), "failed to credit win", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, api.GenerateMessageResponse("credit wallet successful", user, nil))
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "credit win successful"), credit, nil))
 	return
 }
 
@@ -118,45 +159,158 @@ func (handler *WalletHandler) debitWallet(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	uID := userID.(int)
 	if uID == 0 {
-		c.AbortWithStatusJSON(http.StatusBadRequest, api.GenerateMessageResponse("invalid user id", nil, fmt.Errorf("no user id saved from token or cannot be parsed: %d", uID)))
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "invalid user id", fmt.Errorf("no user id saved from token or cannot be parsed: %d", uID))
 		return
 	}
 
 	walletID := c.Param("walletid")
 	wID, err := strconv.Atoi(walletID)
 	if wID == 0 || err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, api.GenerateMessageResponse("failed to get walletID from url", nil, fmt.Errorf("missing url")))
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "failed to get walletID from url", fmt.Errorf("missing url"))
 		return
 	}
 
 	var debitRequest api.DebitRequest
 	if err = c.ShouldBindJSON(&debitRequest); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, api.GenerateMessageResponse("failed to get json body", nil, err))
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "failed to get json body", err)
 		return
 	}
 
 	debitRequest.WalletId = wID
 	debitRequest.UserId = uID
 
-	user, err := handler.WalletService.Debit(&debitRequest)
+	user, err := handler.WalletService.Debit(c.Request.Context(), &debitRequest)
 	if err != nil {
-		var code int
-
-		switch err.Error() {
-		case gorm.ErrRecordNotFound.Error():
-			code = http.StatusNotFound
-		case pkg.WrongAmount:
-			code = http.StatusBadRequest
-		case pkg.NotEnoughFunds:
-			code = http.StatusNotAcceptable
-		default:
-			code = http.StatusInternalServerError
-		}
+		middleware.AbortWithProblem(c, walletErrorCode(err), "failed to debit wallet", err)
+		return
+	}
+
+	if user.Status == pkg.TransactionPending {
+		c.JSON(http.StatusAccepted, api.GenerateMessageResponse(middleware.Translate(c, "debit awaiting guardian approval"), user, nil))
+		return
+	}
+
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "debit wallet successful"), user, nil))
+	return
+}
+
+func (handler *WalletHandler) transferFunds(c *gin.Context) {
+	uID, ok := tokenUserID(c)
+	if !ok {
+		return
+	}
+
+	wID, ok := pathID(c, "walletid")
+	if !ok {
+		return
+	}
+
+	var transferRequest api.TransferRequest
+	if err := c.ShouldBindJSON(&transferRequest); err != nil {
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "failed to get json body", err)
+		return
+	}
 
-		c.AbortWithStatusJSON(code, api.GenerateMessageResponse("failed to debit wallet", nil, err))
+	transferRequest.WalletId = wID
+	transferRequest.UserId = uID
+
+	res, err := handler.WalletService.Transfer(c.Request.Context(), &transferRequest)
+	if err != nil {
+		middleware.AbortWithProblem(c, walletErrorCode(err), "failed to transfer funds", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, api.GenerateMessageResponse("debit wallet successful", user, nil))
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "transfer successful"), res, nil))
 	return
 }
+
+// streamWallet sends the balance followed by the wallet's events as server-sent events until the client goes away
+func (handler *WalletHandler) streamWallet(c *gin.Context) {
+	uID, ok := tokenUserID(c)
+	if !ok {
+		return
+	}
+
+	wID, ok := pathID(c, "walletid")
+	if !ok {
+		return
+	}
+
+	payloads, err := handler.WalletService.Subscribe(c.Request.Context(), uID, wID)
+	if err != nil {
+		middleware.AbortWithProblem(c, walletErrorCode(err), "failed to stream wallet", err)
+		return
+	}
+
+	balance, err := handler.WalletService.Balance(c.Request.Context(), uID, wID)
+	if err != nil {
+		middleware.AbortWithProblem(c, walletErrorCode(err), "failed to get wallet balance", err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("balance", balance)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	// the token isn't checked again once streaming, the stream ends when it expires
+	expiry := time.NewTimer(time.Until(middleware.TokenExpiresAt(c)))
+	defer expiry.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case payload, ok := <-payloads:
+			if !ok {
+				return false
+			}
+			c.SSEvent("transaction", payload)
+		case <-heartbeat.C:
+			// comment lines keep proxies from closing idle connections
+			_, _ = io.WriteString(w, ": ping\n\n")
+		case <-handler.stopping:
+			// the client reconnects to another instance
+			return false
+		case <-expiry.C:
+			// the client reconnects with a fresh token
+			c.SSEvent("expired", "token expired")
+			return false
+		}
+		return true
+	})
+}
+
+// walletErrorCode maps the errors returned by the wallet service to the response status
+func walletErrorCode(err error) int {
+	var limitErr *pkg.LimitError
+	if errors.As(err, &limitErr) {
+		if limitErr.Limit == pkg.LimitVelocity {
+			return http.StatusTooManyRequests
+		}
+		return http.StatusUnprocessableEntity
+	}
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, pkg.ErrWrongAmount), errors.Is(err, pkg.ErrSameWallet):
+		return http.StatusBadRequest
+	case errors.Is(err, pkg.ErrNotEnoughFunds):
+		return http.StatusNotAcceptable
+	case errors.Is(err, pkg.ErrWalletIsFrozen):
+		return http.StatusLocked
+	case errors.Is(err, pkg.ErrWalletIsClosed):
+		return http.StatusGone
+	case errors.Is(err, pkg.ErrTooManySubscriptions):
+		return http.StatusTooManyRequests
+	case errors.Is(err, pkg.ErrCategoryBlocked), errors.Is(err, pkg.ErrSpendLimitReached), errors.Is(err, pkg.ErrTransferNeedsApproval),
+		errors.Is(err, pkg.ErrSelfExcluded), errors.Is(err, pkg.ErrCoolingOff), errors.Is(err, pkg.ErrDepositLimitReached),
+		errors.Is(err, pkg.ErrLossLimitReached), errors.Is(err, pkg.ErrBalanceCapReached), errors.Is(err, pkg.ErrTransferNotAllowed),
+		errors.Is(err, pkg.ErrGameServerOnly):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redismock/v9"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+
+	"wallet-api/internal/pkg"
+)
+
+// Subscribe hands out a channel nothing is published to, closed along with the request
+func (f *fakeWallets) Subscribe(ctx context.Context, _, _ int) (<-chan string, error) {
+	payloads := make(chan string)
+	go func() {
+		<-ctx.Done()
+		close(payloads)
+	}()
+
+	return payloads, nil
+}
+
+func TestStreamTokenExpiry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	rd, _ := redismock.NewClientMock()
+	handler := &WalletHandler{
+		WalletService:  &fakeWallets{},
+		JwtSecret:      socketTestSecret,
+		Cache:          rd,
+		IdempotencyTTL: time.Hour,
+		stopping:       make(chan struct{}),
+	}
+
+	router := gin.New()
+	handler.WalletRoutes(router.Group("/v1"))
+
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":  1,
+		"role": pkg.RoleUser,
+		"typ":  pkg.TokenAccess,
+		"exp":  time.Now().Add(time.Second).Unix(),
+	}).SignedString([]byte(socketTestSecret))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/v1/wallet/1/stream", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	// the body ends once the token expires, before the timeout
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "event:balance")
+	require.Contains(t, string(body), "event:expired")
+}
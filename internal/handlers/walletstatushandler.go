@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+
+	"wallet-api/api"
+	"wallet-api/internal/i18n"
+	"wallet-api/internal/middleware"
+	"wallet-api/internal/pkg"
+	"wallet-api/internal/services"
+)
+
+type WalletStatusHandler struct {
+	WalletStatusService services.WalletStatusServices
+	Validator           *validator.Validate
+	JwtSecret           string
+}
+
+func NewWalletStatusHandler(service *services.WalletStatusService, jwtSecret string) *WalletStatusHandler {
+	return &WalletStatusHandler{
+		WalletStatusService: service,
+		Validator:           i18n.Validator(),
+		JwtSecret:           jwtSecret,
+	}
+}
+
+// WalletStatusRoutes sets up the admin routes freezing, unfreezing and closing wallets
+func (handler *WalletStatusHandler) WalletStatusRoutes(r *gin.RouterGroup) {
+
+	r.Group("admin/wallets/:walletid", middleware.RequireAdmin(handler.JwtSecret)).
+		GET("status", handler.getStatus).
+		POST("freeze", handler.changeStatus(handler.WalletStatusService.Freeze, "freeze")).
+		POST("unfreeze", handler.changeStatus(handler.WalletStatusService.Unfreeze, "unfreeze")).
+		POST("close", handler.changeStatus(handler.WalletStatusService.Close, "close"))
+
+	return
+}
+
+func (handler *WalletStatusHandler) getStatus(c *gin.Context) {
+	wID, ok := pathID(c, "walletid")
+	if !ok {
+		return
+	}
+
+	status, err := handler.WalletStatusService.GetStatus(c.Request.Context(), wID)
+	if err != nil {
+		middleware.AbortWithProblem(c, walletStatusErrorCode(err), "failed to get wallet status", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "successfully grabbed wallet status"), status, nil))
+	return
+}
+
+// changeStatus builds the handler for one of the status changes, they only differ in the service call
+func (handler *WalletStatusHandler) changeStatus(
+	change func(ctx context.Context, adminID, walletID int, req *api.WalletStatusRequest) (*api.WalletStatusResponse, error),
+	action string,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminID, ok := tokenUserID(c)
+		if !ok {
+			return
+		}
+
+		wID, ok := pathID(c, "walletid")
+		if !ok {
+			return
+		}
+
+		var statusRequest api.WalletStatusRequest
+		if err := c.ShouldBindJSON(&statusRequest); err != nil {
+			middleware.AbortWithProblem(c, http.StatusBadRequest, "failed to get json body", err)
+			return
+		}
+
+		if err := handler.Validator.Struct(statusRequest); err != nil {
+			middleware.AbortWithProblem(c, http.StatusBadRequest, "missing or incorrect data received", err)
+			return
+		}
+
+		status, err := change(c.Request.Context(), adminID, wID, &statusRequest)
+		if err != nil {
+			middleware.AbortWithProblem(c, walletStatusErrorCode(err), "failed to "+action+" wallet", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "successfully changed wallet status"), status, nil))
+		return
+	}
+}
+
+func walletStatusErrorCode(err error) int {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, pkg.ErrInvalidStatusChange), errors.Is(err, pkg.ErrWalletNotEmpty):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
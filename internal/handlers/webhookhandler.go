@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+
+	"wallet-api/api"
+	"wallet-api/internal/i18n"
+	"wallet-api/internal/middleware"
+	"wallet-api/internal/pkg"
+	"wallet-api/internal/services"
+)
+
+type WebhookHandler struct {
+	WebhookService services.WebhookServices
+	Validator      *validator.Validate
+	JwtSecret      string
+}
+
+func NewWebhookHandler(service *services.WebhookService, jwtSecret string) *WebhookHandler {
+	return &WebhookHandler{
+		WebhookService: service,
+		Validator:      i18n.Validator(),
+		JwtSecret:      jwtSecret,
+	}
+}
+
+// WebhookRoutes sets up the routes managing the user's webhooks and their deliveries
+func (handler *WebhookHandler) WebhookRoutes(r *gin.RouterGroup) {
+
+	r.Group("webhooks", middleware.RequireAuth(handler.JwtSecret)).
+		GET("", handler.getWebhooks).
+		POST("", handler.createWebhook).
+		DELETE(":webhookid", handler.deleteWebhook).
+		GET(":webhookid/deliveries", handler.getDeliveries).
+		POST(":webhookid/deliveries/:deliveryid/redeliver", handler.redeliver)
+
+	return
+}
+
+func (handler *WebhookHandler) getWebhooks(c *gin.Context) {
+	uID, ok := tokenUserID(c)
+	if !ok {
+		return
+	}
+
+	webhooks, err := handler.WebhookService.GetWebhooks(c.Request.Context(), uID)
+	if err != nil {
+		middleware.AbortWithProblem(c, webhookErrorCode(err), "failed to get webhooks", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "successfully grabbed webhooks"), webhooks, nil))
+	return
+}
+
+func (handler *WebhookHandler) createWebhook(c *gin.Context) {
+	uID, ok := tokenUserID(c)
+	if !ok {
+		return
+	}
+
+	var webhookRequest api.WebhookRequest
+	if err := c.ShouldBindJSON(&webhookRequest); err != nil {
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "failed to get json body", err)
+		return
+	}
+
+	if err := handler.Validator.Struct(webhookRequest); err != nil {
+		middleware.AbortWithProblem(c, http.StatusBadRequest, "missing or incorrect data received", err)
+		return
+	}
+
+	webhook, err := handler.WebhookService.CreateWebhook(c.Request.Context(), uID, &webhookRequest)
+	if err != nil {
+		middleware.AbortWithProblem(c, webhookErrorCode(err), "failed to create webhook", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, api.GenerateMessageResponse(middleware.Translate(c, "successfully created webhook"), webhook, nil))
+	return
+}
+
+func (handler *WebhookHandler) deleteWebhook(c *gin.Context) {
+	uID, ok := tokenUserID(c)
+	if !ok {
+		return
+	}
+
+	webhookID, ok := pathID(c, "webhookid")
+	if !ok {
+		return
+	}
+
+	if err := handler.WebhookService.DeleteWebhook(c.Request.Context(), uID, webhookID); err != nil {
+		middleware.AbortWithProblem(c, webhookErrorCode(err), "failed to delete webhook", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "successfully deleted webhook"), nil, nil))
+	return
+}
+
+func (handler *WebhookHandler) getDeliveries(c *gin.Context) {
+	uID, ok := tokenUserID(c)
+	if !ok {
+		return
+	}
+
+	webhookID, ok := pathID(c, "webhookid")
+	if !ok {
+		return
+	}
+
+	deliveries, err := handler.WebhookService.GetDeliveries(c.Request.Context(), uID, webhookID)
+	if err != nil {
+		middleware.AbortWithProblem(c, webhookErrorCode(err), "failed to get webhook deliveries", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "successfully grabbed webhook deliveries"), deliveries, nil))
+	return
+}
+
+func (handler *WebhookHandler) redeliver(c *gin.Context) {
+	uID, ok := tokenUserID(c)
+	if !ok {
+		return
+	}
+
+	webhookID, ok := pathID(c, "webhookid")
+	if !ok {
+		return
+	}
+
+	deliveryID, ok := pathID(c, "deliveryid")
+	if !ok {
+		return
+	}
+
+	delivery, err := handler.WebhookService.Redeliver(c.Request.Context(), uID, webhookID, deliveryID)
+	if err != nil {
+		middleware.AbortWithProblem(c, webhookErrorCode(err), "failed to redeliver webhook", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.GenerateMessageResponse(middleware.Translate(c, "successfully redelivered webhook"), delivery, nil))
+	return
+}
+
+func webhookErrorCode(err error) int {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return http.StatusNotFound
+	}
+
+	if errors.Is(err, pkg.ErrInvalidWebhookURL) {
+		return http.StatusBadRequest
+	}
+
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,160 @@
+// Package i18n translates the messages sent to clients. The English messages written in the code are the keys of the
+// catalogues in locales, one json file per language, so a message missing from a catalogue is sent in English.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/locales"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/es"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	es_translations "github.com/go-playground/validator/v10/translations/es"
+	"golang.org/x/text/language"
+
+	"wallet-api/internal/pkg"
+)
+
+//go:embed locales/*.json
+var files embed.FS
+
+// Default is the language of the messages in the code, sent when none of the ones asked for is supported
+const Default = "en"
+
+// supported are the languages with a catalogue, the validator's translations of their messages and their locale.
+// Default comes first as the matcher falls back to it.
+var supported = []struct {
+	tag        string
+	locale     locales.Translator
+	validation func(*validator.Validate, ut.Translator) error
+}{
+	{tag: Default, locale: en.New(), validation: en_translations.RegisterDefaultTranslations},
+	{tag: "es", locale: es.New(), validation: es_translations.RegisterDefaultTranslations},
+}
+
+var (
+	catalogues = make(map[string]map[string]string)
+	matcher    language.Matcher
+	universal  *ut.UniversalTranslator
+	// validate is shared by the handlers, the translations of its messages can only be registered once per language
+	validate *validator.Validate
+)
+
+func init() {
+	tags := make([]language.Tag, 0, len(supported))
+	translators := make([]locales.Translator, 0, len(supported))
+
+	for _, lang := range supported {
+		tags = append(tags, language.MustParse(lang.tag))
+		translators = append(translators, lang.locale)
+
+		// the messages in the code are already in the default language
+		if lang.tag == Default {
+			continue
+		}
+
+		raw, err := files.ReadFile("locales/" + lang.tag + ".json")
+		if err != nil {
+			panic(fmt.Sprintf("missing catalogue for %s: %v", lang.tag, err))
+		}
+
+		catalogue := make(map[string]string)
+		if err = json.Unmarshal(raw, &catalogue); err != nil {
+			panic(fmt.Sprintf("catalogue for %s is invalid: %v", lang.tag, err))
+		}
+		catalogues[lang.tag] = catalogue
+	}
+
+	matcher = language.NewMatcher(tags)
+	universal = ut.New(translators[0], translators...)
+	validate = newValidator()
+}
+
+// Match returns the supported language closest to the ones of an Accept-Language header, or Default
+func Match(acceptLanguage string) string {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return Default
+	}
+
+	_, index, confidence := matcher.Match(tags...)
+	if confidence == language.No {
+		return Default
+	}
+
+	return supported[index].tag
+}
+
+// Translate returns the message in the language, or as it is when the catalogue doesn't have it
+func Translate(lang, message string) string {
+	if translated, ok := catalogues[lang][message]; ok {
+		return translated
+	}
+
+	return message
+}
+
+// Error translates the message of the error, the validation and limit errors are put back together from their parts
+func Error(lang string, err error) string {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		return ValidationErrors(lang, validationErrs)
+	}
+
+	var limitErr *pkg.LimitError
+	if errors.As(err, &limitErr) {
+		operation := Translate(lang, limitErr.Operation)
+		if limitErr.Limit == pkg.LimitVelocity {
+			return fmt.Sprintf(Translate(lang, pkg.VelocityLimitExceeded), operation, limitErr.Max)
+		}
+
+		return fmt.Sprintf(Translate(lang, pkg.LimitExceeded), operation, Translate(lang, limitErr.Limit), limitErr.Max/100, limitErr.Max%100)
+	}
+
+	return Translate(lang, err.Error())
+}
+
+// ValidationErrors joins the translated failures of each field, which are named after their json keys
+func ValidationErrors(lang string, errs validator.ValidationErrors) string {
+	trans, _ := universal.GetTranslator(lang)
+
+	messages := make([]string, 0, len(errs))
+	for _, fieldErr := range errs {
+		messages = append(messages, fieldErr.Translate(trans))
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// Validator returns the validator whose errors can be translated in every supported language
+func Validator() *validator.Validate {
+	return validate
+}
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			return field.Name
+		}
+		return name
+	})
+
+	for _, lang := range supported {
+		trans, _ := universal.GetTranslator(lang.tag)
+		if err := lang.validation(v, trans); err != nil {
+			panic(fmt.Sprintf("something went wrong registering the %s validation messages: %v", lang.tag, err))
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,171 @@
+// Package lifecycle runs the servers and background workers of the api and stops them in order, so a deploy doesn't cut
+// the credits and debits in flight.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Settings used to affect code flow
+type Settings struct {
+	// ShutdownTimeout is the time the requests in flight and the workers get to finish once a stop is asked for
+	ShutdownTimeout time.Duration
+}
+
+// App holds what the api runs. Servers are stopped first and drain their requests, then the workers are cancelled and
+// waited for, and last the connections are closed in the reverse order they were added. Connections are left open when
+// the workers didn't stop in time, as they may still be writing through them.
+type App struct {
+	logger   *zap.Logger
+	settings Settings
+	servers  []server
+	stoppers []hook
+	workers  []worker
+	closers  []hook
+}
+
+type server struct {
+	name  string
+	serve func() error
+}
+
+type worker struct {
+	name string
+	run  func(context.Context)
+}
+
+type hook struct {
+	name string
+	fn   func(context.Context) error
+}
+
+func New(logger *zap.Logger, settings Settings) *App {
+	return &App{
+		logger:   logger,
+		settings: settings,
+	}
+}
+
+// Serve adds a server. serve blocks until the server fails or is stopped, when it must return nil, and shutdown stops
+// accepting work and waits for the work in flight until the context is done.
+func (app *App) Serve(name string, serve func() error, shutdown func(context.Context) error) {
+	app.servers = append(app.servers, server{name: name, serve: serve})
+	app.OnShutdown(name, shutdown)
+}
+
+// OnShutdown adds work to drain alongside the servers, like connections taken over from them
+func (app *App) OnShutdown(name string, fn func(context.Context) error) {
+	app.stoppers = append(app.stoppers, hook{name: name, fn: fn})
+}
+
+// Worker adds a background worker, run must return once its context is cancelled
+func (app *App) Worker(name string, run func(context.Context)) {
+	app.workers = append(app.workers, worker{name: name, run: run})
+}
+
+// OnClose adds a connection to close once nothing uses it anymore
+func (app *App) OnClose(name string, fn func(context.Context) error) {
+	app.closers = append(app.closers, hook{name: name, fn: fn})
+}
+
+// Run starts the workers and servers and blocks until the context is done or a server fails, then stops everything
+func (app *App) Run(ctx context.Context) error {
+	workersCtx, cancelWorkers := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWorkers()
+
+	var workers sync.WaitGroup
+	for _, w := range app.workers {
+		w := w
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			w.run(workersCtx)
+			app.logger.Info("worker stopped", zap.String("worker", w.name))
+		}()
+	}
+
+	failed := make(chan error, len(app.servers))
+	for _, s := range app.servers {
+		s := s
+		go func() {
+			if err := s.serve(); err != nil {
+				failed <- fmt.Errorf("%s server: %w", s.name, err)
+			}
+		}()
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		app.logger.Info("🛑 shutting down", zap.Duration("timeout", app.settings.ShutdownTimeout))
+	case err = <-failed:
+		app.logger.Error("❌ server failed, shutting down", zap.Error(err))
+	}
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), app.settings.ShutdownTimeout)
+	defer cancel()
+
+	errs := []error{err}
+
+	// the servers drain side by side, each stops taking requests straight away
+	errs = append(errs, runHooks(stopCtx, app.stoppers, true)...)
+	app.logger.Info("✅ servers stopped")
+
+	cancelWorkers()
+
+	stopped := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-stopCtx.Done():
+		app.logger.Error("❌ workers didn't stop in time, leaving the connections open")
+		errs = append(errs, fmt.Errorf("waiting for the workers: %w", stopCtx.Err()))
+		return errors.Join(errs...)
+	}
+
+	closers := slices.Clone(app.closers)
+	slices.Reverse(closers)
+	errs = append(errs, runHooks(stopCtx, closers, false)...)
+
+	return errors.Join(errs...)
+}
+
+// runHooks runs the hooks one after the other, or all at once when concurrent, returning their errors
+func runHooks(ctx context.Context, hooks []hook, concurrent bool) []error {
+	errs := make([]error, len(hooks))
+
+	var wg sync.WaitGroup
+	for i, h := range hooks {
+		i, h := i, h
+		run := func() {
+			if err := h.fn(ctx); err != nil {
+				errs[i] = fmt.Errorf("stopping %s: %w", h.name, err)
+			}
+		}
+
+		if !concurrent {
+			run()
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run()
+		}()
+	}
+	wg.Wait()
+
+	return errs
+}
@@ -0,0 +1,115 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// steps records what the app ran in order
+type steps struct {
+	mu   sync.Mutex
+	done []string
+}
+
+func (s *steps) add(step string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.done = append(s.done, step)
+}
+
+func (s *steps) list() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.done
+}
+
+// testServer serves until it's shut down
+func testServer(app *App, s *steps, name string) {
+	stop := make(chan struct{})
+	app.Serve(name, func() error {
+		<-stop
+		return nil
+	}, func(context.Context) error {
+		s.add("stop " + name)
+		close(stop)
+		return nil
+	})
+}
+
+func testClosers(app *App, s *steps) {
+	app.OnClose("mysql", func(context.Context) error {
+		s.add("close mysql")
+		return nil
+	})
+	app.OnClose("redis", func(context.Context) error {
+		s.add("close redis")
+		return nil
+	})
+}
+
+func TestRun(t *testing.T) {
+	t.Run("Servers drain before the workers stop and the connections close last", func(t *testing.T) {
+		var s steps
+		app := New(zap.NewNop(), Settings{ShutdownTimeout: time.Second})
+
+		testServer(app, &s, "http")
+		app.Worker("relay", func(ctx context.Context) {
+			<-ctx.Done()
+			s.add("stop relay")
+		})
+		testClosers(app, &s)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		require.NoError(t, app.Run(ctx))
+		require.Equal(t, []string{"stop http", "stop relay", "close redis", "close mysql"}, s.list())
+	})
+
+	t.Run("Connections stay open when the workers time out", func(t *testing.T) {
+		var s steps
+		app := New(zap.NewNop(), Settings{ShutdownTimeout: 50 * time.Millisecond})
+
+		stuck := make(chan struct{})
+		defer close(stuck)
+
+		testServer(app, &s, "http")
+		app.Worker("relay", func(ctx context.Context) {
+			<-stuck
+		})
+		testClosers(app, &s)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := app.Run(ctx)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Equal(t, []string{"stop http"}, s.list())
+	})
+
+	t.Run("A failing server stops the others", func(t *testing.T) {
+		var s steps
+		app := New(zap.NewNop(), Settings{ShutdownTimeout: time.Second})
+
+		failure := errors.New("address already in use")
+		app.Serve("grpc", func() error { return failure }, func(context.Context) error {
+			s.add("stop grpc")
+			return nil
+		})
+		testServer(app, &s, "http")
+		testClosers(app, &s)
+
+		err := app.Run(context.Background())
+		require.ErrorIs(t, err, failure)
+		require.ElementsMatch(t, []string{"stop grpc", "stop http"}, s.list()[:2])
+		require.Equal(t, []string{"close redis", "close mysql"}, s.list()[2:])
+	})
+}
@@ -0,0 +1,25 @@
+// Package logging carries the logger of a request in its context, so the lines logged while handling it can be told
+// apart from the other requests' by their request id.
+package logging
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the logger
+func NewContext(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// From returns the logger of the request in ctx, or fallback for the work done outside of a request
+func From(ctx context.Context, fallback *zap.Logger) *zap.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*zap.Logger); ok {
+		return logger
+	}
+
+	return fallback
+}
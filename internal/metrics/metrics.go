@@ -0,0 +1,94 @@
+// Package metrics holds the prometheus collectors of the api, served at /metrics
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/shopspring/decimal"
+
+	"wallet-api/api"
+	"wallet-api/internal/pkg"
+)
+
+const (
+	namespace = "wallet_api"
+
+	// CodeOK is the code of the operations that went through
+	CodeOK = "ok"
+
+	CacheHit   = "hit"
+	CacheMiss  = "miss"
+	CacheError = "error"
+)
+
+var (
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Time taken to answer the http requests by route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	operations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "operations_total",
+		Help:      "Credits, debits and transfers by the code of their error, ok when they went through.",
+	}, []string{"operation", "code"})
+
+	volume = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "volume_total",
+		Help:      "Money moved by the credits, debits and transfers that went through.",
+	}, []string{"operation", "currency"})
+
+	balanceCache = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "balance_cache_requests_total",
+		Help:      "Balances read from redis by result, misses are read from the db.",
+	}, []string{"result"})
+)
+
+// ObserveRequest records how long the request to the route took, route is the pattern so ids don't make new series
+func ObserveRequest(method, route string, status int, elapsed time.Duration) {
+	requestDuration.WithLabelValues(method, route, strconv.Itoa(status)).Observe(elapsed.Seconds())
+}
+
+// RecordOperation counts the credit, debit or transfer by its error code, adding the amount to the volume when it went
+// through. Debits waiting for a guardian's approval are recorded once they're approved.
+func RecordOperation(operation string, amount decimal.Decimal, err error) {
+	if err != nil {
+		code := pkg.ErrorCode(err)
+		if code == "" {
+			code = api.CodeInternal
+		}
+
+		operations.WithLabelValues(operation, code).Inc()
+		return
+	}
+
+	operations.WithLabelValues(operation, CodeOK).Inc()
+	volume.WithLabelValues(operation, pkg.Currency).Add(amount.InexactFloat64())
+}
+
+// RecordBalanceCache counts a read of the balance cache, result is CacheHit, CacheMiss or CacheError
+func RecordBalanceCache(result string) {
+	balanceCache.WithLabelValues(result).Inc()
+}
+
+// RegisterDB exports the connection pool stats of the db
+func RegisterDB(db *sql.DB, name string) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler serves the collectors in the prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
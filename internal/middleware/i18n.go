@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"wallet-api/internal/i18n"
+)
+
+// Localize picks the language of the responses from the Accept-Language header, falling back to English
+func Localize() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lang := i18n.Match(c.GetHeader("Accept-Language"))
+
+		c.Set("lang", lang)
+		c.Header("Content-Language", lang)
+		c.Header("Vary", "Accept-Language")
+
+		c.Next()
+	}
+}
+
+// Language returns the language picked by Localize for the request
+func Language(c *gin.Context) string {
+	if lang := c.GetString("lang"); lang != "" {
+		return lang
+	}
+
+	return i18n.Default
+}
+
+// Translate returns the message in the language of the request
+func Translate(c *gin.Context, message string) string {
+	return i18n.Translate(Language(c), message)
+}
@@ -0,0 +1,209 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"wallet-api/api"
+	"wallet-api/internal/pkg"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotencyReplayedHeader = "Idempotency-Replayed"
+
+	// maxIdempotencyKey keeps clients from filling redis with huge keys
+	maxIdempotencyKey = 255
+
+	// pendingLease is how long the key is held while the first request runs, longer than the request timeouts, so a key
+	// left by an instance dying mid request frees up instead of answering 409 until the ttl
+	pendingLease = time.Minute
+)
+
+// idempotentResponse is saved under the key, a zero status means the first request is still being handled
+type idempotentResponse struct {
+	Fingerprint string `json:"fingerprint"`
+	Status      int    `json:"status"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// responseRecorder keeps a copy of what the handler writes so it can be replayed
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// ErrIdempotencyKeyTooLong keeps clients from filling redis with huge keys
+var ErrIdempotencyKeyTooLong = fmt.Errorf("key longer than %d characters", maxIdempotencyKey)
+
+// Idempotency replays the saved response when a request is sent again with the same Idempotency-Key, so clients can retry
+// without crediting or debiting twice. Keys are per user and their responses kept for ttl, requests without one go
+// through as usual.
+// It must run after RequireAuth.
+func Idempotency(rc *redis.Client, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" || c.Request.Method != http.MethodPost {
+			c.Next()
+			return
+		}
+
+		if len(key) > maxIdempotencyKey {
+			AbortWithProblem(c, http.StatusBadRequest, "invalid idempotency key", ErrIdempotencyKeyTooLong)
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			AbortWithProblem(c, http.StatusBadRequest, "failed to read body", err)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := IdempotencyFingerprint(c.Request.URL.Path, body)
+		redisKey := idempotencyRedisKey(c.GetInt("user_id"), key)
+		ctx := c.Request.Context()
+
+		ok, err := claimIdempotencyKey(ctx, rc, redisKey, fingerprint)
+		if err != nil {
+			AbortWithProblem(c, http.StatusInternalServerError, "something went wrong checking the idempotency key", err)
+			return
+		}
+
+		if !ok {
+			replay(c, rc, redisKey, fingerprint)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		c.Next()
+
+		// the key is saved even when the request timed out or its client left
+		saveIdempotentResponse(context.WithoutCancel(ctx), rc, redisKey, idempotentResponse{
+			Fingerprint: fingerprint,
+			Status:      c.Writer.Status(),
+			Body:        recorder.body.Bytes(),
+		}, ttl)
+	}
+}
+
+// Idempotent runs do the first time the user sends the key and returns the body it saved, replayed, when the same
+// request is sent again with it, like Idempotency does for http requests. The keys are shared with them.
+func Idempotent(ctx context.Context, rc *redis.Client, ttl time.Duration, userID int, key, fingerprint string, do func() (int, []byte)) (body []byte, replayed bool, err error) {
+	if len(key) > maxIdempotencyKey {
+		return nil, false, ErrIdempotencyKeyTooLong
+	}
+
+	redisKey := idempotencyRedisKey(userID, key)
+
+	ok, err := claimIdempotencyKey(ctx, rc, redisKey, fingerprint)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !ok {
+		saved, err := savedResponse(ctx, rc, redisKey, fingerprint)
+		if err != nil {
+			return nil, false, err
+		}
+		return saved.Body, true, nil
+	}
+
+	status, body := do()
+	saveIdempotentResponse(context.WithoutCancel(ctx), rc, redisKey, idempotentResponse{Fingerprint: fingerprint, Status: status, Body: body}, ttl)
+
+	return body, false, nil
+}
+
+// IdempotencyFingerprint tells requests apart, the same key sent for another request is a client bug as the saved
+// response would be wrong for it
+func IdempotencyFingerprint(path string, body []byte) string {
+	sum := sha256.Sum256(append([]byte(path+"\n"), body...))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func idempotencyRedisKey(userID int, key string) string {
+	return fmt.Sprintf("idempotency:%d:%s", userID, key)
+}
+
+// claimIdempotencyKey saves the key as pending, false means it was already used
+func claimIdempotencyKey(ctx context.Context, rc *redis.Client, redisKey, fingerprint string) (bool, error) {
+	pending, _ := json.Marshal(idempotentResponse{Fingerprint: fingerprint})
+
+	return rc.SetNX(ctx, redisKey, string(pending), pendingLease).Result()
+}
+
+// saveIdempotentResponse keeps the response for ttl. Server errors roll back and rate limited or canceled requests never
+// ran, the key is freed so the retry runs again.
+func saveIdempotentResponse(ctx context.Context, rc *redis.Client, redisKey string, res idempotentResponse, ttl time.Duration) {
+	if res.Status >= http.StatusInternalServerError || res.Status == http.StatusTooManyRequests || res.Status == api.StatusClientClosedRequest {
+		rc.Del(ctx, redisKey)
+		return
+	}
+
+	saved, _ := json.Marshal(res)
+	rc.Set(ctx, redisKey, string(saved), ttl)
+}
+
+// savedResponse gets the response saved for the key, failing when it was used for another request or its first request
+// is still running
+func savedResponse(ctx context.Context, rc *redis.Client, redisKey, fingerprint string) (*idempotentResponse, error) {
+	raw, err := rc.Get(ctx, redisKey).Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	var saved idempotentResponse
+	if err = json.Unmarshal(raw, &saved); err != nil {
+		return nil, err
+	}
+
+	if saved.Fingerprint != fingerprint {
+		return nil, pkg.ErrIdempotencyKeyReused
+	}
+
+	if saved.Status == 0 {
+		return nil, pkg.ErrIdempotencyKeyInProgress
+	}
+
+	return &saved, nil
+}
+
+// replay answers with the response saved for the key, or a conflict while the first request is still running
+func replay(c *gin.Context, rc *redis.Client, redisKey, fingerprint string) {
+	saved, err := savedResponse(c.Request.Context(), rc, redisKey, fingerprint)
+	switch {
+	case errors.Is(err, pkg.ErrIdempotencyKeyReused):
+		AbortWithProblem(c, http.StatusUnprocessableEntity, "idempotency key already used", err)
+		return
+	case errors.Is(err, pkg.ErrIdempotencyKeyInProgress):
+		AbortWithProblem(c, http.StatusConflict, "request still in progress", err)
+		return
+	case err != nil:
+		AbortWithProblem(c, http.StatusInternalServerError, "something went wrong checking the idempotency key", err)
+		return
+	}
+
+	c.Header(IdempotencyReplayedHeader, "true")
+	c.Data(saved.Status, gin.MIMEJSON, saved.Body)
+	c.Abort()
+}
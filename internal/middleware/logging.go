@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"wallet-api/internal/logging"
+)
+
+// RequestIDHeader carries the id of the request, sent back in the response and logged with every line of the request
+const RequestIDHeader = "X-Request-ID"
+
+// requestID is the shape of the ids taken from the callers, anything else is replaced so it can't forge log lines
+var requestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID keeps the X-Request-ID sent by the caller, a proxy or another service, or makes one up, and sends it back
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := EnsureRequestID(c.GetHeader(RequestIDHeader))
+
+		c.Set("request_id", id)
+		c.Header(RequestIDHeader, id)
+
+		c.Next()
+	}
+}
+
+// AccessLog puts a logger carrying the request and trace ids in the request's context, which the services log with, and
+// logs the request once it's answered. It replaces gin.Logger so every line is structured.
+func AccessLog(logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		fields := []zap.Field{zap.String("request_id", c.GetString("request_id"))}
+		if span := trace.SpanContextFromContext(c.Request.Context()); span.IsValid() {
+			fields = append(fields, zap.String("trace_id", span.TraceID().String()))
+		}
+		requestLogger := logger.With(fields...)
+
+		c.Request = c.Request.WithContext(logging.NewContext(c.Request.Context(), requestLogger))
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+
+		status := c.Writer.Status()
+		fields = []zap.Field{
+			zap.String("method", c.Request.Method),
+			zap.String("route", route),
+			zap.String("path", c.Request.URL.Path),
+			zap.Int("status", status),
+			zap.Duration("latency", time.Since(start)),
+			zap.String("client_ip", c.ClientIP()),
+			zap.Int("bytes", max(c.Writer.Size(), 0)),
+		}
+		if userID := c.GetInt("user_id"); userID != 0 {
+			fields = append(fields, zap.Int("user_id", userID))
+		}
+		if walletID, err := strconv.Atoi(c.Param("walletid")); err == nil {
+			fields = append(fields, zap.Int("wallet_id", walletID))
+		}
+
+		level := zapcore.InfoLevel
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = zapcore.ErrorLevel
+		case status >= http.StatusBadRequest:
+			level = zapcore.WarnLevel
+		}
+
+		requestLogger.Log(level, "request", fields...)
+	}
+}
+
+// EnsureRequestID returns the id received when it's a valid one, or a new random id
+func EnsureRequestID(received string) string {
+	if requestID.MatchString(received) {
+		return received
+	}
+
+	id := make([]byte, 16)
+	// crypto/rand doesn't fail on the supported platforms
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
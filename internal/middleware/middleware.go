@@ -11,64 +11,114 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 
-	"wallet-api/internal/api"
 	"wallet-api/internal/pkg"
 )
 
 func RequireAuth(jwtSecret string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		auth := c.Request.Header.Get("Authorization")
-		authSplit := strings.Split(auth, "Bearer ")
-		if len(authSplit) < 2 {
-			c.AbortWithStatusJSON(
-				http.StatusBadRequest,
-				api.GenerateMessageResponse("no token", nil, errors.New("missing token in request")),
-			)
+		if !authenticate(c, jwtSecret) {
 			return
 		}
-		tokenString := authSplit[1]
-		if tokenString == "" {
-			c.AbortWithStatusJSON(
-				http.StatusBadRequest,
-				api.GenerateMessageResponse("no token", nil, errors.New("missing token in request")),
-			)
+
+		c.Next()
+	}
+}
+
+// RequireAdmin validates the token like RequireAuth and only lets users with the admin role through
+func RequireAdmin(jwtSecret string) gin.HandlerFunc {
+	return requireRole(jwtSecret, pkg.RoleAdmin, "not an admin", pkg.ErrAdminOnly)
+}
+
+// RequireGameServer validates the token like RequireAuth and only lets users with the game server role through
+func RequireGameServer(jwtSecret string) gin.HandlerFunc {
+	return requireRole(jwtSecret, pkg.RoleGameServer, "not a game server", pkg.ErrGameServerOnly)
+}
+
+func requireRole(jwtSecret, role, title string, err error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authenticate(c, jwtSecret) {
 			return
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf(pkg.UnexpectedMethod, token.Header["alg"])
-			}
-			return []byte(jwtSecret), nil
-		})
-		if err != nil {
-			c.AbortWithStatusJSON(
-				http.StatusForbidden,
-				api.GenerateMessageResponse("something went wrong with teh token", nil, err),
-			)
+		if c.GetString("role") != role {
+			AbortWithProblem(c, http.StatusForbidden, title, err)
 			return
 		}
 
-		var userID int
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			userID, _ = strconv.Atoi(fmt.Sprint(claims["sub"]))
-			if float64(time.Now().Unix()) > claims["exp"].(float64) {
-				c.AbortWithStatusJSON(
-					http.StatusForbidden,
-					api.GenerateMessageResponse("expired token", nil, errors.New("token is no longer valid")),
-				)
-				return
-			}
-		} else {
-			c.AbortWithStatusJSON(
-				http.StatusForbidden,
-				api.GenerateMessageResponse("bad token", nil, errors.New("token is not valid")),
-			)
-			return
+		c.Next()
+	}
+}
+
+// authenticate parses the bearer token and saves the user's id and role in the context, aborting when it's invalid
+func authenticate(c *gin.Context, jwtSecret string) bool {
+	auth := c.Request.Header.Get("Authorization")
+	authSplit := strings.Split(auth, "Bearer ")
+	if len(authSplit) < 2 {
+		AbortWithProblem(c, http.StatusBadRequest, "no token", pkg.ErrMissingToken)
+		return false
+	}
+	tokenString := authSplit[1]
+	if tokenString == "" {
+		AbortWithProblem(c, http.StatusBadRequest, "no token", pkg.ErrMissingToken)
+		return false
+	}
+
+	userID, role, expiresAt, err := parseToken(tokenString, jwtSecret)
+	if err != nil {
+		msg := "bad token"
+		if errors.Is(err, pkg.ErrTokenExpired) {
+			msg = "expired token"
 		}
 
-		c.Set("user_id", userID)
+		AbortWithProblem(c, http.StatusForbidden, msg, err)
+		return false
+	}
 
-		c.Next()
+	c.Set("user_id", userID)
+	c.Set("role", role)
+	c.Set("token_expires_at", expiresAt)
+
+	return true
+}
+
+// TokenExpiresAt is when the request's token expires, for connections outliving the request to end with it
+func TokenExpiresAt(c *gin.Context) time.Time {
+	return c.GetTime("token_expires_at")
+}
+
+// ParseToken validates the token and returns the user's id and role saved in it, shared with the grpc interceptor
+func ParseToken(tokenString, jwtSecret string) (int, string, error) {
+	userID, role, _, err := parseToken(tokenString, jwtSecret)
+	return userID, role, err
+}
+
+func parseToken(tokenString, jwtSecret string) (int, string, time.Time, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf(pkg.UnexpectedMethod, token.Header["alg"])
+		}
+		return []byte(jwtSecret), nil
+	})
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return 0, "", time.Time{}, pkg.ErrTokenExpired
+		}
+		return 0, "", time.Time{}, pkg.ErrTokenInvalid
+	}
+
+	// refresh tokens would pass when both secrets are the same
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["typ"] != pkg.TokenAccess {
+		return 0, "", time.Time{}, pkg.ErrTokenInvalid
 	}
+
+	userID, _ := strconv.Atoi(fmt.Sprint(claims["sub"]))
+	role, _ := claims["role"].(string)
+
+	exp, ok := claims["exp"].(float64)
+	if !ok || float64(time.Now().Unix()) > exp {
+		return 0, "", time.Time{}, pkg.ErrTokenExpired
+	}
+
+	return userID, role, time.Unix(int64(exp), 0), nil
 }
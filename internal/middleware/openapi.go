@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+)
+
+// ValidateRequests checks the parameters and bodies of requests against the spec before they reach the handlers.
+// Tokens are left to RequireAuth and routes the spec doesn't know go through untouched so gin can answer them.
+func ValidateRequests(doc *openapi3.T) (gin.HandlerFunc, error) {
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	options := &openapi3filter.Options{
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		MultiError:         true,
+	}
+
+	return func(c *gin.Context) {
+		route, pathParams, err := router.FindRoute(c.Request)
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		// the handlers bind json whether or not the client says so, the spec only knows the json bodies
+		if c.Request.ContentLength != 0 && c.ContentType() == "" {
+			c.Request.Header.Set("Content-Type", gin.MIMEJSON)
+		}
+
+		err = openapi3filter.ValidateRequest(c.Request.Context(), &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    options,
+		})
+		if err != nil {
+			AbortWithProblem(c, http.StatusBadRequest, "request doesn't match the api spec", errors.New(validationError(err)))
+			return
+		}
+
+		c.Next()
+	}, nil
+}
+
+// validationError keeps the reason of each failure, the full errors repeat the schema and the value sent
+func validationError(err error) string {
+	var multi openapi3.MultiError
+	if !errors.As(err, &multi) {
+		multi = openapi3.MultiError{err}
+	}
+
+	reasons := make([]string, 0, len(multi))
+	for _, e := range multi {
+		reasons = append(reasons, reason(e))
+	}
+
+	return strings.Join(reasons, "; ")
+}
+
+func reason(err error) string {
+	var reqErr *openapi3filter.RequestError
+	if !errors.As(err, &reqErr) {
+		return err.Error()
+	}
+
+	var schemaErr *openapi3.SchemaError
+	if errors.As(reqErr.Err, &schemaErr) {
+		field := strings.Join(schemaErr.JSONPointer(), ".")
+		if reqErr.Parameter != nil {
+			field = reqErr.Parameter.Name
+		}
+		if field != "" {
+			return field + ": " + schemaErr.Reason
+		}
+		return schemaErr.Reason
+	}
+
+	return reqErr.Error()
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+
+	"wallet-api/api"
+	"wallet-api/internal/i18n"
+	"wallet-api/internal/pkg"
+)
+
+// AbortWithProblem ends the request with an application/problem+json body, the code comes from the error when it has one.
+// The title and detail are sent in the language of the request, the error is recorded on the request's span. Timed out
+// and canceled requests are answered with 504 and 499.
+func AbortWithProblem(c *gin.Context, status int, title string, err error) {
+	lang := Language(c)
+
+	// whatever the handler made of it, work cut short by the route's timeout or by the client leaving isn't a server error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		status = http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		status = api.StatusClientClosedRequest
+	}
+
+	problem := api.GenerateProblem(status, pkg.ErrorCode(err), i18n.Translate(lang, title), err)
+	problem.Instance = c.Request.URL.Path
+	if err != nil {
+		problem.Detail = i18n.Error(lang, err)
+		trace.SpanFromContext(c.Request.Context()).RecordError(err)
+	}
+
+	// gin keeps the content type already set when rendering json
+	c.Header("Content-Type", api.ProblemContentType)
+	c.AbortWithStatusJSON(status, problem)
+}
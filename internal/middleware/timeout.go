@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// versionPrefix is left out of the routes the timeouts are set for, a route has the same timeout in every version
+var versionPrefix = regexp.MustCompile(`^/v[0-9]+/`)
+
+// Timeout cancels the context of the request once the route's timeout has passed, stopping the db and redis calls made
+// for it. routes are keyed by method and route pattern without the version, e.g. "POST /wallet/:walletid/credit", the
+// routes missing get fallback and a timeout of 0 turns it off. Websockets are never timed out, the event stream has to be
+// set to 0.
+func Timeout(fallback time.Duration, routes map[string]time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout, ok := routes[c.Request.Method+" "+versionPrefix.ReplaceAllString(c.FullPath(), "/")]
+		if !ok {
+			timeout = fallback
+		}
+
+		if timeout <= 0 || c.IsWebsocket() {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	}
+}
+
+// ParseRouteTimeouts reads the timeouts of the routes from a comma separated list of route=duration, e.g.
+// "POST /wallet/:walletid/transfer=5s,GET /wallet/:walletid/stream=0"
+func ParseRouteTimeouts(list string) (map[string]time.Duration, error) {
+	routes := make(map[string]time.Duration)
+
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		route, duration, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("route timeout %q isn't route=duration", entry)
+		}
+
+		timeout, err := time.ParseDuration(strings.TrimSpace(duration))
+		if err != nil || timeout < 0 {
+			return nil, fmt.Errorf("timeout of route %q isn't a duration, e.g. 5s", route)
+		}
+
+		routes[strings.Join(strings.Fields(route), " ")] = timeout
+	}
+
+	return routes, nil
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"wallet-api/api"
+)
+
+// idWriter rewrites the v1 keys as they're written, streamed events included
+type idWriter struct {
+	gin.ResponseWriter
+}
+
+func (w *idWriter) Write(b []byte) (int, error) {
+	return w.ResponseWriter.Write(api.LowerCaseIDs(b))
+}
+
+func (w *idWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// LowerCaseIDs sends the ID keys and the ones ending in _ID as id and _id, so newer versions share the v1 handlers with
+// the fixed casing. Handlers writing to a hijacked connection check LowersIDs instead.
+func LowerCaseIDs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("lower_case_ids", true)
+		c.Writer = &idWriter{ResponseWriter: c.Writer}
+
+		c.Next()
+	}
+}
+
+// LowersIDs checks if the version of the request sends the ID keys in lower case, see LowerCaseIDs
+func LowersIDs(c *gin.Context) bool {
+	return c.GetBool("lower_case_ids")
+}
+
+// Deprecated marks the responses of routes that will be removed at sunset with the Deprecation and Sunset headers, and
+// links to the same route under the successor prefix
+func Deprecated(deprecatedAt, sunset time.Time, successor string) gin.HandlerFunc {
+	deprecation := fmt.Sprintf("@%d", deprecatedAt.Unix())
+	sunsetDate := sunset.UTC().Format(http.TimeFormat)
+
+	return func(c *gin.Context) {
+		c.Header("Deprecation", deprecation)
+		c.Header("Sunset", sunsetDate)
+		c.Header("Link", fmt.Sprintf(`<%s/%s>; rel="successor-version"`, successor, strings.TrimPrefix(c.Request.URL.Path, "/")))
+
+		c.Next()
+	}
+}
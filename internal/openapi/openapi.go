@@ -0,0 +1,116 @@
+package openapi
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+
+	"wallet-api/api"
+)
+
+//go:embed openapi.yaml
+var spec []byte
+
+// ginParam matches gin's path parameters so they can be compared with the spec's templated paths
+var ginParam = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+
+// versionPrefix matches the version the routes are mounted under, the spec's paths leave it to the servers
+var versionPrefix = regexp.MustCompile(`^/v[0-9]+/`)
+
+// Load parses the embedded specification and validates it, so a broken document stops the api from starting
+func Load() (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(spec)
+	if err != nil {
+		return nil, fmt.Errorf("something went wrong loading the openapi spec: %w", err)
+	}
+
+	if err = doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("openapi spec is invalid: %w", err)
+	}
+
+	return doc, nil
+}
+
+// ForVersion returns a copy of the spec describing the routes under the version's prefix, with the keys in the version's
+// casing
+func ForVersion(doc *openapi3.T, version string) (*openapi3.T, error) {
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("something went wrong copying the openapi spec: %w", err)
+	}
+
+	if version != api.V1 {
+		if raw, err = lowerCaseIDs(raw); err != nil {
+			return nil, fmt.Errorf("something went wrong renaming the %s openapi keys: %w", version, err)
+		}
+	}
+
+	versioned, err := openapi3.NewLoader().LoadFromData(raw)
+	if err != nil {
+		return nil, fmt.Errorf("something went wrong loading the %s openapi spec: %w", version, err)
+	}
+
+	versioned.Servers = openapi3.Servers{{URL: "/" + version}}
+	versioned.Info.Version = strings.TrimPrefix(version, "v") + ".0.0"
+
+	return versioned, nil
+}
+
+// lowerCaseIDs renames the v1 keys of the spec's properties and examples, along with the properties listed as required
+func lowerCaseIDs(raw []byte) ([]byte, error) {
+	var doc any
+	if err := json.Unmarshal(api.LowerCaseIDs(raw), &doc); err != nil {
+		return nil, err
+	}
+
+	lowerCaseRequired(doc)
+
+	return json.Marshal(doc)
+}
+
+// lowerCaseRequired renames the properties listed in the required lists of the schemas, which are values rather than keys
+func lowerCaseRequired(node any) {
+	switch node := node.(type) {
+	case map[string]any:
+		for key, value := range node {
+			if required, ok := value.([]any); ok && key == "required" {
+				for i, name := range required {
+					if name, ok := name.(string); ok {
+						required[i] = api.LowerCaseID(name)
+					}
+				}
+				continue
+			}
+
+			lowerCaseRequired(value)
+		}
+	case []any:
+		for _, value := range node {
+			lowerCaseRequired(value)
+		}
+	}
+}
+
+// Undocumented returns the routes registered in gin that are missing from the spec, as "METHOD /path"
+func Undocumented(doc *openapi3.T, routes gin.RoutesInfo) []string {
+	var missing []string
+	for _, route := range routes {
+		path := ginParam.ReplaceAllString(versionPrefix.ReplaceAllString(route.Path, "/"), "{$1}")
+
+		item := doc.Paths.Find(path)
+		if item == nil || item.GetOperation(route.Method) == nil {
+			missing = append(missing, route.Method+" "+route.Path)
+		}
+	}
+
+	sort.Strings(missing)
+
+	return missing
+}
@@ -1,7 +1,140 @@
 package pkg
 
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"wallet-api/api"
+)
+
 const (
 	UnexpectedMethod = "unexpected signing method: %v"
-	WrongAmount      = "invalid amount, must not be 0 or less"
+	WrongAmount      = "invalid amount, must be more than 0 in whole cents"
 	NotEnoughFunds   = "the current wallet has insufficient funds for transaction"
+	AdminOnly        = "only admins can access this resource"
+	GameServerOnly   = "only game servers can credit wins"
+	SameWallet       = "cannot transfer to the same wallet"
+
+	NotAMinor             = "linked user must be a minor"
+	GuardianNotAdult      = "guardian must be an adult"
+	NotGuardian           = "user is not the guardian of the wallet owner"
+	CategoryBlocked       = "debits in this category are blocked by the wallet guardian"
+	SpendLimitReached     = "debit exceeds the daily spending limit set by the wallet guardian"
+	TransactionNotPending = "transaction is not pending approval"
+	MinorAlreadyLinked    = "minor is already linked to a guardian"
+
+	SelfExcluded         = "debits are refused while the user is self-excluded"
+	CoolingOff           = "debits are refused during the cooling-off period"
+	DepositLimitReached  = "credit exceeds the deposit limit set by the user"
+	LossLimitReached     = "debit exceeds the net loss limit set by the user"
+	ExclusionActive      = "an active cooling-off or self-exclusion cannot be shortened"
+	InvalidCoolingOff    = "cooling-off must last between 1 and 42 days"
+	InvalidSelfExclusion = "self-exclusion must last at least 180 days"
+
+	BalanceCapReached     = "credit would take the user's wallets over the maximum balance allowed for their KYC tier"
+	TransferNotAllowed    = "transfers out are not allowed for the user's KYC tier"
+	TransferNeedsApproval = "transfer is above the amount the wallet guardian allows without approval"
+
+	WalletIsFrozen      = "wallet is frozen"
+	WalletIsClosed      = "wallet is closed"
+	WalletNotEmpty      = "wallet must be empty before closing it"
+	InvalidStatusChange = "wallet status cannot be changed from its current one"
+
+	TokenExpired       = "token is no longer valid"
+	TokenInvalid       = "token is not valid"
+	MissingToken       = "missing token in request"
+	InvalidCredentials = "invalid password for user"
+
+	TooManySubscriptions = "connection is already subscribed to the maximum number of wallets"
+
+	InvalidWebhookURL = "webhook url must use https and reach a public address"
+
+	IdempotencyKeyInProgress = "a request with this idempotency key is still in progress"
+	IdempotencyKeyReused     = "idempotency key was already used for a different request"
 )
+
+// Error is a sentinel error carrying the stable code sent to clients, its message is one of the constants above
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+var (
+	ErrWrongAmount    = &Error{Code: api.CodeWrongAmount, Message: WrongAmount}
+	ErrNotEnoughFunds = &Error{Code: api.CodeNotEnoughFunds, Message: NotEnoughFunds}
+	ErrAdminOnly      = &Error{Code: api.CodeAdminOnly, Message: AdminOnly}
+	ErrGameServerOnly = &Error{Code: api.CodeGameServerOnly, Message: GameServerOnly}
+	ErrSameWallet     = &Error{Code: api.CodeSameWallet, Message: SameWallet}
+
+	ErrNotAMinor             = &Error{Code: api.CodeNotAMinor, Message: NotAMinor}
+	ErrGuardianNotAdult      = &Error{Code: api.CodeGuardianNotAdult, Message: GuardianNotAdult}
+	ErrNotGuardian           = &Error{Code: api.CodeNotGuardian, Message: NotGuardian}
+	ErrCategoryBlocked       = &Error{Code: api.CodeCategoryBlocked, Message: CategoryBlocked}
+	ErrSpendLimitReached     = &Error{Code: api.CodeSpendLimitReached, Message: SpendLimitReached}
+	ErrTransactionNotPending = &Error{Code: api.CodeTransactionNotPending, Message: TransactionNotPending}
+	ErrMinorAlreadyLinked    = &Error{Code: api.CodeMinorAlreadyLinked, Message: MinorAlreadyLinked}
+
+	ErrSelfExcluded         = &Error{Code: api.CodeSelfExcluded, Message: SelfExcluded}
+	ErrCoolingOff           = &Error{Code: api.CodeCoolingOff, Message: CoolingOff}
+	ErrDepositLimitReached  = &Error{Code: api.CodeDepositLimitReached, Message: DepositLimitReached}
+	ErrLossLimitReached     = &Error{Code: api.CodeLossLimitReached, Message: LossLimitReached}
+	ErrExclusionActive      = &Error{Code: api.CodeExclusionActive, Message: ExclusionActive}
+	ErrInvalidCoolingOff    = &Error{Code: api.CodeInvalidCoolingOff, Message: InvalidCoolingOff}
+	ErrInvalidSelfExclusion = &Error{Code: api.CodeInvalidSelfExclusion, Message: InvalidSelfExclusion}
+
+	ErrBalanceCapReached     = &Error{Code: api.CodeBalanceCapReached, Message: BalanceCapReached}
+	ErrTransferNotAllowed    = &Error{Code: api.CodeTransferNotAllowed, Message: TransferNotAllowed}
+	ErrTransferNeedsApproval = &Error{Code: api.CodeTransferNeedsApproval, Message: TransferNeedsApproval}
+
+	ErrWalletIsFrozen      = &Error{Code: api.CodeWalletFrozen, Message: WalletIsFrozen}
+	ErrWalletIsClosed      = &Error{Code: api.CodeWalletClosed, Message: WalletIsClosed}
+	ErrWalletNotEmpty      = &Error{Code: api.CodeWalletNotEmpty, Message: WalletNotEmpty}
+	ErrInvalidStatusChange = &Error{Code: api.CodeInvalidStatusChange, Message: InvalidStatusChange}
+
+	ErrTokenExpired       = &Error{Code: api.CodeTokenExpired, Message: TokenExpired}
+	ErrTokenInvalid       = &Error{Code: api.CodeTokenInvalid, Message: TokenInvalid}
+	ErrMissingToken       = &Error{Code: api.CodeMissingToken, Message: MissingToken}
+	ErrInvalidCredentials = &Error{Code: api.CodeInvalidCredentials, Message: InvalidCredentials}
+
+	ErrTooManySubscriptions = &Error{Code: api.CodeTooManySubscriptions, Message: TooManySubscriptions}
+
+	ErrInvalidWebhookURL = &Error{Code: api.CodeInvalidWebhookURL, Message: InvalidWebhookURL}
+
+	ErrIdempotencyKeyInProgress = &Error{Code: api.CodeIdempotencyKeyInProgress, Message: IdempotencyKeyInProgress}
+	ErrIdempotencyKeyReused     = &Error{Code: api.CodeIdempotencyKeyReused, Message: IdempotencyKeyReused}
+)
+
+// ErrorCode returns the code of the sentinel, limit or context error wrapped in err, or an empty string when it has none
+func ErrorCode(err error) string {
+	var sentinel *Error
+	if errors.As(err, &sentinel) {
+		return sentinel.Code
+	}
+
+	var limitErr *LimitError
+	if errors.As(err, &limitErr) {
+		if limitErr.Limit == LimitVelocity {
+			return api.CodeVelocityLimitExceeded
+		}
+		return api.CodeLimitExceeded
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return api.CodeNotFound
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return api.CodeTimeout
+	case errors.Is(err, context.Canceled):
+		return api.CodeCanceled
+	}
+
+	return ""
+}
@@ -0,0 +1,27 @@
+package pkg
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	EventWalletCredited       = "wallet.credited"
+	EventWalletDebited        = "wallet.debited"
+	EventWalletTransferredOut = "wallet.transferred_out"
+	EventWalletTransferredIn  = "wallet.transferred_in"
+)
+
+// OutboxEvent is a domain event saved in the same db transaction as the change it describes,
+// the relay publishes it afterwards and sets PublishedAt so it isn't sent again.
+type OutboxEvent struct {
+	ID          int          `json:"id"`
+	Type        string       `json:"type"`
+	WalletID    int          `json:"wallet_id"`
+	UserID      int          `json:"user_id" gorm:"index"`
+	Payload     string       `json:"payload" gorm:"type:text"`
+	CreatedAt   time.Time    `json:"created_at"`
+	PublishedAt sql.NullTime `json:"published_at" gorm:"index"`
+	// set while a relay publishes the event, the claim lapses after the relay's lease if it never finishes
+	ClaimedAt sql.NullTime `json:"-"`
+}
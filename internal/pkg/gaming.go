@@ -0,0 +1,69 @@
+package pkg
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	CategoryWin = "win"
+
+	PeriodDay   = "day"
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+
+	MaxCoolingOffDays    = 42
+	MinSelfExclusionDays = 180
+)
+
+// GamingControl holds the responsible gaming settings the user chose, amounts are saved in 100s and a 0 means no limit.
+// Increases of a limit are saved as pending and only apply once the cooling period is over.
+type GamingControl struct {
+	UserID               int          `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	DepositLimit         int          `json:"deposit_limit"`
+	DepositPeriod        string       `json:"deposit_period"`
+	LossLimit            int          `json:"loss_limit"`
+	LossPeriod           string       `json:"loss_period"`
+	PendingDepositLimit  int          `json:"pending_deposit_limit"`
+	PendingDepositPeriod string       `json:"pending_deposit_period"`
+	PendingLossLimit     int          `json:"pending_loss_limit"`
+	PendingLossPeriod    string       `json:"pending_loss_period"`
+	PendingFrom          sql.NullTime `json:"-"`
+	CoolingOffUntil      sql.NullTime `json:"-"`
+	SelfExcludedUntil    sql.NullTime `json:"-"`
+	UpdatedAt            time.Time    `json:"updated_at"`
+}
+
+// ApplyPending moves the pending limits in place once the cooling period is over, returning true if it did
+func (c *GamingControl) ApplyPending(now time.Time) bool {
+	if !c.PendingFrom.Valid || now.Before(c.PendingFrom.Time) {
+		return false
+	}
+
+	c.DepositLimit, c.DepositPeriod = c.PendingDepositLimit, c.PendingDepositPeriod
+	c.LossLimit, c.LossPeriod = c.PendingLossLimit, c.PendingLossPeriod
+	c.PendingFrom = sql.NullTime{}
+
+	return true
+}
+
+// PeriodStart returns the start of the rolling period ending now
+func PeriodStart(period string, now time.Time) time.Time {
+	switch period {
+	case PeriodWeek:
+		return now.AddDate(0, 0, -7)
+	case PeriodMonth:
+		return now.AddDate(0, 0, -30)
+	default:
+		return now.Add(-24 * time.Hour)
+	}
+}
+
+// IsIncrease checks if going from the current limit to the new one loosens it, 0 meaning no limit
+func IsIncrease(current, limit int) bool {
+	if current == 0 {
+		return false
+	}
+
+	return limit == 0 || limit > current
+}
@@ -0,0 +1,52 @@
+package pkg
+
+import (
+	"strings"
+	"time"
+)
+
+// AdultAge is the age from which a user is no longer considered a minor
+const AdultAge = 18
+
+// GuardianLink ties a minor user to the adult user responsible for their wallets
+type GuardianLink struct {
+	ID         int       `json:"id"`
+	GuardianID int       `json:"guardian_id" gorm:"index"`
+	MinorID    int       `json:"minor_id" gorm:"uniqueIndex"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// WalletControl holds the restrictions a guardian placed on a minor's wallet, amounts are saved in 100s
+type WalletControl struct {
+	WalletID          int       `json:"wallet_id" gorm:"primaryKey;autoIncrement:false"`
+	GuardianID        int       `json:"guardian_id"`
+	DailySpendLimit   int       `json:"daily_spend_limit"`
+	ApprovalThreshold int       `json:"approval_threshold"`
+	BlockedCategories string    `json:"blocked_categories"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// IsMinor checks the user's age against AdultAge
+func (u User) IsMinor() bool {
+	return u.Age < AdultAge
+}
+
+// Blocks checks if the category passed is in the comma separated list of blocked categories, debits without a category
+// are blocked as soon as any category is so they can't get around the list
+func (c WalletControl) Blocks(category string) bool {
+	if c.BlockedCategories == "" {
+		return false
+	}
+
+	if strings.TrimSpace(category) == "" {
+		return true
+	}
+
+	for _, blocked := range strings.Split(c.BlockedCategories, ",") {
+		if strings.EqualFold(blocked, category) {
+			return true
+		}
+	}
+
+	return false
+}
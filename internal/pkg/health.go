@@ -0,0 +1,19 @@
+package pkg
+
+const (
+	HealthUp   = "up"
+	HealthDown = "down"
+
+	HealthMySQL      = "mysql"
+	HealthRedis      = "redis"
+	HealthMigrations = "migrations"
+
+	MigrationsBehind = "migrations behind the expected version %d"
+	MigrationsDirty  = "migration %d failed half way, the schema needs fixing by hand"
+)
+
+// SchemaMigration is the row golang-migrate keeps with the version of the last migration applied
+type SchemaMigration struct {
+	Version uint
+	Dirty   bool
+}
@@ -0,0 +1,41 @@
+package pkg
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	KYCUnverified = "unverified"
+	KYCVerified   = "verified"
+	KYCRejected   = "rejected"
+)
+
+// TierRule is what a wallet can do depending on its user's KYC tier, a MaxBalance of 0 means no cap
+type TierRule struct {
+	MaxBalance     int
+	CanTransferOut bool
+}
+
+// KYCDocument is the metadata of a document checked for a user's verification, the document itself isn't saved
+type KYCDocument struct {
+	ID        int          `json:"id"`
+	UserID    int          `json:"user_id" gorm:"index"`
+	AdminID   int          `json:"admin_id"`
+	Type      string       `json:"type"`
+	Reference string       `json:"reference"`
+	Country   string       `json:"country"`
+	ExpiresAt sql.NullTime `json:"-"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// KYCVerification records the outcome of a review of the user's documents
+type KYCVerification struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id" gorm:"index"`
+	AdminID   int       `json:"admin_id"`
+	Outcome   string    `json:"outcome"`
+	Tier      string    `json:"tier"`
+	Notes     string    `json:"notes"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,53 @@
+package pkg
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	LimitScopeGlobal = "global"
+	LimitScopeTier   = "tier"
+	LimitScopeWallet = "wallet"
+
+	LimitPerTransaction = "per_transaction"
+	LimitDaily          = "daily"
+	LimitWeekly         = "weekly"
+	LimitMonthly        = "monthly"
+	LimitVelocity       = "velocity"
+
+	// LimitExceeded and VelocityLimitExceeded are the formats of the LimitError messages
+	LimitExceeded         = "%s exceeds the %s limit of %d.%02d"
+	VelocityLimitExceeded = "%s velocity limit reached, at most %d transactions per minute"
+)
+
+// Limit caps the credits or debits of a wallet, amounts are saved in 100s. Each check takes the most specific limit
+// setting it, wallet over tier over global and then the settings, a 0 leaves it to the next one.
+type Limit struct {
+	ID             int       `json:"id"`
+	Scope          string    `json:"scope" gorm:"uniqueIndex:idx_limit_target"`
+	Tier           string    `json:"tier,omitempty" gorm:"uniqueIndex:idx_limit_target"`
+	WalletID       int       `json:"wallet_id,omitempty" gorm:"uniqueIndex:idx_limit_target"`
+	Operation      string    `json:"operation" gorm:"uniqueIndex:idx_limit_target"`
+	PerTransaction int       `json:"per_transaction"`
+	Daily          int       `json:"daily"`
+	Weekly         int       `json:"weekly"`
+	Monthly        int       `json:"monthly"`
+	PerMinute      int       `json:"per_minute"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// LimitError is returned when a credit or debit breaks one of the wallet's limits
+type LimitError struct {
+	Operation string
+	Limit     string
+	Max       int
+}
+
+func (e *LimitError) Error() string {
+	if e.Limit == LimitVelocity {
+		return fmt.Sprintf(VelocityLimitExceeded, e.Operation, e.Max)
+	}
+
+	return fmt.Sprintf(LimitExceeded, e.Operation, e.Limit, e.Max/100, e.Max%100)
+}
@@ -0,0 +1,30 @@
+package pkg
+
+import "time"
+
+const (
+	TransactionCredit = "credit"
+	TransactionDebit  = "debit"
+
+	TransactionCompleted = "completed"
+	TransactionPending   = "pending"
+	TransactionRejected  = "rejected"
+
+	CategoryTransfer = "transfer"
+)
+
+// Transaction is a single ledger entry against a wallet, amounts are saved in 100s like the wallet funds.
+// Transfers are saved as a debit and a credit pointing to each other's wallet.
+type Transaction struct {
+	ID               int       `json:"id"`
+	WalletID         int       `json:"wallet_id" gorm:"index"`
+	UserID           int       `json:"user_id"`
+	Type             string    `json:"type"`
+	Amount           int       `json:"amount"`
+	Balance          int       `json:"balance"`
+	Category         string    `json:"category"`
+	Status           string    `json:"status"`
+	TransferWalletID int       `json:"transfer_wallet_id,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
@@ -6,6 +6,21 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+	// game servers credit the players' wins, the only credits kept out of the deposit limit
+	RoleGameServer = "game_server"
+
+	TierUnverified = "unverified"
+	TierBasic      = "basic"
+	TierFull       = "full"
+
+	// the typ claim of the tokens, so a refresh token can't be sent as an access token
+	TokenAccess  = "access"
+	TokenRefresh = "refresh"
+)
+
 type User struct {
 	gorm.Model
 	FirstName          string       `json:"first_name"`
@@ -14,5 +29,8 @@ type User struct {
 	Age                int8         `json:"age"`
 	Username           string       `json:"username"`
 	Password           string       `json:"password"`
+	Role               string       `json:"role" gorm:"default:user"`
+	KYCStatus          string       `json:"kyc_status" gorm:"default:unverified"`
+	KYCTier            string       `json:"kyc_tier" gorm:"default:unverified"`
 	LastLoginTimeStamp sql.NullTime `json:"-"`
 }
@@ -1,9 +1,41 @@
 package pkg
 
+import "time"
+
+const (
+	WalletActive = "active"
+	WalletFrozen = "frozen"
+	WalletClosed = "closed"
+
+	ReasonFraud                = "fraud"
+	ReasonLegalHold            = "legal_hold"
+	ReasonCustomerRequest      = "customer_request"
+	ReasonInvestigationCleared = "investigation_cleared"
+	ReasonOther                = "other"
+
+	// Currency of every wallet, funds are saved in its cents
+	Currency = "EUR"
+)
+
 type Wallet struct {
-	ID     int    `json:"id"`
-	UserID int    `json:"user_id"`
-	User   User   `json:"user"`
-	Name   string `json:"name"`
-	Funds  int    `json:"funds"`
+	ID           int    `json:"id"`
+	UserID       int    `json:"user_id"`
+	User         User   `json:"user"`
+	Name         string `json:"name"`
+	Funds        int    `json:"funds"`
+	Status       string `json:"status" gorm:"default:active"`
+	BlockCredits bool   `json:"block_credits"`
+}
+
+// WalletStatusChange is the history of freezes, unfreezes and closures of a wallet kept for support
+type WalletStatusChange struct {
+	ID           int       `json:"id"`
+	WalletID     int       `json:"wallet_id" gorm:"index"`
+	AdminID      int       `json:"admin_id"`
+	FromStatus   string    `json:"from_status"`
+	ToStatus     string    `json:"to_status"`
+	Reason       string    `json:"reason"`
+	Notes        string    `json:"notes"`
+	BlockCredits bool      `json:"block_credits"`
+	CreatedAt    time.Time `json:"created_at"`
 }
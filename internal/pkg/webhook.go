@@ -0,0 +1,71 @@
+package pkg
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook is an endpoint a user registered to get their wallet events, Events is a comma separated
+// list of the event types wanted, all of them are sent when empty
+type Webhook struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id" gorm:"index"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    string    `json:"events"`
+	Active    bool      `json:"active" gorm:"default:true"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Wants checks if the webhook subscribed to the event type
+func (webhook *Webhook) Wants(eventType string) bool {
+	if webhook.Events == "" {
+		return true
+	}
+
+	for _, wanted := range strings.Split(webhook.Events, ",") {
+		if wanted == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WebhookDelivery is one event to send to one webhook along with the outcome of the attempts so far
+type WebhookDelivery struct {
+	ID             int          `json:"id"`
+	WebhookID      int          `json:"webhook_id" gorm:"uniqueIndex:idx_webhook_event"`
+	EventID        int          `json:"event_id" gorm:"uniqueIndex:idx_webhook_event"`
+	EventType      string       `json:"event_type"`
+	Payload        string       `json:"payload" gorm:"type:text"`
+	Status         string       `json:"status" gorm:"index"`
+	Attempts       int          `json:"attempts"`
+	LastStatusCode int          `json:"last_status_code"`
+	LastError      string       `json:"last_error"`
+	NextAttemptAt  sql.NullTime `json:"next_attempt_at"`
+	DeliveredAt    sql.NullTime `json:"delivered_at"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
+
+// WebhookSignature signs the timestamp and body with the webhook's secret, receivers compute it again
+// and compare it with the X-Wallet-Signature header, refusing old timestamps to stop replays
+func WebhookSignature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,129 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"wallet-api/api"
+	walletv1 "wallet-api/gen/wallet/v1"
+	"wallet-api/internal/middleware"
+	"wallet-api/internal/pkg"
+)
+
+const (
+	// idempotencyKey is the metadata key of the Idempotency-Key header, grpc keys are lower case
+	idempotencyKey      = "idempotency-key"
+	idempotencyReplayed = "idempotency-replayed"
+)
+
+// idempotentMethods are the calls moving money, with the response each one replays
+var idempotentMethods = map[string]func() proto.Message{
+	walletv1.WalletService_Credit_FullMethodName:   func() proto.Message { return &walletv1.CreditResponse{} },
+	walletv1.WalletService_Debit_FullMethodName:    func() proto.Message { return &walletv1.DebitResponse{} },
+	walletv1.WalletService_Transfer_FullMethodName: func() proto.Message { return &walletv1.TransferResponse{} },
+}
+
+// savedCall is what's kept under the key, the response or the status of the error returned
+type savedCall struct {
+	Response []byte     `json:"response,omitempty"`
+	Code     codes.Code `json:"code,omitempty"`
+	Message  string     `json:"message,omitempty"`
+}
+
+// IdempotencyInterceptor is the grpc equivalent of middleware.Idempotency, a call sent again with the same
+// idempotency-key metadata gets the first response or error back, with idempotency-replayed set in the header, instead
+// of moving the money again. The keys are shared with the HTTP requests and the websocket commands.
+// It must run after AuthInterceptor.
+func IdempotencyInterceptor(rc *redis.Client, ttl time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		newResponse, ok := idempotentMethods[info.FullMethod]
+		md, _ := metadata.FromIncomingContext(ctx)
+		key := md.Get(idempotencyKey)
+		if !ok || len(key) == 0 || key[0] == "" {
+			return handler(ctx, req)
+		}
+
+		message, _ := req.(proto.Message)
+		body, err := proto.MarshalOptions{Deterministic: true}.Marshal(message)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+
+		var (
+			res    any
+			resErr error
+		)
+		saved, replayed, err := middleware.Idempotent(ctx, rc, ttl, tokenUserID(ctx), key[0], middleware.IdempotencyFingerprint(info.FullMethod, body),
+			func() (int, []byte) {
+				res, resErr = handler(ctx, req)
+				return saveCall(res, resErr)
+			})
+		switch {
+		case errors.Is(err, middleware.ErrIdempotencyKeyTooLong), errors.Is(err, pkg.ErrIdempotencyKeyReused):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, pkg.ErrIdempotencyKeyInProgress):
+			return nil, status.Error(codes.Aborted, err.Error())
+		case err != nil:
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+
+		if !replayed {
+			return res, resErr
+		}
+
+		_ = grpc.SetHeader(ctx, metadata.Pairs(idempotencyReplayed, "true"))
+
+		var call savedCall
+		if err = json.Unmarshal(saved, &call); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+
+		if call.Code != codes.OK {
+			return nil, status.Error(call.Code, call.Message)
+		}
+
+		replay := newResponse()
+		if err = proto.Unmarshal(call.Response, replay); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+
+		return replay, nil
+	}
+}
+
+// saveCall encodes the result of the call along with the HTTP status closest to its code, which decides whether it's
+// kept like for the HTTP requests: the calls failing on the server, rate limited or canceled free the key
+func saveCall(res any, err error) (int, []byte) {
+	var call savedCall
+	if err != nil {
+		st := status.Convert(err)
+		call.Code, call.Message = st.Code(), st.Message()
+	} else if message, ok := res.(proto.Message); ok {
+		call.Response, _ = proto.Marshal(message)
+	}
+
+	body, _ := json.Marshal(call)
+
+	switch call.Code {
+	case codes.OK:
+		return http.StatusOK, body
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests, body
+	case codes.Canceled:
+		return api.StatusClientClosedRequest, body
+	case codes.Internal, codes.Unknown, codes.Unavailable, codes.DeadlineExceeded, codes.DataLoss, codes.Unimplemented:
+		return http.StatusInternalServerError, body
+	default:
+		return http.StatusBadRequest, body
+	}
+}
@@ -0,0 +1,108 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	walletv1 "wallet-api/gen/wallet/v1"
+)
+
+// matchKey matches the redis command by its key, saving the value it was sent with
+func matchKey(key string, value *string) redismock.CustomMatch {
+	return func(expected, actual []interface{}) error {
+		if fmt.Sprint(actual[1]) != key {
+			return fmt.Errorf("unexpected key %v", actual[1])
+		}
+		if value != nil {
+			*value = fmt.Sprint(actual[2])
+		}
+		return nil
+	}
+}
+
+func TestIdempotencyInterceptor(t *testing.T) {
+	rd, redisMock := redismock.NewClientMock()
+	interceptor := IdempotencyInterceptor(rd, time.Hour)
+
+	ctx := context.WithValue(context.Background(), userIDKey, 1)
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(idempotencyKey, "order-1"))
+
+	credit := &grpc.UnaryServerInfo{FullMethod: walletv1.WalletService_Credit_FullMethodName}
+	req := &walletv1.CreditRequest{WalletId: 1, Amount: "10.00"}
+
+	calls := 0
+	handler := func(context.Context, any) (any, error) {
+		calls++
+		return &walletv1.CreditResponse{UserId: 1, WalletId: 1, Balance: "10.00", TransactionId: int64(calls)}, nil
+	}
+
+	key := "idempotency:1:order-1"
+
+	var saved string
+	redisMock.CustomMatch(matchKey(key, nil)).ExpectSetNX(key, "", time.Minute).SetVal(true)
+	redisMock.CustomMatch(matchKey(key, &saved)).ExpectSet(key, "", time.Hour).SetVal("OK")
+
+	first, err := interceptor(ctx, req, credit, handler)
+	require.NoError(t, err)
+
+	t.Run("The same credit sent again is replayed", func(t *testing.T) {
+		redisMock.CustomMatch(matchKey(key, nil)).ExpectSetNX(key, "", time.Minute).SetVal(false)
+		redisMock.ExpectGet(key).SetVal(saved)
+
+		res, err := interceptor(ctx, req, credit, handler)
+		require.NoError(t, err)
+		require.True(t, proto.Equal(first.(proto.Message), res.(proto.Message)))
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("The key sent with another amount is refused", func(t *testing.T) {
+		redisMock.CustomMatch(matchKey(key, nil)).ExpectSetNX(key, "", time.Minute).SetVal(false)
+		redisMock.ExpectGet(key).SetVal(saved)
+
+		_, err := interceptor(ctx, &walletv1.CreditRequest{WalletId: 1, Amount: "20.00"}, credit, handler)
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("Refused calls are replayed with their error", func(t *testing.T) {
+		debit := &grpc.UnaryServerInfo{FullMethod: walletv1.WalletService_Debit_FullMethodName}
+		debitCtx := metadata.NewIncomingContext(context.WithValue(context.Background(), userIDKey, 1), metadata.Pairs(idempotencyKey, "order-2"))
+		debitKey := "idempotency:1:order-2"
+		refused := func(context.Context, any) (any, error) {
+			calls++
+			return nil, status.Error(codes.FailedPrecondition, "the current wallet has insufficient funds for transaction")
+		}
+
+		var savedErr string
+		redisMock.CustomMatch(matchKey(debitKey, nil)).ExpectSetNX(debitKey, "", time.Minute).SetVal(true)
+		redisMock.CustomMatch(matchKey(debitKey, &savedErr)).ExpectSet(debitKey, "", time.Hour).SetVal("OK")
+
+		_, err := interceptor(debitCtx, &walletv1.DebitRequest{WalletId: 1, Amount: "10.00"}, debit, refused)
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+		redisMock.CustomMatch(matchKey(debitKey, nil)).ExpectSetNX(debitKey, "", time.Minute).SetVal(false)
+		redisMock.ExpectGet(debitKey).SetVal(savedErr)
+
+		_, err = interceptor(debitCtx, &walletv1.DebitRequest{WalletId: 1, Amount: "10.00"}, debit, refused)
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+		require.Equal(t, 2, calls)
+	})
+
+	t.Run("Calls without a key go through", func(t *testing.T) {
+		_, err := interceptor(context.WithValue(context.Background(), userIDKey, 1), req, credit, handler)
+		require.NoError(t, err)
+		require.Equal(t, 3, calls)
+	})
+
+	require.NoError(t, redisMock.ExpectationsWereMet())
+}
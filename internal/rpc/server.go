@@ -0,0 +1,176 @@
+package rpc
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	walletv1 "wallet-api/gen/wallet/v1"
+	"wallet-api/internal/logging"
+	"wallet-api/internal/middleware"
+	"wallet-api/internal/services"
+	"wallet-api/internal/tracing"
+)
+
+type contextKey string
+
+const (
+	userIDKey contextKey = "user_id"
+	roleKey   contextKey = "role"
+
+	// requestIDKey is the metadata key of the request id, grpc keys are lower case
+	requestIDKey = "x-request-id"
+)
+
+// publicMethods don't need a token, like the login route of the HTTP API
+var publicMethods = map[string]bool{
+	walletv1.UserService_Login_FullMethodName: true,
+}
+
+// NewServer returns the grpc server exposing the wallet and user services behind the token and idempotency interceptors
+func NewServer(walletService *services.WalletService, userService *services.UserService, jwtSecret string, idempotencyTTL time.Duration, logger *zap.Logger) *grpc.Server {
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		TraceInterceptor(),
+		LoggingInterceptor(logger),
+		AuthInterceptor(jwtSecret),
+		IdempotencyInterceptor(walletService.Cache, idempotencyTTL),
+	))
+
+	walletv1.RegisterWalletServiceServer(server, NewWalletServer(walletService))
+	walletv1.RegisterUserServiceServer(server, NewUserServer(userService))
+
+	return server
+}
+
+// TraceInterceptor opens the server span of the call, continuing the trace of the traceparent metadata when there's one
+func TraceInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+
+		service, method, _ := strings.Cut(strings.TrimPrefix(info.FullMethod, "/"), "/")
+		ctx, span := tracing.Tracer().Start(ctx, info.FullMethod,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.RPCSystemGRPC, semconv.RPCService(service), semconv.RPCMethod(method)),
+		)
+		defer span.End()
+
+		res, err := handler(ctx, req)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(otelcodes.Error, status.Code(err).String())
+		}
+
+		return res, err
+	}
+}
+
+// LoggingInterceptor is the grpc equivalent of middleware.RequestID and middleware.AccessLog, the id is read from the
+// x-request-id metadata and sent back in the header
+func LoggingInterceptor(logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		id := md.Get(requestIDKey)
+		if len(id) == 0 {
+			id = []string{""}
+		}
+		requestID := middleware.EnsureRequestID(id[0])
+		_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, requestID))
+
+		fields := []zap.Field{zap.String("request_id", requestID)}
+		if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+			fields = append(fields, zap.String("trace_id", span.TraceID().String()))
+		}
+		requestLogger := logger.With(fields...)
+
+		res, err := handler(logging.NewContext(ctx, requestLogger), req)
+
+		code := status.Code(err)
+		level := zapcore.InfoLevel
+		switch {
+		case code == codes.Internal || code == codes.Unknown || code == codes.DataLoss || code == codes.Unavailable:
+			level = zapcore.ErrorLevel
+		case code != codes.OK:
+			level = zapcore.WarnLevel
+		}
+
+		requestLogger.Log(level, "call",
+			zap.String("method", info.FullMethod),
+			zap.String("code", code.String()),
+			zap.Duration("latency", time.Since(start)),
+		)
+
+		return res, err
+	}
+}
+
+// metadataCarrier reads the propagated headers from the grpc metadata
+type metadataCarrier metadata.MD
+
+func (carrier metadataCarrier) Get(key string) string {
+	if values := metadata.MD(carrier).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (carrier metadataCarrier) Set(key, value string) {
+	metadata.MD(carrier).Set(key, value)
+}
+
+func (carrier metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(carrier))
+	for key := range carrier {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// AuthInterceptor is the grpc equivalent of middleware.RequireAuth, the bearer token is read from the authorization
+// metadata and the user's id and role are saved in the context
+func AuthInterceptor(jwtSecret string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if publicMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		auth := md.Get("authorization")
+		if len(auth) == 0 || !strings.HasPrefix(auth[0], "Bearer ") || auth[0] == "Bearer " {
+			return nil, status.Error(codes.Unauthenticated, "missing token in request")
+		}
+
+		userID, role, err := middleware.ParseToken(strings.TrimPrefix(auth[0], "Bearer "), jwtSecret)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+
+		if userID == 0 {
+			return nil, status.Error(codes.Unauthenticated, "no user id saved in token")
+		}
+
+		ctx = context.WithValue(ctx, userIDKey, userID)
+		ctx = context.WithValue(ctx, roleKey, role)
+
+		return handler(ctx, req)
+	}
+}
+
+// tokenUserID returns the id saved by the interceptor
+func tokenUserID(ctx context.Context) int {
+	userID, _ := ctx.Value(userIDKey).(int)
+	return userID
+}
@@ -0,0 +1,42 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+
+	"wallet-api/api"
+	walletv1 "wallet-api/gen/wallet/v1"
+	"wallet-api/internal/pkg"
+	"wallet-api/internal/services"
+)
+
+type UserServer struct {
+	walletv1.UnimplementedUserServiceServer
+	UserService services.UserServices
+}
+
+func NewUserServer(service *services.UserService) *UserServer {
+	return &UserServer{
+		UserService: service,
+	}
+}
+
+func (server *UserServer) Login(ctx context.Context, req *walletv1.LoginRequest) (*walletv1.LoginResponse, error) {
+
+	res, err := server.UserService.Login(ctx, api.LoginRequest{Username: req.Username, Password: req.Password})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	} else if errors.Is(err, pkg.ErrInvalidCredentials) {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	} else if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return nil, status.FromContextError(err).Err()
+	} else if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &walletv1.LoginResponse{Token: res.Token}, nil
+}
@@ -0,0 +1,156 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/shopspring/decimal"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+
+	"wallet-api/api"
+	walletv1 "wallet-api/gen/wallet/v1"
+	"wallet-api/internal/pkg"
+	"wallet-api/internal/services"
+)
+
+type WalletServer struct {
+	walletv1.UnimplementedWalletServiceServer
+	WalletService services.WalletServices
+}
+
+func NewWalletServer(service *services.WalletService) *WalletServer {
+	return &WalletServer{
+		WalletService: service,
+	}
+}
+
+func (server *WalletServer) Balance(ctx context.Context, req *walletv1.BalanceRequest) (*walletv1.BalanceResponse, error) {
+
+	res, err := server.WalletService.Balance(ctx, tokenUserID(ctx), int(req.WalletId))
+	if err != nil {
+		return nil, walletError(err)
+	}
+
+	return &walletv1.BalanceResponse{
+		UserId:   int64(res.UserID),
+		WalletId: int64(res.WalletID),
+		Balance:  res.Balance.StringFixed(2),
+	}, nil
+}
+
+func (server *WalletServer) Credit(ctx context.Context, req *walletv1.CreditRequest) (*walletv1.CreditResponse, error) {
+
+	amount, err := parseAmount(req.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := server.WalletService.Credit(ctx, &api.CreditRequest{
+		UserId:   tokenUserID(ctx),
+		WalletId: int(req.WalletId),
+		Amount:   amount,
+		Category: req.Category,
+	})
+	if err != nil {
+		return nil, walletError(err)
+	}
+
+	return &walletv1.CreditResponse{
+		UserId:        int64(res.UserID),
+		WalletId:      int64(res.WalletID),
+		Balance:       res.Balance.StringFixed(2),
+		TransactionId: int64(res.TransactionID),
+	}, nil
+}
+
+func (server *WalletServer) Debit(ctx context.Context, req *walletv1.DebitRequest) (*walletv1.DebitResponse, error) {
+
+	amount, err := parseAmount(req.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := server.WalletService.Debit(ctx, &api.DebitRequest{
+		UserId:   tokenUserID(ctx),
+		WalletId: int(req.WalletId),
+		Amount:   amount,
+		Category: req.Category,
+	})
+	if err != nil {
+		return nil, walletError(err)
+	}
+
+	return &walletv1.DebitResponse{
+		UserId:        int64(res.UserID),
+		WalletId:      int64(res.WalletID),
+		Balance:       res.Balance.StringFixed(2),
+		TransactionId: int64(res.TransactionID),
+		Status:        res.Status,
+	}, nil
+}
+
+func (server *WalletServer) Transfer(ctx context.Context, req *walletv1.TransferRequest) (*walletv1.TransferResponse, error) {
+
+	amount, err := parseAmount(req.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := server.WalletService.Transfer(ctx, &api.TransferRequest{
+		UserId:     tokenUserID(ctx),
+		WalletId:   int(req.WalletId),
+		ToWalletId: int(req.ToWalletId),
+		Amount:     amount,
+	})
+	if err != nil {
+		return nil, walletError(err)
+	}
+
+	return &walletv1.TransferResponse{
+		UserId:        int64(res.UserID),
+		WalletId:      int64(res.WalletID),
+		ToWalletId:    int64(res.ToWalletID),
+		Balance:       res.Balance.StringFixed(2),
+		TransactionId: int64(res.TransactionID),
+	}, nil
+}
+
+func parseAmount(amount string) (decimal.Decimal, error) {
+	parsed, err := decimal.NewFromString(amount)
+	if err != nil {
+		return decimal.Decimal{}, status.Error(codes.InvalidArgument, pkg.WrongAmount)
+	}
+
+	return parsed, nil
+}
+
+// walletError maps the errors returned by the wallet service to the grpc codes closest to the HTTP statuses
+func walletError(err error) error {
+	var limitErr *pkg.LimitError
+	if errors.As(err, &limitErr) {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+
+	code := codes.Internal
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		code = codes.NotFound
+	case errors.Is(err, pkg.ErrWrongAmount), errors.Is(err, pkg.ErrSameWallet):
+		code = codes.InvalidArgument
+	case errors.Is(err, pkg.ErrNotEnoughFunds), errors.Is(err, pkg.ErrWalletIsFrozen), errors.Is(err, pkg.ErrWalletIsClosed):
+		code = codes.FailedPrecondition
+	case errors.Is(err, pkg.ErrCategoryBlocked), errors.Is(err, pkg.ErrSpendLimitReached), errors.Is(err, pkg.ErrTransferNeedsApproval),
+		errors.Is(err, pkg.ErrSelfExcluded), errors.Is(err, pkg.ErrCoolingOff), errors.Is(err, pkg.ErrDepositLimitReached),
+		errors.Is(err, pkg.ErrLossLimitReached), errors.Is(err, pkg.ErrBalanceCapReached), errors.Is(err, pkg.ErrTransferNotAllowed),
+		errors.Is(err, pkg.ErrGameServerOnly):
+		code = codes.PermissionDenied
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	}
+
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+
+	"wallet-api/api"
+	"wallet-api/internal/pkg"
+	"wallet-api/internal/utils"
+)
+
+var gamingControlColumns = []string{
+	"user_id", "deposit_limit", "deposit_period", "loss_limit", "loss_period",
+	"pending_deposit_limit", "pending_deposit_period", "pending_loss_limit", "pending_loss_period",
+	"pending_from", "cooling_off_until", "self_excluded_until",
+}
+
+func amountOf(euros int64) *decimal.Decimal {
+	amount := decimal.NewFromInt(euros)
+	return &amount
+}
+
+type gamingLimitsTestCase struct {
+	Name            string
+	Input           *api.GamingLimitsRequest
+	ExpectedDeposit decimal.Decimal
+	ExpectedPending bool
+}
+
+func TestGamingLimits(t *testing.T) {
+	gamingService := NewGamingService(gormDB, log, GamingServiceSettings{LimitIncreaseDelay: 24 * time.Hour}, NewWalletService(gormDB, rd, log, WalletServiceSettings{}, userService))
+
+	testCases := []gamingLimitsTestCase{
+		{
+			Name:            "Decrease applies straight away",
+			Input:           &api.GamingLimitsRequest{DepositLimit: amountOf(50), LossLimit: amountOf(20)},
+			ExpectedDeposit: decimal.NewFromInt(50),
+			ExpectedPending: false,
+		},
+		{
+			Name:            "Increase waits for the cooling period",
+			Input:           &api.GamingLimitsRequest{DepositLimit: amountOf(200), LossLimit: amountOf(20)},
+			ExpectedDeposit: decimal.NewFromInt(100),
+			ExpectedPending: true,
+		},
+		{
+			Name:            "Removing a limit is an increase",
+			Input:           &api.GamingLimitsRequest{DepositLimit: amountOf(0), LossLimit: amountOf(20)},
+			ExpectedDeposit: decimal.NewFromInt(100),
+			ExpectedPending: true,
+		},
+		{
+			Name:            "Same limit over a shorter period is an increase",
+			Input:           &api.GamingLimitsRequest{DepositLimit: amountOf(100), DepositPeriod: pkg.PeriodDay, LossLimit: amountOf(20)},
+			ExpectedDeposit: decimal.NewFromInt(100),
+			ExpectedPending: true,
+		},
+		{
+			Name:            "Limit left out stays as it is",
+			Input:           &api.GamingLimitsRequest{LossLimit: amountOf(10)},
+			ExpectedDeposit: decimal.NewFromInt(100),
+			ExpectedPending: false,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+
+			sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `gaming_controls` WHERE user_id = ? LIMIT 1")).
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows(gamingControlColumns).
+					AddRow(1, 10000, pkg.PeriodWeek, 2000, pkg.PeriodDay, 10000, pkg.PeriodWeek, 2000, pkg.PeriodDay, nil, nil, nil))
+			sqlMock.ExpectBegin()
+			sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE `gaming_controls`")).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			sqlMock.ExpectCommit()
+
+			res, err := gamingService.SetLimits(context.Background(), 1, test.Input)
+
+			if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
+				t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.ExpectedDeposit.String(), res.DepositLimit.String())
+			require.Equal(t, test.ExpectedPending, res.PendingFrom != nil)
+		})
+	}
+}
+
+func TestGamingExcludedDebit(t *testing.T) {
+	gamedWalletService := NewWalletService(gormDB, rd, log, WalletServiceSettings{}, userService)
+	NewGamingService(gormDB, log, GamingServiceSettings{}, gamedWalletService)
+
+	sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")).
+		WithArgs(3, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).AddRow(3, 3, "First Wallet", 10000))
+	sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `gaming_controls` WHERE user_id = ? LIMIT 1")).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows(gamingControlColumns).
+			AddRow(3, 0, pkg.PeriodDay, 0, pkg.PeriodDay, 0, pkg.PeriodDay, 0, pkg.PeriodDay, nil, nil, time.Now().AddDate(1, 0, 0)))
+
+	_, err := gamedWalletService.Debit(context.Background(), &api.DebitRequest{UserId: 3, WalletId: 3, Amount: decimal.NewFromInt(5)})
+
+	if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
+		t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
+	}
+
+	require.ErrorIs(t, err, pkg.ErrSelfExcluded)
+}
+
+func TestGamingExcludedTransfer(t *testing.T) {
+	gamedWalletService := NewWalletService(gormDB, rd, log, WalletServiceSettings{}, userService)
+	NewGamingService(gormDB, log, GamingServiceSettings{}, gamedWalletService)
+
+	sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")).
+		WithArgs(3, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).AddRow(3, 3, "First Wallet", 10000))
+	sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE id = ? ORDER BY `wallets`.`id` LIMIT 1")).
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).AddRow(4, 4, "Main Wallet", 500))
+	sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `gaming_controls` WHERE user_id = ? LIMIT 1")).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows(gamingControlColumns).
+			AddRow(3, 0, pkg.PeriodDay, 0, pkg.PeriodDay, 0, pkg.PeriodDay, 0, pkg.PeriodDay, nil, nil, time.Now().AddDate(1, 0, 0)))
+
+	_, err := gamedWalletService.Transfer(context.Background(), &api.TransferRequest{UserId: 3, WalletId: 3, ToWalletId: 4, Amount: decimal.NewFromInt(5)})
+
+	if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
+		t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
+	}
+
+	require.ErrorIs(t, err, pkg.ErrSelfExcluded)
+}
+
+func TestGamingDepositLimit(t *testing.T) {
+	gamedWalletService := NewWalletService(gormDB, rd, log, WalletServiceSettings{}, userService)
+	NewGamingService(gormDB, log, GamingServiceSettings{}, gamedWalletService)
+
+	// credits without a category are deposits
+	sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")).
+		WithArgs(3, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).AddRow(3, 3, "First Wallet", 10000))
+	sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `gaming_controls` WHERE user_id = ? LIMIT 1")).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows(gamingControlColumns).
+			AddRow(3, 5000, pkg.PeriodDay, 0, pkg.PeriodDay, 5000, pkg.PeriodDay, 0, pkg.PeriodDay, nil, nil, nil))
+	sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(SUM(CASE WHEN type = ? AND COALESCE(category, '') <> ?")).
+		WithArgs(pkg.TransactionCredit, pkg.CategoryWin, sqlmock.AnyArg(), sqlmock.AnyArg(), pkg.CategoryTransfer, pkg.TransactionDebit, pkg.CategoryWin, 3, pkg.TransactionCompleted, 0, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"deposits", "net_loss"}).AddRow(4900, 0))
+
+	_, err := gamedWalletService.Credit(context.Background(), &api.CreditRequest{UserId: 3, WalletId: 3, Amount: decimal.NewFromInt(5)})
+
+	if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
+		t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
+	}
+
+	require.ErrorIs(t, err, pkg.ErrDepositLimitReached)
+}
+
+func TestGamingWins(t *testing.T) {
+	gamedWalletService := NewWalletService(gormDB, rd, log, WalletServiceSettings{RedisCacheTimeout: time.Hour}, userService)
+	NewGamingService(gormDB, log, GamingServiceSettings{}, gamedWalletService)
+
+	t.Run("Players can't send their credits as wins", func(t *testing.T) {
+		_, err := gamedWalletService.Credit(context.Background(), &api.CreditRequest{UserId: 3, WalletId: 3, Amount: decimal.NewFromInt(5), Category: pkg.CategoryWin})
+
+		if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
+			t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
+		}
+
+		require.ErrorIs(t, err, pkg.ErrGameServerOnly)
+	})
+
+	t.Run("Wins from game servers skip the deposit limit", func(t *testing.T) {
+		sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE id = ? ORDER BY `wallets`.`id` LIMIT 1")).
+			WithArgs(3).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).AddRow(3, 3, "First Wallet", 10000))
+		sqlMock.ExpectBegin()
+		expectLockedWallets([2]int{3, 10000})
+		sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE `wallets` SET `funds`=? WHERE `id` = ?")).
+			WithArgs(10500, 3).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO `transactions`")).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO `outbox_events`")).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		sqlMock.ExpectCommit()
+
+		redisClientMock.Regexp().ExpectSet(utils.GenerateRedisKey(3), `^[0-9]`, time.Hour).SetVal("ok")
+
+		res, err := gamedWalletService.CreditWin(context.Background(), &api.WinRequest{WalletId: 3, Amount: decimal.NewFromInt(5)})
+
+		if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
+			t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
+		}
+		if redisMockErr := redisClientMock.ExpectationsWereMet(); redisMockErr != nil {
+			t.Errorf("there were unfulfilled expectations: %s", redisMockErr)
+		}
+
+		require.NoError(t, err)
+		require.Equal(t, 3, res.UserID)
+		require.Equal(t, "105", res.Balance.String())
+	})
+}
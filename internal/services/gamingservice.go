@@ -0,0 +1,382 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"wallet-api/api"
+	"wallet-api/internal/logging"
+	"wallet-api/internal/pkg"
+)
+
+type GamingService struct {
+	DBConn   *gorm.DB
+	logger   *zap.Logger
+	settings atomic.Pointer[GamingServiceSettings]
+}
+
+// GamingServiceSettings used to affect code flow
+type GamingServiceSettings struct {
+	LimitIncreaseDelay time.Duration // time before an increased limit applies
+}
+
+type GamingServices interface {
+	GetControls(ctx context.Context, userID int) (*api.GamingControlsResponse, error)
+	SetLimits(ctx context.Context, userID int, req *api.GamingLimitsRequest) (*api.GamingControlsResponse, error)
+	CoolOff(ctx context.Context, userID int, req *api.ExclusionRequest) (*api.GamingControlsResponse, error)
+	SelfExclude(ctx context.Context, userID int, req *api.ExclusionRequest) (*api.GamingControlsResponse, error)
+}
+
+// gamingUsage is what the user deposited and lost in the limit periods
+type gamingUsage struct {
+	Deposits int64
+	NetLoss  int64
+}
+
+func NewGamingService(dbConn *gorm.DB, logger *zap.Logger, settings GamingServiceSettings, walletService *WalletService) *GamingService {
+	service := &GamingService{
+		DBConn: dbConn,
+		logger: logger,
+	}
+	service.settings.Store(&settings)
+
+	walletService.Gaming = service
+
+	return service
+}
+
+// Settings returns the settings the service currently runs with
+func (service *GamingService) Settings() GamingServiceSettings {
+	return *service.settings.Load()
+}
+
+// UpdateSettings applies the settings to the running service, the increases already waiting keep their date
+func (service *GamingService) UpdateSettings(settings GamingServiceSettings) {
+	service.settings.Store(&settings)
+}
+
+// GetControls returns the user's responsible gaming settings
+func (service *GamingService) GetControls(ctx context.Context, userID int) (*api.GamingControlsResponse, error) {
+
+	control, err := service.getControl(ctx, service.DBConn, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return gamingControlsResponse(control), nil
+}
+
+// SetLimits applies decreases of the limits straight away while increases wait for the cooling period
+func (service *GamingService) SetLimits(ctx context.Context, userID int, req *api.GamingLimitsRequest) (*api.GamingControlsResponse, error) {
+
+	for _, limit := range []*decimal.Decimal{req.DepositLimit, req.LossLimit} {
+		if limit != nil && !validLimit(*limit) {
+			return nil, pkg.ErrWrongAmount
+		}
+	}
+
+	control, err := service.getControl(ctx, service.DBConn, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	setDeposit := req.DepositLimit != nil || req.DepositPeriod != ""
+	setLoss := req.LossLimit != nil || req.LossPeriod != ""
+
+	// the limits left out keep their current value along with any increase still waiting for the cooling period
+	keepPending := control.PendingFrom.Valid &&
+		((!setDeposit && (control.PendingDepositLimit != control.DepositLimit || control.PendingDepositPeriod != control.DepositPeriod)) ||
+			(!setLoss && (control.PendingLossLimit != control.LossLimit || control.PendingLossPeriod != control.LossPeriod)))
+	if !keepPending {
+		control.PendingDepositLimit, control.PendingDepositPeriod = control.DepositLimit, control.DepositPeriod
+		control.PendingLossLimit, control.PendingLossPeriod = control.LossLimit, control.LossPeriod
+	}
+
+	var depositIncrease, lossIncrease bool
+
+	if setDeposit {
+		depositLimit, depositPeriod := limitOrCurrent(req.DepositLimit, control.DepositLimit), periodOrCurrent(req.DepositPeriod, control.DepositPeriod)
+
+		// a change of period is only a decrease when the limit applies to a longer period
+		depositIncrease = pkg.IsIncrease(control.DepositLimit, depositLimit) ||
+			(control.DepositLimit > 0 && periodIsShorter(depositPeriod, control.DepositPeriod))
+
+		control.PendingDepositLimit, control.PendingDepositPeriod = depositLimit, depositPeriod
+		if !depositIncrease {
+			control.DepositLimit, control.DepositPeriod = depositLimit, depositPeriod
+		}
+	}
+
+	if setLoss {
+		lossLimit, lossPeriod := limitOrCurrent(req.LossLimit, control.LossLimit), periodOrCurrent(req.LossPeriod, control.LossPeriod)
+
+		lossIncrease = pkg.IsIncrease(control.LossLimit, lossLimit) ||
+			(control.LossLimit > 0 && periodIsShorter(lossPeriod, control.LossPeriod))
+
+		control.PendingLossLimit, control.PendingLossPeriod = lossLimit, lossPeriod
+		if !lossIncrease {
+			control.LossLimit, control.LossPeriod = lossLimit, lossPeriod
+		}
+	}
+
+	switch {
+	case depositIncrease || lossIncrease:
+		control.PendingFrom = sql.NullTime{
+			Time:  service.DBConn.NowFunc().Add(service.Settings().LimitIncreaseDelay),
+			Valid: true,
+		}
+	case !keepPending:
+		control.PendingFrom = sql.NullTime{}
+	}
+
+	if err = service.saveControl(ctx, control); err != nil {
+		return nil, err
+	}
+
+	return gamingControlsResponse(control), nil
+}
+
+// CoolOff refuses the user's debits for the days requested
+func (service *GamingService) CoolOff(ctx context.Context, userID int, req *api.ExclusionRequest) (*api.GamingControlsResponse, error) {
+
+	if req.Days < 1 || req.Days > pkg.MaxCoolingOffDays {
+		return nil, pkg.ErrInvalidCoolingOff
+	}
+
+	control, err := service.getControl(ctx, service.DBConn, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if control.CoolingOffUntil, err = service.extend(control.CoolingOffUntil, req.Days); err != nil {
+		return nil, err
+	}
+
+	if err = service.saveControl(ctx, control); err != nil {
+		return nil, err
+	}
+
+	return gamingControlsResponse(control), nil
+}
+
+// SelfExclude refuses the user's debits for the days requested, it cannot be undone until it's over
+func (service *GamingService) SelfExclude(ctx context.Context, userID int, req *api.ExclusionRequest) (*api.GamingControlsResponse, error) {
+
+	if req.Days < pkg.MinSelfExclusionDays {
+		return nil, pkg.ErrInvalidSelfExclusion
+	}
+
+	control, err := service.getControl(ctx, service.DBConn, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if control.SelfExcludedUntil, err = service.extend(control.SelfExcludedUntil, req.Days); err != nil {
+		return nil, err
+	}
+
+	if err = service.saveControl(ctx, control); err != nil {
+		return nil, err
+	}
+
+	return gamingControlsResponse(control), nil
+}
+
+// checkDebit refuses debits while the user is excluded or when they would break the net loss limit
+func (service *GamingService) checkDebit(ctx context.Context, db *gorm.DB, wallet *pkg.Wallet, txn *pkg.Transaction) error {
+
+	control, err := service.getControl(ctx, db, wallet.UserID)
+	if err != nil {
+		return err
+	}
+
+	now := service.DBConn.NowFunc()
+
+	if control.SelfExcludedUntil.Valid && now.Before(control.SelfExcludedUntil.Time) {
+		return service.gamingError(ctx, pkg.ErrSelfExcluded, txn)
+	}
+
+	if control.CoolingOffUntil.Valid && now.Before(control.CoolingOffUntil.Time) {
+		return service.gamingError(ctx, pkg.ErrCoolingOff, txn)
+	}
+
+	// transfers move the funds without staking them
+	if control.LossLimit == 0 || txn.Category == pkg.CategoryTransfer {
+		return nil
+	}
+
+	usage, err := service.usage(ctx, db, wallet.UserID, txn.ID, control, now)
+	if err != nil {
+		return err
+	}
+
+	if int(usage.NetLoss)+txn.Amount > control.LossLimit {
+		return service.gamingError(ctx, pkg.ErrLossLimitReached, txn)
+	}
+
+	return nil
+}
+
+// checkCredit refuses deposits that would break the deposit limit, every credit is a deposit but the wins credited by
+// the game servers
+func (service *GamingService) checkCredit(ctx context.Context, wallet *pkg.Wallet, txn *pkg.Transaction) error {
+
+	if txn.Category == pkg.CategoryWin {
+		return nil
+	}
+
+	control, err := service.getControl(ctx, service.DBConn, wallet.UserID)
+	if err != nil || control.DepositLimit == 0 {
+		return err
+	}
+
+	usage, err := service.usage(ctx, service.DBConn, wallet.UserID, txn.ID, control, service.DBConn.NowFunc())
+	if err != nil {
+		return err
+	}
+
+	if int(usage.Deposits)+txn.Amount > control.DepositLimit {
+		return service.gamingError(ctx, pkg.ErrDepositLimitReached, txn)
+	}
+
+	return nil
+}
+
+// usage sums the user's deposits and net loss (debits minus wins) across all their wallets, transfers aren't stakes so
+// they're left out of the loss. The transaction being checked is left out too, it may already be saved when a pending
+// debit is approved.
+func (service *GamingService) usage(ctx context.Context, db *gorm.DB, userID, txnID int, control *pkg.GamingControl, now time.Time) (*gamingUsage, error) {
+
+	depositStart := pkg.PeriodStart(control.DepositPeriod, now)
+	lossStart := pkg.PeriodStart(control.LossPeriod, now)
+
+	from := depositStart
+	if lossStart.Before(from) {
+		from = lossStart
+	}
+
+	var usage gamingUsage
+	res := db.WithContext(ctx).
+		Model(&pkg.Transaction{}).
+		Select("COALESCE(SUM(CASE WHEN type = ? AND COALESCE(category, '') <> ? AND created_at >= ? THEN amount ELSE 0 END), 0) AS deposits, "+
+			"COALESCE(SUM(CASE WHEN created_at < ? OR category = ? THEN 0 WHEN type = ? THEN amount WHEN category = ? THEN -amount ELSE 0 END), 0) AS net_loss",
+			pkg.TransactionCredit, pkg.CategoryWin, depositStart, lossStart, pkg.CategoryTransfer, pkg.TransactionDebit, pkg.CategoryWin).
+		Where("user_id = ? AND status = ? AND id <> ? AND created_at >= ?", userID, pkg.TransactionCompleted, txnID, from).
+		Scan(&usage)
+	if res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong getting the gaming usage", zap.Error(res.Error), zap.Int("user_id", userID))
+		return nil, res.Error
+	}
+
+	return &usage, nil
+}
+
+// getControl returns the user's settings with any pending increase applied, or empty ones if they never set any
+func (service *GamingService) getControl(ctx context.Context, db *gorm.DB, userID int) (*pkg.GamingControl, error) {
+
+	var controls []pkg.GamingControl
+	res := db.WithContext(ctx).Where("user_id = ?", userID).Limit(1).Find(&controls)
+	if res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong getting the gaming controls", zap.Error(res.Error), zap.Int("user_id", userID))
+		return nil, res.Error
+	}
+
+	if len(controls) == 0 {
+		return &pkg.GamingControl{UserID: userID, DepositPeriod: pkg.PeriodDay, LossPeriod: pkg.PeriodDay}, nil
+	}
+
+	controls[0].ApplyPending(service.DBConn.NowFunc())
+
+	return &controls[0], nil
+}
+
+func (service *GamingService) saveControl(ctx context.Context, control *pkg.GamingControl) error {
+	if res := service.DBConn.WithContext(ctx).Save(control); res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong saving the gaming controls", zap.Error(res.Error), zap.Any("control", control))
+		return res.Error
+	}
+
+	return nil
+}
+
+// extend returns the end of a new exclusion period, refusing to shorten one that's still active
+func (service *GamingService) extend(until sql.NullTime, days int) (sql.NullTime, error) {
+	end := service.DBConn.NowFunc().AddDate(0, 0, days)
+
+	if until.Valid && until.Time.After(end) {
+		return until, pkg.ErrExclusionActive
+	}
+
+	return sql.NullTime{Time: end, Valid: true}, nil
+}
+
+func (service *GamingService) gamingError(ctx context.Context, err error, txn *pkg.Transaction) error {
+	logging.From(ctx, service.logger).Error("transaction refused by responsible gaming controls", zap.Error(err), zap.Any("transaction", txn))
+	return err
+}
+
+// limitOrCurrent returns the limit sent in 100s, or the current one when it was left out
+func limitOrCurrent(limit *decimal.Decimal, current int) int {
+	if limit == nil {
+		return current
+	}
+
+	return toCents(*limit)
+}
+
+// periodOrCurrent returns the period sent, or the current one when it was left out
+func periodOrCurrent(period, current string) string {
+	if period == "" {
+		return periodOrDefault(current)
+	}
+
+	return period
+}
+
+func periodOrDefault(period string) string {
+	if period == "" {
+		return pkg.PeriodDay
+	}
+
+	return period
+}
+
+// periodIsShorter checks if the new period is shorter than the current one, the same limit over less time is looser
+func periodIsShorter(period, current string) bool {
+	days := map[string]int{pkg.PeriodDay: 1, pkg.PeriodWeek: 7, pkg.PeriodMonth: 30}
+
+	return days[periodOrDefault(period)] < days[periodOrDefault(current)]
+}
+
+func gamingControlsResponse(control *pkg.GamingControl) *api.GamingControlsResponse {
+	res := &api.GamingControlsResponse{
+		UserID:        control.UserID,
+		DepositLimit:  fromCents(control.DepositLimit),
+		DepositPeriod: control.DepositPeriod,
+		LossLimit:     fromCents(control.LossLimit),
+		LossPeriod:    control.LossPeriod,
+	}
+
+	if control.PendingFrom.Valid {
+		pendingDeposit, pendingLoss := fromCents(control.PendingDepositLimit), fromCents(control.PendingLossLimit)
+		res.PendingDepositLimit, res.PendingDepositPeriod = &pendingDeposit, control.PendingDepositPeriod
+		res.PendingLossLimit, res.PendingLossPeriod = &pendingLoss, control.PendingLossPeriod
+		res.PendingFrom = &control.PendingFrom.Time
+	}
+
+	if control.CoolingOffUntil.Valid {
+		res.CoolingOffUntil = &control.CoolingOffUntil.Time
+	}
+
+	if control.SelfExcludedUntil.Valid {
+		res.SelfExcludedUntil = &control.SelfExcludedUntil.Time
+	}
+
+	return res
+}
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+
+	"wallet-api/api"
+	"wallet-api/internal/pkg"
+	"wallet-api/internal/utils"
+)
+
+type guardedDebitTestCase struct {
+	Name           string
+	Input          *api.DebitRequest
+	ExpectedStatus string
+	ExpectedErr    error
+	SqlMock        func(test guardedDebitTestCase)
+}
+
+var (
+	controlsQuery = regexp.QuoteMeta("SELECT * FROM `wallet_controls` WHERE wallet_id = ? LIMIT 1")
+	spentQuery    = regexp.QuoteMeta("SELECT COALESCE(SUM(amount), 0) FROM `transactions` WHERE wallet_id = ? AND type = ? AND status IN (?,?) AND id <> ? AND created_at >= ?")
+
+	controlColumns = []string{"wallet_id", "guardian_id", "daily_spend_limit", "approval_threshold", "blocked_categories"}
+)
+
+func TestGuardedDebit(t *testing.T) {
+	guardedWalletService := NewWalletService(gormDB, rd, log, WalletServiceSettings{RedisCacheTimeout: time.Hour}, userService)
+	NewGuardianService(gormDB, log, userService, guardedWalletService)
+
+	walletQuery := regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")
+
+	testCases := []guardedDebitTestCase{
+		{
+			Name: "Debit over the threshold waits for approval",
+			Input: &api.DebitRequest{
+				UserId:   2,
+				WalletId: 2,
+				Amount:   decimal.NewFromInt(30),
+			},
+			ExpectedStatus: pkg.TransactionPending,
+			SqlMock: func(test guardedDebitTestCase) {
+				sqlMock.ExpectQuery(walletQuery).
+					WithArgs(test.Input.WalletId, test.Input.UserId).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).
+						AddRow(test.Input.WalletId, test.Input.UserId, "Main Wallet", 10000))
+				sqlMock.ExpectQuery(controlsQuery).
+					WithArgs(test.Input.WalletId).
+					WillReturnRows(sqlmock.NewRows(controlColumns).AddRow(2, 1, 0, 2000, ""))
+
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO `transactions`")).
+					WillReturnResult(sqlmock.NewResult(7, 1))
+				sqlMock.ExpectCommit()
+			},
+		},
+		{
+			Name: "Debit over the threshold without the funds isn't left waiting",
+			Input: &api.DebitRequest{
+				UserId:   2,
+				WalletId: 2,
+				Amount:   decimal.NewFromInt(150),
+			},
+			ExpectedErr: pkg.ErrNotEnoughFunds,
+			SqlMock: func(test guardedDebitTestCase) {
+				sqlMock.ExpectQuery(walletQuery).
+					WithArgs(test.Input.WalletId, test.Input.UserId).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).
+						AddRow(test.Input.WalletId, test.Input.UserId, "Main Wallet", 10000))
+				sqlMock.ExpectQuery(controlsQuery).
+					WithArgs(test.Input.WalletId).
+					WillReturnRows(sqlmock.NewRows(controlColumns).AddRow(2, 1, 0, 2000, ""))
+			},
+		},
+		{
+			Name: "Debit in a blocked category",
+			Input: &api.DebitRequest{
+				UserId:   2,
+				WalletId: 2,
+				Amount:   decimal.NewFromInt(5),
+				Category: "Casino",
+			},
+			ExpectedErr: pkg.ErrCategoryBlocked,
+			SqlMock: func(test guardedDebitTestCase) {
+				sqlMock.ExpectQuery(walletQuery).
+					WithArgs(test.Input.WalletId, test.Input.UserId).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).
+						AddRow(test.Input.WalletId, test.Input.UserId, "Main Wallet", 10000))
+				sqlMock.ExpectQuery(controlsQuery).
+					WithArgs(test.Input.WalletId).
+					WillReturnRows(sqlmock.NewRows(controlColumns).AddRow(2, 1, 0, 0, "sports,casino"))
+			},
+		},
+		{
+			Name: "Debit without a category while categories are blocked",
+			Input: &api.DebitRequest{
+				UserId:   2,
+				WalletId: 2,
+				Amount:   decimal.NewFromInt(5),
+			},
+			ExpectedErr: pkg.ErrCategoryBlocked,
+			SqlMock: func(test guardedDebitTestCase) {
+				sqlMock.ExpectQuery(walletQuery).
+					WithArgs(test.Input.WalletId, test.Input.UserId).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).
+						AddRow(test.Input.WalletId, test.Input.UserId, "Main Wallet", 10000))
+				sqlMock.ExpectQuery(controlsQuery).
+					WithArgs(test.Input.WalletId).
+					WillReturnRows(sqlmock.NewRows(controlColumns).AddRow(2, 1, 0, 0, "casino"))
+			},
+		},
+		{
+			Name: "Debit over the daily spend limit",
+			Input: &api.DebitRequest{
+				UserId:   2,
+				WalletId: 2,
+				Amount:   decimal.NewFromInt(15),
+			},
+			ExpectedErr: pkg.ErrSpendLimitReached,
+			SqlMock: func(test guardedDebitTestCase) {
+				sqlMock.ExpectQuery(walletQuery).
+					WithArgs(test.Input.WalletId, test.Input.UserId).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).
+						AddRow(test.Input.WalletId, test.Input.UserId, "Main Wallet", 10000))
+				sqlMock.ExpectQuery(controlsQuery).
+					WithArgs(test.Input.WalletId).
+					WillReturnRows(sqlmock.NewRows(controlColumns).AddRow(2, 1, 2000, 0, ""))
+				sqlMock.ExpectQuery(spentQuery).
+					WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(1000))
+			},
+		},
+		{
+			Name: "Debit within the controls goes through",
+			Input: &api.DebitRequest{
+				UserId:   2,
+				WalletId: 2,
+				Amount:   decimal.NewFromInt(5),
+				Category: "books",
+			},
+			ExpectedStatus: pkg.TransactionCompleted,
+			SqlMock: func(test guardedDebitTestCase) {
+				sqlMock.ExpectQuery(walletQuery).
+					WithArgs(test.Input.WalletId, test.Input.UserId).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).
+						AddRow(test.Input.WalletId, test.Input.UserId, "Main Wallet", 10000))
+				sqlMock.ExpectQuery(controlsQuery).
+					WithArgs(test.Input.WalletId).
+					WillReturnRows(sqlmock.NewRows(controlColumns).AddRow(2, 1, 2000, 1000, "casino"))
+				sqlMock.ExpectQuery(spentQuery).
+					WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(0))
+
+				sqlMock.ExpectBegin()
+				expectLockedWallets([2]int{2, 10000})
+				sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE `wallets` SET `funds`=? WHERE `id` = ?")).
+					WithArgs(9500, 2).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO `transactions`")).
+					WillReturnResult(sqlmock.NewResult(8, 1))
+				sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO `outbox_events`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				sqlMock.ExpectCommit()
+
+				redisClientMock.Regexp().ExpectSet(utils.GenerateRedisKey(test.Input.WalletId), `^[0-9]`, 60*time.Minute).SetVal("ok")
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+
+			test.SqlMock(test)
+
+			res, err := guardedWalletService.Debit(context.Background(), test.Input)
+
+			if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
+				t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
+			}
+			if redisMockErr := redisClientMock.ExpectationsWereMet(); redisMockErr != nil {
+				t.Errorf("there were unfulfilled expectations: %s", redisMockErr)
+			}
+
+			if test.ExpectedErr != nil {
+				require.ErrorIs(t, err, test.ExpectedErr)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, test.ExpectedStatus, res.Status)
+			}
+		})
+	}
+}
+
+type approveDebitTestCase struct {
+	Name        string
+	ExpectedErr error
+	SqlMock     func()
+}
+
+func TestApproveDebit(t *testing.T) {
+	guardedWalletService := NewWalletService(gormDB, rd, log, WalletServiceSettings{}, userService)
+	guardianService := NewGuardianService(gormDB, log, userService, guardedWalletService)
+
+	expectPendingDebit := func() {
+		sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `transactions` WHERE id = ?")).
+			WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "wallet_id", "user_id", "type", "amount", "status"}).
+				AddRow(7, 2, 2, pkg.TransactionDebit, 3000, pkg.TransactionPending))
+		sqlMock.ExpectQuery(regexp.QuoteMeta("FROM `wallets` JOIN guardian_links ON guardian_links.minor_id = wallets.user_id")).
+			WithArgs(2, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).AddRow(2, 2, "Main Wallet", 10000))
+		sqlMock.ExpectBegin()
+		expectLockedWallets([2]int{2, 10000})
+	}
+	claimQuery := regexp.QuoteMeta("UPDATE `transactions` SET `status`=?,`updated_at`=? WHERE id = ? AND status = ?")
+
+	testCases := []approveDebitTestCase{
+		{
+			Name:        "Debit already approved or rejected",
+			ExpectedErr: pkg.ErrTransactionNotPending,
+			SqlMock: func() {
+				expectPendingDebit()
+				sqlMock.ExpectExec(claimQuery).
+					WithArgs(pkg.TransactionCompleted, sqlmock.AnyArg(), 7, pkg.TransactionPending).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				sqlMock.ExpectRollback()
+			},
+		},
+		{
+			Name:        "Debits waiting for approval count towards the daily spend",
+			ExpectedErr: pkg.ErrSpendLimitReached,
+			SqlMock: func() {
+				expectPendingDebit()
+				sqlMock.ExpectExec(claimQuery).
+					WithArgs(pkg.TransactionCompleted, sqlmock.AnyArg(), 7, pkg.TransactionPending).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectQuery(controlsQuery).
+					WithArgs(2).
+					WillReturnRows(sqlmock.NewRows(controlColumns).AddRow(2, 1, 5000, 2000, ""))
+				sqlMock.ExpectQuery(spentQuery).
+					WithArgs(2, pkg.TransactionDebit, pkg.TransactionCompleted, pkg.TransactionPending, 7, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(2500))
+				sqlMock.ExpectRollback()
+			},
+		},
+		{
+			Name: "Approved debit is applied",
+			SqlMock: func() {
+				expectPendingDebit()
+				sqlMock.ExpectExec(claimQuery).
+					WithArgs(pkg.TransactionCompleted, sqlmock.AnyArg(), 7, pkg.TransactionPending).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectQuery(controlsQuery).
+					WithArgs(2).
+					WillReturnRows(sqlmock.NewRows(controlColumns).AddRow(2, 1, 5000, 2000, ""))
+				sqlMock.ExpectQuery(spentQuery).
+					WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(1000))
+				sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE `wallets` SET `funds`=? WHERE `id` = ?")).
+					WithArgs(7000, 2).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE `transactions`")).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO `outbox_events`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				sqlMock.ExpectCommit()
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+
+			test.SqlMock()
+
+			res, err := guardianService.ApproveDebit(context.Background(), 1, 7)
+
+			if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
+				t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
+			}
+
+			if test.ExpectedErr != nil {
+				require.ErrorIs(t, err, test.ExpectedErr)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, pkg.TransactionCompleted, res.Status)
+				require.Equal(t, "70", res.Balance.String())
+			}
+		})
+	}
+}
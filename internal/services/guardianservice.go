@@ -0,0 +1,409 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"wallet-api/api"
+	"wallet-api/internal/logging"
+	"wallet-api/internal/metrics"
+	"wallet-api/internal/pkg"
+)
+
+type GuardianService struct {
+	DBConn        *gorm.DB
+	logger        *zap.Logger
+	UserService   *UserService
+	WalletService *WalletService
+}
+
+type GuardianServices interface {
+	LinkMinor(ctx context.Context, guardianID int, req api.LinkMinorRequest) (*pkg.GuardianLink, error)
+	GetMinors(ctx context.Context, guardianID int) ([]api.User, error)
+	GetWalletControls(ctx context.Context, guardianID, walletID int) (*api.WalletControlsResponse, error)
+	SetWalletControls(ctx context.Context, guardianID, walletID int, req *api.WalletControlsRequest) (*api.WalletControlsResponse, error)
+	GetWalletTransactions(ctx context.Context, guardianID, walletID int) ([]api.TransactionResponse, error)
+	ApproveDebit(ctx context.Context, guardianID, transactionID int) (*api.DebitResponse, error)
+	RejectDebit(ctx context.Context, guardianID, transactionID int) (*api.TransactionResponse, error)
+}
+
+func NewGuardianService(dbConn *gorm.DB, logger *zap.Logger, userService *UserService, walletService *WalletService) *GuardianService {
+	service := &GuardianService{
+		DBConn:        dbConn,
+		logger:        logger,
+		UserService:   userService,
+		WalletService: walletService,
+	}
+
+	walletService.Guardian = service
+
+	return service
+}
+
+// LinkMinor links the minor to the guardian, it's done by an admin once the family checked who manages the account
+func (service *GuardianService) LinkMinor(ctx context.Context, guardianID int, req api.LinkMinorRequest) (*pkg.GuardianLink, error) {
+
+	minor, err := service.UserService.GetUserByUsername(ctx, req.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	if !minor.IsMinor() {
+		return nil, pkg.ErrNotAMinor
+	}
+
+	var links int64
+	if res := service.DBConn.WithContext(ctx).Model(&pkg.GuardianLink{}).Where("minor_id = ?", minor.ID).Count(&links); res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong checking the minor's link", zap.Error(res.Error), zap.Uint("minor_id", minor.ID))
+		return nil, res.Error
+	}
+
+	if links > 0 {
+		return nil, pkg.ErrMinorAlreadyLinked
+	}
+
+	var guardian pkg.User
+	if res := service.DBConn.WithContext(ctx).Select("id", "age").Where("id = ?", guardianID).First(&guardian); res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong getting the guardian", zap.Error(res.Error), zap.Int("guardian_id", guardianID))
+		return nil, res.Error
+	}
+
+	if guardian.IsMinor() {
+		return nil, pkg.ErrGuardianNotAdult
+	}
+
+	link := &pkg.GuardianLink{GuardianID: guardianID, MinorID: int(minor.ID)}
+	if res := service.DBConn.WithContext(ctx).Create(link); res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong linking the minor", zap.Error(res.Error), zap.Any("link", link))
+		return nil, res.Error
+	}
+
+	return link, nil
+}
+
+// GetMinors returns the users linked to the guardian
+func (service *GuardianService) GetMinors(ctx context.Context, guardianID int) ([]api.User, error) {
+
+	var minors []api.User
+	res := service.DBConn.WithContext(ctx).
+		Table("users").
+		Select("users.id", "users.first_name", "users.last_name", "users.email", "users.age", "users.username").
+		Joins("JOIN guardian_links ON guardian_links.minor_id = users.id").
+		Where("guardian_links.guardian_id = ?", guardianID).
+		Find(&minors)
+	if res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong getting the minors", zap.Error(res.Error), zap.Int("guardian_id", guardianID))
+		return nil, res.Error
+	}
+
+	return minors, nil
+}
+
+// GetWalletControls returns the restrictions on the minor's wallet
+func (service *GuardianService) GetWalletControls(ctx context.Context, guardianID, walletID int) (*api.WalletControlsResponse, error) {
+
+	if _, err := service.guardedWallet(ctx, guardianID, walletID); err != nil {
+		return nil, err
+	}
+
+	control, err := service.getWalletControl(ctx, service.DBConn, walletID)
+	if err != nil {
+		return nil, err
+	}
+
+	if control == nil {
+		control = &pkg.WalletControl{WalletID: walletID}
+	}
+
+	return walletControlsResponse(control), nil
+}
+
+// SetWalletControls saves the restrictions on the minor's wallet, replacing any previous ones
+func (service *GuardianService) SetWalletControls(ctx context.Context, guardianID, walletID int, req *api.WalletControlsRequest) (*api.WalletControlsResponse, error) {
+
+	if !validLimit(req.DailySpendLimit) || !validLimit(req.ApprovalThreshold) {
+		return nil, pkg.ErrWrongAmount
+	}
+
+	if _, err := service.guardedWallet(ctx, guardianID, walletID); err != nil {
+		return nil, err
+	}
+
+	categories := make([]string, 0, len(req.BlockedCategories))
+	for _, category := range req.BlockedCategories {
+		if category = strings.TrimSpace(category); category != "" {
+			categories = append(categories, strings.ToLower(category))
+		}
+	}
+
+	control := &pkg.WalletControl{
+		WalletID:          walletID,
+		GuardianID:        guardianID,
+		DailySpendLimit:   toCents(req.DailySpendLimit),
+		ApprovalThreshold: toCents(req.ApprovalThreshold),
+		BlockedCategories: strings.Join(categories, ","),
+	}
+
+	if res := service.DBConn.WithContext(ctx).Save(control); res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong saving the wallet controls", zap.Error(res.Error), zap.Any("control", control))
+		return nil, res.Error
+	}
+
+	return walletControlsResponse(control), nil
+}
+
+// GetWalletTransactions returns the full history of the minor's wallet, including pending and rejected debits
+func (service *GuardianService) GetWalletTransactions(ctx context.Context, guardianID, walletID int) ([]api.TransactionResponse, error) {
+
+	if _, err := service.guardedWallet(ctx, guardianID, walletID); err != nil {
+		return nil, err
+	}
+
+	var txns []pkg.Transaction
+	res := service.DBConn.WithContext(ctx).
+		Where("wallet_id = ?", walletID).
+		Order("id desc").
+		Find(&txns)
+	if res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong getting the wallet transactions", zap.Error(res.Error), zap.Int("wallet_id", walletID))
+		return nil, res.Error
+	}
+
+	history := make([]api.TransactionResponse, 0, len(txns))
+	for i := range txns {
+		history = append(history, *transactionResponse(&txns[i]))
+	}
+
+	return history, nil
+}
+
+// ApproveDebit applies a pending debit to the minor's wallet. The limits and controls are checked again with the wallet
+// locked, they may have changed or been used up by other debits while this one was waiting.
+func (service *GuardianService) ApproveDebit(ctx context.Context, guardianID, transactionID int) (*api.DebitResponse, error) {
+
+	txn, wallet, err := service.pendingDebit(ctx, guardianID, transactionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = service.WalletService.checkWalletStatus(ctx, wallet, pkg.TransactionDebit); err != nil {
+		return nil, err
+	}
+
+	txn.Status = pkg.TransactionCompleted
+	err = service.WalletService.saveEntries(ctx, func(tx *gorm.DB) error {
+		if err := claimPending(tx, txn, pkg.TransactionCompleted); err != nil {
+			return err
+		}
+
+		return service.checkApproval(ctx, tx, wallet, txn)
+	}, walletEntry{wallet: wallet, txn: txn})
+	metrics.RecordOperation(pkg.TransactionDebit, fromCents(txn.Amount), err)
+	if err != nil {
+		logging.From(ctx, service.logger).Error("something went wrong approving the debit", zap.Error(err), zap.Any("transaction", txn))
+		return nil, err
+	}
+
+	return &api.DebitResponse{
+		UserID:        wallet.UserID,
+		WalletID:      wallet.ID,
+		Balance:       fromCents(wallet.Funds),
+		TransactionID: txn.ID,
+		Status:        txn.Status,
+	}, nil
+}
+
+// RejectDebit marks a pending debit as rejected, the funds are left untouched
+func (service *GuardianService) RejectDebit(ctx context.Context, guardianID, transactionID int) (*api.TransactionResponse, error) {
+
+	txn, _, err := service.pendingDebit(ctx, guardianID, transactionID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = service.DBConn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return claimPending(tx, txn, pkg.TransactionRejected)
+	})
+	if err != nil {
+		logging.From(ctx, service.logger).Error("something went wrong rejecting the debit", zap.Error(err), zap.Any("transaction", txn))
+		return nil, err
+	}
+
+	txn.Status = pkg.TransactionRejected
+
+	return transactionResponse(txn), nil
+}
+
+// checkDebit applies the guardian's restrictions to a debit, returning true if it has to wait for approval
+func (service *GuardianService) checkDebit(ctx context.Context, wallet *pkg.Wallet, txn *pkg.Transaction) (bool, error) {
+
+	control, err := service.getWalletControl(ctx, service.DBConn, wallet.ID)
+	if err != nil || control == nil {
+		return false, err
+	}
+
+	if err = service.checkControl(ctx, service.DBConn, control, wallet, txn); err != nil {
+		return false, err
+	}
+
+	return control.ApprovalThreshold > 0 && txn.Amount > control.ApprovalThreshold, nil
+}
+
+// checkApproval runs the checks of a debit again before it's approved, the threshold aside, on the transaction holding
+// the wallet lock
+func (service *GuardianService) checkApproval(ctx context.Context, tx *gorm.DB, wallet *pkg.Wallet, txn *pkg.Transaction) error {
+
+	if gaming := service.WalletService.Gaming; gaming != nil {
+		if err := gaming.checkDebit(ctx, tx, wallet, txn); err != nil {
+			return err
+		}
+	}
+
+	control, err := service.getWalletControl(ctx, tx, wallet.ID)
+	if err != nil || control == nil {
+		return err
+	}
+
+	return service.checkControl(ctx, tx, control, wallet, txn)
+}
+
+// checkControl refuses debits in a blocked category or over the daily spend, the debits of the last 24 hours. Debits
+// waiting for approval count towards it so they can't be used to go over it once approved.
+func (service *GuardianService) checkControl(ctx context.Context, db *gorm.DB, control *pkg.WalletControl, wallet *pkg.Wallet, txn *pkg.Transaction) error {
+
+	if control.Blocks(txn.Category) {
+		err := pkg.ErrCategoryBlocked
+		logging.From(ctx, service.logger).Error("attempted to debit blocked category", zap.Error(err), zap.Any("transaction", txn))
+		return err
+	}
+
+	if control.DailySpendLimit == 0 {
+		return nil
+	}
+
+	var spent int64
+	now := service.DBConn.NowFunc()
+	res := db.WithContext(ctx).
+		Model(&pkg.Transaction{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("wallet_id = ? AND type = ? AND status IN ? AND id <> ? AND created_at >= ?",
+			wallet.ID, pkg.TransactionDebit, []string{pkg.TransactionCompleted, pkg.TransactionPending}, txn.ID, now.Add(-24*time.Hour)).
+		Scan(&spent)
+	if res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong getting the daily spend", zap.Error(res.Error), zap.Int("wallet_id", wallet.ID))
+		return res.Error
+	}
+
+	if int(spent)+txn.Amount > control.DailySpendLimit {
+		err := pkg.ErrSpendLimitReached
+		logging.From(ctx, service.logger).Error("attempted to debit over the daily limit", zap.Error(err), zap.Any("transaction", txn))
+		return err
+	}
+
+	return nil
+}
+
+// claimPending moves the debit out of pending, refusing it when another request approved or rejected it first
+func claimPending(tx *gorm.DB, txn *pkg.Transaction, status string) error {
+	res := tx.Model(&pkg.Transaction{}).
+		Where("id = ? AND status = ?", txn.ID, pkg.TransactionPending).
+		Update("status", status)
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return pkg.ErrTransactionNotPending
+	}
+
+	return nil
+}
+
+// getWalletControl returns nil without error when the wallet has no restrictions
+func (service *GuardianService) getWalletControl(ctx context.Context, db *gorm.DB, walletID int) (*pkg.WalletControl, error) {
+
+	var controls []pkg.WalletControl
+	res := db.WithContext(ctx).Where("wallet_id = ?", walletID).Limit(1).Find(&controls)
+	if res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong getting the wallet controls", zap.Error(res.Error), zap.Int("wallet_id", walletID))
+		return nil, res.Error
+	}
+
+	if len(controls) == 0 {
+		return nil, nil
+	}
+
+	return &controls[0], nil
+}
+
+// guardedWallet returns the wallet if it belongs to a minor linked to the guardian
+func (service *GuardianService) guardedWallet(ctx context.Context, guardianID, walletID int) (*pkg.Wallet, error) {
+
+	var wallet pkg.Wallet
+	res := service.DBConn.WithContext(ctx).
+		Select("wallets.id", "wallets.user_id", "wallets.name", "wallets.funds", "wallets.status", "wallets.block_credits").
+		Joins("JOIN guardian_links ON guardian_links.minor_id = wallets.user_id").
+		Where("wallets.id = ? AND guardian_links.guardian_id = ?", walletID, guardianID).
+		First(&wallet)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, pkg.ErrNotGuardian
+	} else if res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong getting the guarded wallet", zap.Error(res.Error), zap.Int("wallet_id", walletID))
+		return nil, res.Error
+	}
+
+	return &wallet, nil
+}
+
+// pendingDebit returns the pending transaction along with the wallet it belongs to
+func (service *GuardianService) pendingDebit(ctx context.Context, guardianID, transactionID int) (*pkg.Transaction, *pkg.Wallet, error) {
+
+	var txn pkg.Transaction
+	if res := service.DBConn.WithContext(ctx).Where("id = ?", transactionID).First(&txn); res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong getting the transaction", zap.Error(res.Error), zap.Int("transaction_id", transactionID))
+		return nil, nil, res.Error
+	}
+
+	wallet, err := service.guardedWallet(ctx, guardianID, txn.WalletID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if txn.Status != pkg.TransactionPending || txn.Type != pkg.TransactionDebit {
+		return nil, nil, pkg.ErrTransactionNotPending
+	}
+
+	return &txn, wallet, nil
+}
+
+func walletControlsResponse(control *pkg.WalletControl) *api.WalletControlsResponse {
+	categories := []string{}
+	if control.BlockedCategories != "" {
+		categories = strings.Split(control.BlockedCategories, ",")
+	}
+
+	return &api.WalletControlsResponse{
+		WalletID:          control.WalletID,
+		DailySpendLimit:   fromCents(control.DailySpendLimit),
+		ApprovalThreshold: fromCents(control.ApprovalThreshold),
+		BlockedCategories: categories,
+	}
+}
+
+func transactionResponse(txn *pkg.Transaction) *api.TransactionResponse {
+	return &api.TransactionResponse{
+		ID:        txn.ID,
+		WalletID:  txn.WalletID,
+		Type:      txn.Type,
+		Amount:    fromCents(txn.Amount),
+		Balance:   fromCents(txn.Balance),
+		Category:  txn.Category,
+		Status:    txn.Status,
+		CreatedAt: txn.CreatedAt,
+	}
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+
+	"wallet-api/internal/pkg"
+)
+
+type healthTestCase struct {
+	Name             string
+	Version          uint
+	Dirty            bool
+	RedisErr         error
+	ExpectedStatus   string
+	ExpectedFailures []string
+}
+
+func TestReady(t *testing.T) {
+	healthService := NewHealthService(gormDB, rd, log, HealthServiceSettings{MigrationVersion: 3, Timeout: time.Second})
+
+	migrationQuery := regexp.QuoteMeta("SELECT version, dirty FROM schema_migrations LIMIT 1")
+
+	testCases := []healthTestCase{
+		{
+			Name:           "Every dependency up",
+			Version:        3,
+			ExpectedStatus: pkg.HealthUp,
+		},
+		{
+			Name:           "Schema migrated by a newer release",
+			Version:        4,
+			ExpectedStatus: pkg.HealthUp,
+		},
+		{
+			Name:             "Schema behind the migrations",
+			Version:          2,
+			ExpectedStatus:   pkg.HealthDown,
+			ExpectedFailures: []string{pkg.HealthMigrations},
+		},
+		{
+			Name:             "Migration failed half way",
+			Version:          3,
+			Dirty:            true,
+			ExpectedStatus:   pkg.HealthDown,
+			ExpectedFailures: []string{pkg.HealthMigrations},
+		},
+		{
+			Name:             "Redis down",
+			Version:          3,
+			RedisErr:         errors.New("connection refused"),
+			ExpectedStatus:   pkg.HealthDown,
+			ExpectedFailures: []string{pkg.HealthRedis},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+
+			if test.RedisErr != nil {
+				redisClientMock.ExpectPing().SetErr(test.RedisErr)
+			} else {
+				redisClientMock.ExpectPing().SetVal("PONG")
+			}
+			sqlMock.ExpectQuery(migrationQuery).
+				WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(test.Version, test.Dirty))
+
+			res := healthService.Ready(context.Background())
+
+			require.NoError(t, sqlMock.ExpectationsWereMet())
+			require.NoError(t, redisClientMock.ExpectationsWereMet())
+
+			require.Equal(t, test.ExpectedStatus, res.Status)
+			for name, check := range res.Checks {
+				if slices.Contains(test.ExpectedFailures, name) {
+					require.Equal(t, pkg.HealthDown, check.Status, name)
+					require.NotEmpty(t, check.Error, name)
+				} else {
+					require.Equal(t, pkg.HealthUp, check.Status, name)
+				}
+			}
+			require.Equal(t, test.Version, res.Checks[pkg.HealthMigrations].Version)
+		})
+	}
+}
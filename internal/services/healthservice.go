@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"wallet-api/api"
+	"wallet-api/internal/logging"
+	"wallet-api/internal/pkg"
+)
+
+type HealthService struct {
+	DBConn   *gorm.DB
+	Cache    *redis.Client
+	logger   *zap.Logger
+	settings HealthServiceSettings
+}
+
+// HealthServiceSettings used to affect code flow
+type HealthServiceSettings struct {
+	// MigrationVersion is the version of the latest migration shipped with the api
+	MigrationVersion uint
+	// Timeout of each check
+	Timeout time.Duration
+}
+
+type HealthServices interface {
+	Ready(ctx context.Context) *api.ReadinessResponse
+}
+
+func NewHealthService(dbConn *gorm.DB, rc *redis.Client, logger *zap.Logger, settings HealthServiceSettings) *HealthService {
+	return &HealthService{
+		DBConn:   dbConn,
+		Cache:    rc,
+		logger:   logger,
+		settings: settings,
+	}
+}
+
+// Ready checks the api can serve requests, it's down when the db or redis don't answer or the schema is behind the
+// migrations shipped with the api
+func (service *HealthService) Ready(ctx context.Context) *api.ReadinessResponse {
+	res := &api.ReadinessResponse{
+		Status: pkg.HealthUp,
+		Checks: map[string]api.HealthCheck{
+			pkg.HealthMySQL:      service.check(ctx, pkg.HealthMySQL, service.pingDB),
+			pkg.HealthRedis:      service.check(ctx, pkg.HealthRedis, service.pingRedis),
+			pkg.HealthMigrations: service.checkMigrations(ctx),
+		},
+	}
+
+	for _, check := range res.Checks {
+		if check.Status != pkg.HealthUp {
+			res.Status = pkg.HealthDown
+		}
+	}
+
+	return res
+}
+
+// check runs the ping within the timeout, a dependency taking longer is as good as down for the requests
+func (service *HealthService) check(ctx context.Context, name string, ping func(context.Context) error) api.HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, service.settings.Timeout)
+	defer cancel()
+
+	if err := ping(ctx); err != nil {
+		logging.From(ctx, service.logger).Error("dependency not ready", zap.String("dependency", name), zap.Error(err))
+		return api.HealthCheck{Status: pkg.HealthDown, Error: err.Error()}
+	}
+
+	return api.HealthCheck{Status: pkg.HealthUp}
+}
+
+func (service *HealthService) pingDB(ctx context.Context) error {
+	db, err := service.DBConn.DB()
+	if err != nil {
+		return err
+	}
+
+	return db.PingContext(ctx)
+}
+
+func (service *HealthService) pingRedis(ctx context.Context) error {
+	return service.Cache.Ping(ctx).Err()
+}
+
+// checkMigrations compares the version of the schema with the latest migration. A newer schema is fine, it's been
+// migrated by a newer release rolling out and migrations are kept backwards compatible.
+func (service *HealthService) checkMigrations(ctx context.Context) api.HealthCheck {
+	check := api.HealthCheck{Status: pkg.HealthUp, Expected: service.settings.MigrationVersion}
+
+	var migration pkg.SchemaMigration
+	read := service.check(ctx, pkg.HealthMigrations, func(ctx context.Context) error {
+		return service.DBConn.WithContext(ctx).Raw("SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&migration).Error
+	})
+	if read.Status != pkg.HealthUp {
+		check.Status, check.Error = read.Status, read.Error
+		return check
+	}
+
+	check.Version = migration.Version
+
+	switch {
+	case migration.Dirty:
+		check.Status, check.Error = pkg.HealthDown, fmt.Sprintf(pkg.MigrationsDirty, migration.Version)
+	case migration.Version < service.settings.MigrationVersion:
+		check.Status, check.Error = pkg.HealthDown, fmt.Sprintf(pkg.MigrationsBehind, service.settings.MigrationVersion)
+	}
+
+	return check
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+
+	"wallet-api/api"
+	"wallet-api/internal/pkg"
+)
+
+func TestKYCTierRules(t *testing.T) {
+	kycWalletService := NewWalletService(gormDB, rd, log, WalletServiceSettings{}, userService)
+	NewKYCService(gormDB, log, KYCServiceSettings{UnverifiedMaxBalance: 100000, BasicMaxBalance: 1000000}, kycWalletService)
+
+	walletQuery := regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")
+	tierQuery := regexp.QuoteMeta("SELECT `id`,`kyc_tier` FROM `users` WHERE id = ?")
+	lockedTierQuery := regexp.QuoteMeta("SELECT `id`,`kyc_tier` FROM `users` WHERE id = ?") + ".*" + regexp.QuoteMeta("FOR UPDATE")
+	balanceQuery := regexp.QuoteMeta("SELECT COALESCE(SUM(funds), 0) FROM `wallets` WHERE user_id = ?")
+
+	t.Run("Unverified users can't go over the maximum balance", func(t *testing.T) {
+		sqlMock.ExpectQuery(walletQuery).
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).AddRow(1, 1, "Wallet 1", 95000))
+		sqlMock.ExpectBegin()
+		expectLockedWallets([2]int{1, 95000})
+		sqlMock.ExpectQuery(lockedTierQuery).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "kyc_tier"}).AddRow(1, pkg.TierUnverified))
+		sqlMock.ExpectQuery(balanceQuery).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(95000))
+		sqlMock.ExpectRollback()
+
+		_, err := kycWalletService.Credit(context.Background(), &api.CreditRequest{UserId: 1, WalletId: 1, Amount: decimal.NewFromInt(100)})
+
+		if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
+			t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
+		}
+		require.ErrorIs(t, err, pkg.ErrBalanceCapReached)
+	})
+
+	t.Run("Unverified users can't transfer out", func(t *testing.T) {
+		sqlMock.ExpectQuery(walletQuery).
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).AddRow(1, 1, "Wallet 1", 10000))
+		sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE id = ?")).
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).AddRow(2, 2, "Main Wallet", 0))
+		sqlMock.ExpectQuery(tierQuery).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "kyc_tier"}).AddRow(1, pkg.TierUnverified))
+
+		_, err := kycWalletService.Transfer(context.Background(), &api.TransferRequest{UserId: 1, WalletId: 1, ToWalletId: 2, Amount: decimal.NewFromInt(10)})
+
+		if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
+			t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
+		}
+		require.ErrorIs(t, err, pkg.ErrTransferNotAllowed)
+	})
+
+	t.Run("Basic users can't transfer over the receiver's maximum balance", func(t *testing.T) {
+		sqlMock.ExpectQuery(walletQuery).
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).AddRow(1, 1, "Wallet 1", 10000))
+		sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE id = ?")).
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).AddRow(2, 2, "Main Wallet", 99500))
+		sqlMock.ExpectQuery(tierQuery).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "kyc_tier"}).AddRow(1, pkg.TierBasic))
+		sqlMock.ExpectBegin()
+		expectLockedWallets([2]int{1, 10000}, [2]int{2, 99500})
+		sqlMock.ExpectQuery(lockedTierQuery).
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "kyc_tier"}).AddRow(2, pkg.TierUnverified))
+		sqlMock.ExpectQuery(balanceQuery).
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(99500))
+		sqlMock.ExpectRollback()
+
+		_, err := kycWalletService.Transfer(context.Background(), &api.TransferRequest{UserId: 1, WalletId: 1, ToWalletId: 2, Amount: decimal.NewFromInt(10)})
+
+		if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
+			t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
+		}
+		require.ErrorIs(t, err, pkg.ErrBalanceCapReached)
+	})
+
+	t.Run("The maximum balance counts the user's other wallets", func(t *testing.T) {
+		sqlMock.ExpectQuery(walletQuery).
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).AddRow(1, 1, "Wallet 1", 10000))
+		sqlMock.ExpectBegin()
+		expectLockedWallets([2]int{1, 10000})
+		sqlMock.ExpectQuery(lockedTierQuery).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "kyc_tier"}).AddRow(1, pkg.TierUnverified))
+		sqlMock.ExpectQuery(balanceQuery).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(95000))
+		sqlMock.ExpectRollback()
+
+		_, err := kycWalletService.Credit(context.Background(), &api.CreditRequest{UserId: 1, WalletId: 1, Amount: decimal.NewFromInt(100)})
+
+		if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
+			t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
+		}
+		require.ErrorIs(t, err, pkg.ErrBalanceCapReached)
+	})
+}
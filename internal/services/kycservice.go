@@ -0,0 +1,286 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"wallet-api/api"
+	"wallet-api/internal/logging"
+	"wallet-api/internal/pkg"
+)
+
+type KYCService struct {
+	DBConn   *gorm.DB
+	logger   *zap.Logger
+	settings atomic.Pointer[KYCServiceSettings]
+}
+
+// KYCServiceSettings holds the maximum balance in 100s of the lower tiers, 0 disables the cap
+type KYCServiceSettings struct {
+	UnverifiedMaxBalance int
+	BasicMaxBalance      int
+}
+
+type KYCServices interface {
+	GetKYC(ctx context.Context, userID int) (*api.KYCResponse, error)
+	AddDocument(ctx context.Context, adminID, userID int, req *api.KYCDocumentRequest) (*api.KYCDocumentResponse, error)
+	Verify(ctx context.Context, adminID, userID int, req *api.KYCVerificationRequest) (*api.KYCResponse, error)
+}
+
+func NewKYCService(dbConn *gorm.DB, logger *zap.Logger, settings KYCServiceSettings, walletService *WalletService) *KYCService {
+	service := &KYCService{
+		DBConn: dbConn,
+		logger: logger,
+	}
+	service.settings.Store(&settings)
+
+	walletService.KYC = service
+
+	return service
+}
+
+// Settings returns the caps the service currently applies
+func (service *KYCService) Settings() KYCServiceSettings {
+	return *service.settings.Load()
+}
+
+// UpdateSettings applies the caps to the running service, the operations already checked keep the previous ones
+func (service *KYCService) UpdateSettings(settings KYCServiceSettings) {
+	service.settings.Store(&settings)
+}
+
+// GetKYC returns the user's KYC status along with the documents and verifications recorded
+func (service *KYCService) GetKYC(ctx context.Context, userID int) (*api.KYCResponse, error) {
+
+	var user pkg.User
+	if res := service.DBConn.WithContext(ctx).Select("id", "kyc_status", "kyc_tier").Where("id = ?", userID).First(&user); res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong getting the user kyc", zap.Error(res.Error), zap.Int("user_id", userID))
+		return nil, res.Error
+	}
+
+	var documents []pkg.KYCDocument
+	if res := service.DBConn.WithContext(ctx).Where("user_id = ?", userID).Order("id").Find(&documents); res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong getting the kyc documents", zap.Error(res.Error), zap.Int("user_id", userID))
+		return nil, res.Error
+	}
+
+	var verifications []pkg.KYCVerification
+	if res := service.DBConn.WithContext(ctx).Where("user_id = ?", userID).Order("id").Find(&verifications); res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong getting the kyc verifications", zap.Error(res.Error), zap.Int("user_id", userID))
+		return nil, res.Error
+	}
+
+	kyc := &api.KYCResponse{
+		UserID:        userID,
+		Status:        user.KYCStatus,
+		Tier:          user.KYCTier,
+		Documents:     make([]api.KYCDocumentResponse, 0, len(documents)),
+		Verifications: make([]api.KYCVerificationResponse, 0, len(verifications)),
+	}
+
+	for i := range documents {
+		kyc.Documents = append(kyc.Documents, *kycDocumentResponse(&documents[i]))
+	}
+
+	for _, verification := range verifications {
+		kyc.Verifications = append(kyc.Verifications, api.KYCVerificationResponse{
+			ID:        verification.ID,
+			Outcome:   verification.Outcome,
+			Tier:      verification.Tier,
+			Notes:     verification.Notes,
+			AdminID:   verification.AdminID,
+			CreatedAt: verification.CreatedAt,
+		})
+	}
+
+	return kyc, nil
+}
+
+// AddDocument records the metadata of a document the admin checked for the user
+func (service *KYCService) AddDocument(ctx context.Context, adminID, userID int, req *api.KYCDocumentRequest) (*api.KYCDocumentResponse, error) {
+
+	if _, err := service.userTier(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	document := &pkg.KYCDocument{
+		UserID:    userID,
+		AdminID:   adminID,
+		Type:      req.Type,
+		Reference: req.Reference,
+		Country:   req.Country,
+	}
+
+	if req.ExpiresAt != nil {
+		document.ExpiresAt = sql.NullTime{Time: *req.ExpiresAt, Valid: true}
+	}
+
+	if res := service.DBConn.WithContext(ctx).Create(document); res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong saving the kyc document", zap.Error(res.Error), zap.Any("document", document))
+		return nil, res.Error
+	}
+
+	return kycDocumentResponse(document), nil
+}
+
+// Verify records the outcome of the admin's review and moves the user to the tier verified, rejections drop them to unverified
+func (service *KYCService) Verify(ctx context.Context, adminID, userID int, req *api.KYCVerificationRequest) (*api.KYCResponse, error) {
+
+	tier := pkg.TierUnverified
+	if req.Outcome == pkg.KYCVerified {
+		tier = req.Tier
+	}
+
+	verification := &pkg.KYCVerification{
+		UserID:  userID,
+		AdminID: adminID,
+		Outcome: req.Outcome,
+		Tier:    tier,
+		Notes:   req.Notes,
+	}
+
+	err := service.DBConn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&pkg.User{}).
+			Where("id = ?", userID).
+			Updates(map[string]interface{}{"kyc_status": req.Outcome, "kyc_tier": tier})
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return tx.Create(verification).Error
+	})
+	if err != nil {
+		logging.From(ctx, service.logger).Error("something went wrong saving the kyc verification", zap.Error(err), zap.Any("verification", verification))
+		return nil, err
+	}
+
+	return service.GetKYC(ctx, userID)
+}
+
+// checkBalances refuses entries taking a user's balance, summed across all their wallets, over the maximum of their
+// tier. It runs on the db transaction holding the wallets' lock and locks the users credited as well, so credits to
+// their other wallets wait for these entries to be saved before summing the balance.
+func (service *KYCService) checkBalances(ctx context.Context, tx *gorm.DB, entries []walletEntry) error {
+
+	changes := make(map[int]int, len(entries))
+	for _, entry := range entries {
+		if entry.txn.Type == pkg.TransactionDebit {
+			changes[entry.wallet.UserID] -= entry.txn.Amount
+		} else {
+			changes[entry.wallet.UserID] += entry.txn.Amount
+		}
+	}
+
+	users := make([]int, 0, len(changes))
+	for userID, change := range changes {
+		if change > 0 {
+			users = append(users, userID)
+		}
+	}
+	slices.Sort(users)
+
+	for _, userID := range users {
+		var user pkg.User
+		res := tx.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "kyc_tier").Where("id = ?", userID).First(&user)
+		if res.Error != nil {
+			logging.From(ctx, service.logger).Error("something went wrong locking the user", zap.Error(res.Error), zap.Int("user_id", userID))
+			return res.Error
+		}
+
+		rule := service.rule(user.KYCTier)
+		if rule.MaxBalance == 0 {
+			continue
+		}
+
+		var balance int64
+		if res = tx.WithContext(ctx).Model(&pkg.Wallet{}).Select("COALESCE(SUM(funds), 0)").Where("user_id = ?", userID).Scan(&balance); res.Error != nil {
+			logging.From(ctx, service.logger).Error("something went wrong getting the user balance", zap.Error(res.Error), zap.Int("user_id", userID))
+			return res.Error
+		}
+
+		if int(balance)+changes[userID] > rule.MaxBalance {
+			err := pkg.ErrBalanceCapReached
+			logging.From(ctx, service.logger).Error("attempted to credit over the tier's maximum balance", zap.Error(err), zap.Int("user_id", userID),
+				zap.Int64("balance", balance), zap.Int("credited", changes[userID]))
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkTransferOut refuses transfers out of wallets whose user's tier doesn't allow them
+func (service *KYCService) checkTransferOut(ctx context.Context, wallet *pkg.Wallet) error {
+
+	rule, err := service.tierRule(ctx, wallet.UserID)
+	if err != nil {
+		return err
+	}
+
+	if !rule.CanTransferOut {
+		err = pkg.ErrTransferNotAllowed
+		logging.From(ctx, service.logger).Error("attempted to transfer out with tier not allowing it", zap.Error(err), zap.Int("wallet_id", wallet.ID))
+		return err
+	}
+
+	return nil
+}
+
+func (service *KYCService) tierRule(ctx context.Context, userID int) (pkg.TierRule, error) {
+
+	tier, err := service.userTier(ctx, userID)
+	if err != nil {
+		return pkg.TierRule{}, err
+	}
+
+	return service.rule(tier), nil
+}
+
+func (service *KYCService) rule(tier string) pkg.TierRule {
+	switch tier {
+	case pkg.TierFull:
+		return pkg.TierRule{CanTransferOut: true}
+	case pkg.TierBasic:
+		return pkg.TierRule{MaxBalance: service.Settings().BasicMaxBalance, CanTransferOut: true}
+	default:
+		return pkg.TierRule{MaxBalance: service.Settings().UnverifiedMaxBalance}
+	}
+}
+
+func (service *KYCService) userTier(ctx context.Context, userID int) (string, error) {
+
+	var user pkg.User
+	if res := service.DBConn.WithContext(ctx).Select("id", "kyc_tier").Where("id = ?", userID).First(&user); res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong getting the user tier", zap.Error(res.Error), zap.Int("user_id", userID))
+		return "", res.Error
+	}
+
+	return user.KYCTier, nil
+}
+
+func kycDocumentResponse(document *pkg.KYCDocument) *api.KYCDocumentResponse {
+	res := &api.KYCDocumentResponse{
+		ID:        document.ID,
+		Type:      document.Type,
+		Reference: document.Reference,
+		Country:   document.Country,
+		AdminID:   document.AdminID,
+		CreatedAt: document.CreatedAt,
+	}
+
+	if document.ExpiresAt.Valid {
+		res.ExpiresAt = &document.ExpiresAt.Time
+	}
+
+	return res
+}
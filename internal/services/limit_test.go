@@ -0,0 +1,308 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-redis/redismock/v9"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"wallet-api/api"
+	"wallet-api/internal/pkg"
+	"wallet-api/internal/utils"
+)
+
+type limitTestCase struct {
+	Name          string
+	Input         *api.CreditRequest
+	ExpectedLimit string
+	SqlMock       func(test limitTestCase)
+	RedisMock     func(test limitTestCase)
+}
+
+func TestCreditLimits(t *testing.T) {
+	limitedWalletService := NewWalletService(gormDB, rd, log, WalletServiceSettings{RedisCacheTimeout: time.Hour}, userService)
+	NewLimitService(gormDB, log, LimitServiceSettings{PerTransaction: 50000}, limitedWalletService)
+
+	walletQuery := regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")
+	limitsQuery := regexp.QuoteMeta("SELECT * FROM `limits` WHERE operation = ?")
+	usageQuery := regexp.QuoteMeta("FROM `transactions` WHERE wallet_id = ? AND type = ? AND status = ? AND id <> ? AND created_at >= ?")
+
+	limitColumns := []string{"id", "scope", "tier", "wallet_id", "operation", "per_transaction", "daily", "weekly", "monthly", "per_minute"}
+	usageColumns := []string{"daily", "weekly", "monthly", "last_minute"}
+
+	// the limits are read once the wallet is locked
+	expectWallet := func(test limitTestCase) {
+		sqlMock.ExpectQuery(walletQuery).
+			WithArgs(test.Input.WalletId, test.Input.UserId).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).
+				AddRow(test.Input.WalletId, test.Input.UserId, "Wallet 1", 10000))
+		sqlMock.ExpectBegin()
+		expectLockedWallets([2]int{1, 10000})
+	}
+
+	testCases := []limitTestCase{
+		{
+			Name: "Settings apply when no limits are saved",
+			Input: &api.CreditRequest{
+				UserId:   1,
+				WalletId: 1,
+				Amount:   decimal.NewFromInt(600),
+			},
+			ExpectedLimit: pkg.LimitPerTransaction,
+			SqlMock: func(test limitTestCase) {
+				expectWallet(test)
+				sqlMock.ExpectQuery(limitsQuery).
+					WithArgs(pkg.TransactionCredit, pkg.LimitScopeWallet, test.Input.WalletId, pkg.LimitScopeTier, test.Input.UserId, pkg.LimitScopeGlobal).
+					WillReturnRows(sqlmock.NewRows(limitColumns))
+				sqlMock.ExpectRollback()
+			},
+		},
+		{
+			Name: "Wallet limit wins over the global one",
+			Input: &api.CreditRequest{
+				UserId:   1,
+				WalletId: 1,
+				Amount:   decimal.NewFromInt(20),
+			},
+			ExpectedLimit: pkg.LimitDaily,
+			SqlMock: func(test limitTestCase) {
+				expectWallet(test)
+				sqlMock.ExpectQuery(limitsQuery).
+					WillReturnRows(sqlmock.NewRows(limitColumns).
+						AddRow(1, pkg.LimitScopeGlobal, "", 0, pkg.TransactionCredit, 0, 100000, 0, 0, 0).
+						AddRow(2, pkg.LimitScopeWallet, "", 1, pkg.TransactionCredit, 0, 5000, 0, 0, 0))
+				sqlMock.ExpectQuery(usageQuery).
+					WillReturnRows(sqlmock.NewRows(usageColumns).AddRow(4000, 4000, 4000, 1))
+				sqlMock.ExpectRollback()
+			},
+		},
+		{
+			Name: "Wallet override keeps the global daily cap",
+			Input: &api.CreditRequest{
+				UserId:   1,
+				WalletId: 1,
+				Amount:   decimal.NewFromInt(600),
+			},
+			ExpectedLimit: pkg.LimitDaily,
+			SqlMock: func(test limitTestCase) {
+				expectWallet(test)
+				sqlMock.ExpectQuery(limitsQuery).
+					WillReturnRows(sqlmock.NewRows(limitColumns).
+						AddRow(1, pkg.LimitScopeGlobal, "", 0, pkg.TransactionCredit, 0, 10000, 0, 0, 0).
+						AddRow(2, pkg.LimitScopeWallet, "", 1, pkg.TransactionCredit, 100000, 0, 0, 0, 0))
+				sqlMock.ExpectQuery(usageQuery).
+					WillReturnRows(sqlmock.NewRows(usageColumns).AddRow(0, 0, 0, 0))
+				sqlMock.ExpectRollback()
+			},
+		},
+		{
+			Name: "Too many credits in the last minute",
+			Input: &api.CreditRequest{
+				UserId:   1,
+				WalletId: 1,
+				Amount:   decimal.NewFromInt(1),
+			},
+			ExpectedLimit: pkg.LimitVelocity,
+			SqlMock: func(test limitTestCase) {
+				expectWallet(test)
+				sqlMock.ExpectQuery(limitsQuery).
+					WillReturnRows(sqlmock.NewRows(limitColumns).
+						AddRow(1, pkg.LimitScopeTier, pkg.TierUnverified, 0, pkg.TransactionCredit, 0, 0, 0, 0, 3))
+				sqlMock.ExpectQuery(usageQuery).
+					WillReturnRows(sqlmock.NewRows(usageColumns).AddRow(300, 300, 300, 3))
+				sqlMock.ExpectRollback()
+			},
+		},
+		{
+			Name: "Credit within the limits goes through",
+			Input: &api.CreditRequest{
+				UserId:   1,
+				WalletId: 1,
+				Amount:   decimal.NewFromInt(10),
+			},
+			SqlMock: func(test limitTestCase) {
+				expectWallet(test)
+				sqlMock.ExpectQuery(limitsQuery).
+					WillReturnRows(sqlmock.NewRows(limitColumns).
+						AddRow(1, pkg.LimitScopeGlobal, "", 0, pkg.TransactionCredit, 5000, 10000, 20000, 30000, 5))
+				sqlMock.ExpectQuery(usageQuery).
+					WillReturnRows(sqlmock.NewRows(usageColumns).AddRow(1000, 2000, 3000, 1))
+				sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE `wallets` SET `funds`=? WHERE `id` = ?")).
+					WithArgs(11000, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO `transactions`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO `outbox_events`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				sqlMock.ExpectCommit()
+
+				redisClientMock.Regexp().ExpectSet(utils.GenerateRedisKey(test.Input.WalletId), `^[0-9]`, 60*time.Minute).SetVal("ok")
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+
+			test.SqlMock(test)
+
+			_, err := limitedWalletService.Credit(context.Background(), test.Input)
+
+			if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
+				t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
+			}
+			if redisMockErr := redisClientMock.ExpectationsWereMet(); redisMockErr != nil {
+				t.Errorf("there were unfulfilled expectations: %s", redisMockErr)
+			}
+
+			if test.ExpectedLimit == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			var limitErr *pkg.LimitError
+			require.True(t, errors.As(err, &limitErr))
+			require.Equal(t, test.ExpectedLimit, limitErr.Limit)
+		})
+	}
+}
+
+// lockingPool stands in for the db's row locks, a transaction selecting FOR UPDATE holds rowLock until it ends. Reading
+// the limit usage without holding it is refused, as the sums could change before the transaction is saved.
+type lockingPool struct {
+	*sql.DB
+	rowLock *sync.Mutex
+}
+
+func (pool *lockingPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if strings.Contains(query, "FROM `transactions`") {
+		return nil, errors.New("limit usage read outside of the wallet lock")
+	}
+	return pool.DB.QueryContext(ctx, query, args...)
+}
+
+func (pool *lockingPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	tx, err := pool.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &lockingTx{Tx: tx, rowLock: pool.rowLock}, nil
+}
+
+type lockingTx struct {
+	*sql.Tx
+	rowLock *sync.Mutex
+	locked  bool
+}
+
+func (tx *lockingTx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	switch {
+	case strings.Contains(query, "FOR UPDATE") && !tx.locked:
+		tx.rowLock.Lock()
+		tx.locked = true
+	case strings.Contains(query, "FROM `transactions`") && !tx.locked:
+		return nil, errors.New("limit usage read outside of the wallet lock")
+	}
+	return tx.Tx.QueryContext(ctx, query, args...)
+}
+
+func (tx *lockingTx) Commit() error {
+	defer tx.unlock()
+	return tx.Tx.Commit()
+}
+
+func (tx *lockingTx) Rollback() error {
+	defer tx.unlock()
+	return tx.Tx.Rollback()
+}
+
+func (tx *lockingTx) unlock() {
+	if tx.locked {
+		tx.locked = false
+		tx.rowLock.Unlock()
+	}
+}
+
+func TestConcurrentCreditLimits(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	require.NoError(t, err)
+	defer db.Close()
+
+	// the credits run side by side, the lock decides which one reads the usage first
+	mock.MatchExpectationsInOrder(false)
+
+	lockedDB, err := gorm.Open(mysql.New(mysql.Config{
+		DriverName:                "mysql",
+		Conn:                      &lockingPool{DB: db, rowLock: &sync.Mutex{}},
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{})
+	require.NoError(t, err)
+
+	cache, cacheMock := redismock.NewClientMock()
+
+	limitedWalletService := NewWalletService(lockedDB, cache, log, WalletServiceSettings{RedisCacheTimeout: time.Hour}, userService)
+	NewLimitService(lockedDB, log, LimitServiceSettings{Daily: 10000}, limitedWalletService)
+
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets`")).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).AddRow(1, 1, "Wallet 1", 10000))
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `limits`")).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	}
+
+	// the first credit to get the lock sees nothing used, the second sees the first one
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`funds` FROM `wallets`")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "funds"}).AddRow(1, 10000))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`funds` FROM `wallets`")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "funds"}).AddRow(1, 16000))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `transactions`")).
+		WillReturnRows(sqlmock.NewRows([]string{"daily", "weekly", "monthly", "last_minute"}).AddRow(0, 0, 0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `transactions`")).
+		WillReturnRows(sqlmock.NewRows([]string{"daily", "weekly", "monthly", "last_minute"}).AddRow(6000, 6000, 6000, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `wallets` SET `funds`=?")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `transactions`")).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `outbox_events`")).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+
+	cacheMock.Regexp().ExpectSet(utils.GenerateRedisKey(1), `^[0-9]`, time.Hour).SetVal("ok")
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = limitedWalletService.Credit(context.Background(), &api.CreditRequest{UserId: 1, WalletId: 1, Amount: decimal.NewFromInt(60)})
+		}(i)
+	}
+	wg.Wait()
+
+	require.NoError(t, mock.ExpectationsWereMet())
+	require.NoError(t, cacheMock.ExpectationsWereMet())
+
+	var limitErr *pkg.LimitError
+	if errs[0] == nil {
+		require.True(t, errors.As(errs[1], &limitErr), errs[1])
+	} else {
+		require.NoError(t, errs[1])
+		require.True(t, errors.As(errs[0], &limitErr), errs[0])
+	}
+	require.Equal(t, pkg.LimitDaily, limitErr.Limit)
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"wallet-api/api"
+	"wallet-api/internal/logging"
+	"wallet-api/internal/pkg"
+)
+
+type LimitService struct {
+	DBConn   *gorm.DB
+	logger   *zap.Logger
+	settings atomic.Pointer[LimitServiceSettings]
+}
+
+// LimitServiceSettings holds the limits applied when none are saved for the wallet, its tier or globally
+type LimitServiceSettings struct {
+	PerTransaction int
+	Daily          int
+	Weekly         int
+	Monthly        int
+	PerMinute      int
+}
+
+type LimitServices interface {
+	GetLimits(ctx context.Context) ([]api.LimitResponse, error)
+	SetLimit(ctx context.Context, req *api.LimitRequest) (*api.LimitResponse, error)
+	DeleteLimit(ctx context.Context, limitID int) error
+}
+
+// limitUsage is what the wallet already used in the limit windows
+type limitUsage struct {
+	Daily      int64
+	Weekly     int64
+	Monthly    int64
+	LastMinute int64
+}
+
+func NewLimitService(dbConn *gorm.DB, logger *zap.Logger, settings LimitServiceSettings, walletService *WalletService) *LimitService {
+	service := &LimitService{
+		DBConn: dbConn,
+		logger: logger,
+	}
+	service.settings.Store(&settings)
+
+	walletService.Limits = service
+
+	return service
+}
+
+// Settings returns the limits the service currently falls back to
+func (service *LimitService) Settings() LimitServiceSettings {
+	return *service.settings.Load()
+}
+
+// UpdateSettings applies the limits to the running service, the operations already checked keep the previous ones
+func (service *LimitService) UpdateSettings(settings LimitServiceSettings) {
+	service.settings.Store(&settings)
+}
+
+// GetLimits returns all the limits saved in the db
+func (service *LimitService) GetLimits(ctx context.Context) ([]api.LimitResponse, error) {
+
+	var limits []pkg.Limit
+	if res := service.DBConn.WithContext(ctx).Order("id").Find(&limits); res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong getting the limits", zap.Error(res.Error))
+		return nil, res.Error
+	}
+
+	responses := make([]api.LimitResponse, 0, len(limits))
+	for i := range limits {
+		responses = append(responses, *limitResponse(&limits[i]))
+	}
+
+	return responses, nil
+}
+
+// SetLimit creates or replaces the limit of the operation for the scope
+func (service *LimitService) SetLimit(ctx context.Context, req *api.LimitRequest) (*api.LimitResponse, error) {
+
+	if !validLimit(req.PerTransaction) || !validLimit(req.Daily) || !validLimit(req.Weekly) || !validLimit(req.Monthly) {
+		return nil, pkg.ErrWrongAmount
+	}
+
+	limit := pkg.Limit{
+		Scope:     req.Scope,
+		Operation: req.Operation,
+	}
+
+	switch req.Scope {
+	case pkg.LimitScopeTier:
+		limit.Tier = req.Tier
+	case pkg.LimitScopeWallet:
+		limit.WalletID = req.WalletID
+	}
+
+	res := service.DBConn.WithContext(ctx).
+		Where(map[string]interface{}{"scope": limit.Scope, "tier": limit.Tier, "wallet_id": limit.WalletID, "operation": limit.Operation}).
+		FirstOrInit(&limit)
+	if res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong getting the limit", zap.Error(res.Error), zap.Any("limitReq", req))
+		return nil, res.Error
+	}
+
+	limit.PerTransaction = toCents(req.PerTransaction)
+	limit.Daily = toCents(req.Daily)
+	limit.Weekly = toCents(req.Weekly)
+	limit.Monthly = toCents(req.Monthly)
+	limit.PerMinute = req.PerMinute
+
+	if res = service.DBConn.WithContext(ctx).Save(&limit); res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong saving the limit", zap.Error(res.Error), zap.Any("limit", limit))
+		return nil, res.Error
+	}
+
+	return limitResponse(&limit), nil
+}
+
+// DeleteLimit removes the limit, the next more general one applies from then on
+func (service *LimitService) DeleteLimit(ctx context.Context, limitID int) error {
+
+	res := service.DBConn.WithContext(ctx).Delete(&pkg.Limit{}, limitID)
+	if res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong deleting the limit", zap.Error(res.Error), zap.Int("limit_id", limitID))
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// checkLimits returns a *pkg.LimitError if the transaction would break the wallet's limits. Saving runs it on the db
+// transaction holding the wallet's lock, so the usage read can't go stale before the transaction is saved.
+func (service *LimitService) checkLimits(ctx context.Context, db *gorm.DB, wallet *pkg.Wallet, txn *pkg.Transaction) error {
+
+	limit, err := service.walletLimit(ctx, db, wallet, txn.Type)
+	if err != nil {
+		return err
+	}
+
+	if limit.PerTransaction > 0 && txn.Amount > limit.PerTransaction {
+		return service.limitError(ctx, txn, pkg.LimitPerTransaction, limit.PerTransaction)
+	}
+
+	if limit.Daily == 0 && limit.Weekly == 0 && limit.Monthly == 0 && limit.PerMinute == 0 {
+		return nil
+	}
+
+	now := service.DBConn.NowFunc()
+
+	var usage limitUsage
+	res := db.WithContext(ctx).
+		Model(&pkg.Transaction{}).
+		Select("COALESCE(SUM(CASE WHEN created_at >= ? THEN amount ELSE 0 END), 0) AS daily, "+
+			"COALESCE(SUM(CASE WHEN created_at >= ? THEN amount ELSE 0 END), 0) AS weekly, "+
+			"COALESCE(SUM(amount), 0) AS monthly, "+
+			"COUNT(CASE WHEN created_at >= ? THEN 1 END) AS last_minute",
+			now.Add(-24*time.Hour), now.AddDate(0, 0, -7), now.Add(-time.Minute)).
+		Where("wallet_id = ? AND type = ? AND status = ? AND id <> ? AND created_at >= ?",
+			wallet.ID, txn.Type, pkg.TransactionCompleted, txn.ID, now.AddDate(0, 0, -30)).
+		Scan(&usage)
+	if res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong getting the limit usage", zap.Error(res.Error), zap.Int("wallet_id", wallet.ID))
+		return res.Error
+	}
+
+	switch {
+	case limit.PerMinute > 0 && int(usage.LastMinute) >= limit.PerMinute:
+		return service.limitError(ctx, txn, pkg.LimitVelocity, limit.PerMinute)
+	case limit.Daily > 0 && int(usage.Daily)+txn.Amount > limit.Daily:
+		return service.limitError(ctx, txn, pkg.LimitDaily, limit.Daily)
+	case limit.Weekly > 0 && int(usage.Weekly)+txn.Amount > limit.Weekly:
+		return service.limitError(ctx, txn, pkg.LimitWeekly, limit.Weekly)
+	case limit.Monthly > 0 && int(usage.Monthly)+txn.Amount > limit.Monthly:
+		return service.limitError(ctx, txn, pkg.LimitMonthly, limit.Monthly)
+	}
+
+	return nil
+}
+
+// walletLimit merges the limits saved for the wallet, each check taking the value of the most specific scope setting it
+// and falling back to the settings
+func (service *LimitService) walletLimit(ctx context.Context, db *gorm.DB, wallet *pkg.Wallet, operation string) (*pkg.Limit, error) {
+
+	var limits []pkg.Limit
+	res := db.WithContext(ctx).
+		Where("operation = ? AND ((scope = ? AND wallet_id = ?) OR (scope = ? AND tier = (SELECT kyc_tier FROM users WHERE id = ?)) OR scope = ?)",
+			operation, pkg.LimitScopeWallet, wallet.ID, pkg.LimitScopeTier, wallet.UserID, pkg.LimitScopeGlobal).
+		Find(&limits)
+	if res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong getting the wallet limits", zap.Error(res.Error), zap.Int("wallet_id", wallet.ID))
+		return nil, res.Error
+	}
+
+	limit := &pkg.Limit{Scope: pkg.LimitScopeGlobal, Operation: operation}
+	for _, scope := range []string{pkg.LimitScopeWallet, pkg.LimitScopeTier, pkg.LimitScopeGlobal} {
+		for i := range limits {
+			if limits[i].Scope == scope {
+				inheritLimit(limit, &limits[i])
+			}
+		}
+	}
+
+	settings := service.Settings()
+	inheritLimit(limit, &pkg.Limit{
+		PerTransaction: settings.PerTransaction,
+		Daily:          settings.Daily,
+		Weekly:         settings.Weekly,
+		Monthly:        settings.Monthly,
+		PerMinute:      settings.PerMinute,
+	})
+
+	return limit, nil
+}
+
+// inheritLimit fills the checks the limit leaves at 0 from a more general one
+func inheritLimit(limit, general *pkg.Limit) {
+	if limit.PerTransaction == 0 {
+		limit.PerTransaction = general.PerTransaction
+	}
+	if limit.Daily == 0 {
+		limit.Daily = general.Daily
+	}
+	if limit.Weekly == 0 {
+		limit.Weekly = general.Weekly
+	}
+	if limit.Monthly == 0 {
+		limit.Monthly = general.Monthly
+	}
+	if limit.PerMinute == 0 {
+		limit.PerMinute = general.PerMinute
+	}
+}
+
+func (service *LimitService) limitError(ctx context.Context, txn *pkg.Transaction, limit string, max int) error {
+	err := &pkg.LimitError{Operation: txn.Type, Limit: limit, Max: max}
+	logging.From(ctx, service.logger).Error("attempted to break wallet limit", zap.Error(err), zap.Any("transaction", txn))
+	return err
+}
+
+func limitResponse(limit *pkg.Limit) *api.LimitResponse {
+	return &api.LimitResponse{
+		ID:             limit.ID,
+		Scope:          limit.Scope,
+		Tier:           limit.Tier,
+		WalletID:       limit.WalletID,
+		Operation:      limit.Operation,
+		PerTransaction: fromCents(limit.PerTransaction),
+		Daily:          fromCents(limit.Daily),
+		Weekly:         fromCents(limit.Weekly),
+		Monthly:        fromCents(limit.Monthly),
+		PerMinute:      limit.PerMinute,
+	}
+}
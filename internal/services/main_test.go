@@ -38,7 +38,7 @@ var (
 )
 
 func TestMain(m *testing.M) {
-	log, err = utils.SetUpLogger()
+	log, err = utils.SetUpLogger(zap.NewAtomicLevel())
 	if err != nil {
 		panic(err)
 	}
@@ -69,15 +69,17 @@ func TestMain(m *testing.M) {
 
 	rd, redisClientMock = redismock.NewClientMock()
 
+	cfg := config.Defaults()
+
 	userService = NewUserService(gormDB, rd, log, UserServiceSettings{
 		Port:      0,
-		Hostname:  config.WalletConfigs.Host,
-		JWTSecret: config.WalletConfigs.JWTSecret,
+		Hostname:  cfg.Host,
+		JWTSecret: cfg.JWTSecret,
 	})
 	walletService = NewWalletService(gormDB, rd, log, WalletServiceSettings{
 		Port:              0,
-		Hostname:          config.WalletConfigs.Host,
-		RedisCacheTimeout: config.WalletConfigs.RedisExpiry,
+		Hostname:          cfg.Host,
+		RedisCacheTimeout: cfg.RedisExpiry,
 	}, userService)
 
 	m.Run()
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+
+	"wallet-api/internal/events"
+	"wallet-api/internal/pkg"
+)
+
+type failingPublisher struct{}
+
+func (failingPublisher) Publish(context.Context, *pkg.OutboxEvent) error {
+	return errors.New("stream unavailable")
+}
+
+// committedPublisher fails the events published while the claim isn't committed yet, expecting the events to be
+// marked once they're all published
+type committedPublisher struct {
+	published int
+	events    int
+}
+
+func (p *committedPublisher) Publish(context.Context, *pkg.OutboxEvent) error {
+	if err := sqlMock.ExpectationsWereMet(); p.published == 0 && err != nil {
+		return err
+	}
+
+	p.published++
+	if p.published == p.events {
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE `outbox_events` SET `published_at`=? WHERE id IN (?,?)")).
+			WithArgs(sqlmock.AnyArg(), 1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		sqlMock.ExpectCommit()
+	}
+
+	return nil
+}
+
+func TestRelayPending(t *testing.T) {
+	outboxQuery := regexp.QuoteMeta("SELECT * FROM `outbox_events` WHERE published_at IS NULL AND (claimed_at IS NULL OR claimed_at < ?) ORDER BY id LIMIT 10 FOR UPDATE SKIP LOCKED")
+	claimQuery := regexp.QuoteMeta("UPDATE `outbox_events` SET `claimed_at`=? WHERE id IN (?,?)")
+	oldestQuery := regexp.QuoteMeta("SELECT MIN(id) FROM `outbox_events` WHERE published_at IS NULL")
+	outboxRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "type", "wallet_id", "user_id", "payload", "created_at", "published_at"}).
+			AddRow(1, pkg.EventWalletCredited, 1, 1, `{"type":"wallet.credited"}`, nil, nil).
+			AddRow(2, pkg.EventWalletDebited, 1, 1, `{"type":"wallet.debited"}`, nil, nil)
+	}
+
+	t.Run("Events are published in order and marked", func(t *testing.T) {
+		publisher := events.NewMemoryPublisher()
+		relay := NewOutboxRelay(gormDB, log, OutboxRelaySettings{BatchSize: 10}, publisher)
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(outboxQuery).WillReturnRows(outboxRows())
+		sqlMock.ExpectQuery(oldestQuery).WillReturnRows(sqlmock.NewRows([]string{"min"}).AddRow(1))
+		sqlMock.ExpectExec(claimQuery).
+			WithArgs(sqlmock.AnyArg(), 1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		sqlMock.ExpectCommit()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE `outbox_events` SET `published_at`=? WHERE id IN (?,?)")).
+			WithArgs(sqlmock.AnyArg(), 1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		sqlMock.ExpectCommit()
+
+		sent, err := relay.RelayPending(context.Background())
+
+		if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
+			t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
+		}
+
+		require.NoError(t, err)
+		require.Equal(t, 2, sent)
+
+		published := publisher.Events()
+		require.Len(t, published, 2)
+		require.Equal(t, pkg.EventWalletCredited, published[0].Type)
+		require.Equal(t, pkg.EventWalletDebited, published[1].Type)
+	})
+
+	t.Run("Failed publish leaves the events pending", func(t *testing.T) {
+		relay := NewOutboxRelay(gormDB, log, OutboxRelaySettings{BatchSize: 10}, failingPublisher{})
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(outboxQuery).WillReturnRows(outboxRows())
+		sqlMock.ExpectQuery(oldestQuery).WillReturnRows(sqlmock.NewRows([]string{"min"}).AddRow(1))
+		sqlMock.ExpectExec(claimQuery).
+			WithArgs(sqlmock.AnyArg(), 1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		sqlMock.ExpectCommit()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectExec(claimQuery).
+			WithArgs(nil, 1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		sqlMock.ExpectCommit()
+
+		sent, err := relay.RelayPending(context.Background())
+
+		if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
+			t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
+		}
+
+		require.Error(t, err)
+		require.Equal(t, 0, sent)
+	})
+
+	t.Run("Claims are committed before publishing", func(t *testing.T) {
+		relay := NewOutboxRelay(gormDB, log, OutboxRelaySettings{BatchSize: 10}, &committedPublisher{events: 2})
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(outboxQuery).WillReturnRows(outboxRows())
+		sqlMock.ExpectQuery(oldestQuery).WillReturnRows(sqlmock.NewRows([]string{"min"}).AddRow(1))
+		sqlMock.ExpectExec(claimQuery).
+			WithArgs(sqlmock.AnyArg(), 1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		sqlMock.ExpectCommit()
+
+		sent, err := relay.RelayPending(context.Background())
+
+		if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
+			t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
+		}
+
+		require.NoError(t, err)
+		require.Equal(t, 2, sent)
+	})
+
+	t.Run("Events after the ones another relay claimed wait", func(t *testing.T) {
+		publisher := events.NewMemoryPublisher()
+		relay := NewOutboxRelay(gormDB, log, OutboxRelaySettings{BatchSize: 10}, publisher)
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(outboxQuery).WillReturnRows(sqlmock.NewRows([]string{"id", "type", "wallet_id", "user_id", "payload"}).
+			AddRow(3, pkg.EventWalletCredited, 1, 1, `{"type":"wallet.credited"}`))
+		sqlMock.ExpectQuery(oldestQuery).WillReturnRows(sqlmock.NewRows([]string{"min"}).AddRow(1))
+		sqlMock.ExpectCommit()
+
+		sent, err := relay.RelayPending(context.Background())
+
+		if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
+			t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
+		}
+
+		require.NoError(t, err)
+		require.Equal(t, 0, sent)
+		require.Empty(t, publisher.Events())
+	})
+}
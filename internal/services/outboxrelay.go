@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"wallet-api/internal/events"
+	"wallet-api/internal/logging"
+	"wallet-api/internal/pkg"
+)
+
+type OutboxRelay struct {
+	DBConn    *gorm.DB
+	logger    *zap.Logger
+	settings  OutboxRelaySettings
+	Publisher events.EventPublisher
+}
+
+// OutboxRelaySettings holds how often the outbox is polled, how many events are sent each time and for how long
+type OutboxRelaySettings struct {
+	Interval  time.Duration
+	BatchSize int
+	// how long the events claimed are held before another relay can take them
+	Lease time.Duration
+}
+
+func NewOutboxRelay(dbConn *gorm.DB, logger *zap.Logger, settings OutboxRelaySettings, publisher events.EventPublisher) *OutboxRelay {
+	if settings.Interval <= 0 {
+		settings.Interval = time.Second
+	}
+	if settings.BatchSize <= 0 {
+		settings.BatchSize = 100
+	}
+	if settings.Lease <= 0 {
+		settings.Lease = time.Minute
+	}
+
+	return &OutboxRelay{
+		DBConn:    dbConn,
+		logger:    logger,
+		settings:  settings,
+		Publisher: publisher,
+	}
+}
+
+// Run relays the outbox until the context is cancelled, meant to be started in its own goroutine. A batch started is
+// finished before returning so no event is published without being marked.
+func (relay *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(relay.settings.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// a full batch means there may be more waiting
+			for ctx.Err() == nil {
+				sent, err := relay.RelayPending(context.WithoutCancel(ctx))
+				if err != nil || sent < relay.settings.BatchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+// RelayPending publishes the oldest unpublished events in order, stopping at the first failure so order is kept. The
+// events are claimed and the claim committed before they're published, so the relays of other instances skip them
+// instead of publishing them again and no db transaction is held open while the publishers are waited on.
+func (relay *OutboxRelay) RelayPending(ctx context.Context) (int, error) {
+
+	pending, err := relay.claim(ctx)
+	if err != nil {
+		logging.From(ctx, relay.logger).Error("something went wrong claiming the outbox events", zap.Error(err))
+		return 0, err
+	}
+
+	if len(pending) == 0 {
+		return 0, nil
+	}
+
+	var publishErr error
+	ids := make([]int, 0, len(pending))
+	for i := range pending {
+		if publishErr = relay.Publisher.Publish(ctx, &pending[i]); publishErr != nil {
+			logging.From(ctx, relay.logger).Error("something went wrong publishing the event", zap.Error(publishErr), zap.Int("event_id", pending[i].ID))
+			break
+		}
+		ids = append(ids, pending[i].ID)
+	}
+
+	// the events left are released for the next run instead of waiting for the lease
+	unsent := make([]int, 0, len(pending)-len(ids))
+	for i := len(ids); i < len(pending); i++ {
+		unsent = append(unsent, pending[i].ID)
+	}
+
+	// if this fails the events are published again once the lease is over, consumers dedupe on the id
+	err = relay.DBConn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(ids) > 0 {
+			res := tx.Model(&pkg.OutboxEvent{}).Where("id IN ?", ids).Update("published_at", relay.DBConn.NowFunc())
+			if res.Error != nil {
+				return res.Error
+			}
+		}
+
+		if len(unsent) > 0 {
+			res := tx.Model(&pkg.OutboxEvent{}).Where("id IN ?", unsent).Update("claimed_at", nil)
+			if res.Error != nil {
+				return res.Error
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		logging.From(ctx, relay.logger).Error("something went wrong marking the outbox events", zap.Error(err))
+		return 0, err
+	}
+
+	return len(ids), publishErr
+}
+
+// claim marks the oldest unpublished events nobody holds as taken by this relay. It returns none while another relay
+// holds older ones, the events after them wait for it to keep the order.
+func (relay *OutboxRelay) claim(ctx context.Context) ([]pkg.OutboxEvent, error) {
+
+	var pending []pkg.OutboxEvent
+	now := relay.DBConn.NowFunc()
+	err := relay.DBConn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("published_at IS NULL AND (claimed_at IS NULL OR claimed_at < ?)", now.Add(-relay.settings.Lease)).
+			Order("id").
+			Limit(relay.settings.BatchSize).
+			Find(&pending)
+		if res.Error != nil || len(pending) == 0 {
+			return res.Error
+		}
+
+		var oldest int
+		if res = tx.Model(&pkg.OutboxEvent{}).Select("MIN(id)").Where("published_at IS NULL").Scan(&oldest); res.Error != nil {
+			return res.Error
+		}
+		if oldest < pending[0].ID {
+			pending = nil
+			return nil
+		}
+
+		ids := make([]int, 0, len(pending))
+		for i := range pending {
+			ids = append(ids, pending[i].ID)
+		}
+
+		return tx.Model(&pkg.OutboxEvent{}).Where("id IN ?", ids).Update("claimed_at", now).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pending, nil
+}
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"wallet-api/internal/events"
+	"wallet-api/internal/pkg"
+	"wallet-api/internal/utils"
+)
+
+func TestPubSubPublisher(t *testing.T) {
+	publisher := events.NewRedisPubSubPublisher(rd)
+
+	event := &pkg.OutboxEvent{ID: 3, Type: pkg.EventWalletDebited, WalletID: 2, Payload: `{"type":"wallet.debited","wallet_ID":2}`}
+
+	redisClientMock.ExpectPublish(utils.GenerateEventsChannel(2), event.Payload).SetVal(1)
+
+	err := publisher.Publish(context.Background(), event)
+
+	if redisMockErr := redisClientMock.ExpectationsWereMet(); redisMockErr != nil {
+		t.Errorf("there were unfulfilled expectations: %s", redisMockErr)
+	}
+
+	require.NoError(t, err)
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+
+	"wallet-api/api"
+	"wallet-api/internal/pkg"
+)
+
+type refreshTestCase struct {
+	Name          string
+	Secret        string
+	Claims        jwt.MapClaims
+	ExpectedError error
+}
+
+func TestRefreshToken(t *testing.T) {
+	refreshUserService := NewUserService(gormDB, rd, log, UserServiceSettings{
+		JWTSecret:     "access-secret",
+		RefreshSecret: "refresh-secret",
+	})
+
+	testCases := []refreshTestCase{
+		{
+			Name:   "Valid refresh token gets a new pair",
+			Secret: "refresh-secret",
+			Claims: jwt.MapClaims{"sub": 1, "typ": "refresh", "exp": time.Now().Add(time.Hour).Unix()},
+		},
+		{
+			Name:          "Expired refresh token is refused",
+			Secret:        "refresh-secret",
+			Claims:        jwt.MapClaims{"sub": 1, "typ": "refresh", "exp": time.Now().Add(-time.Hour).Unix()},
+			ExpectedError: pkg.ErrTokenExpired,
+		},
+		{
+			Name:          "Access token can't be used to refresh",
+			Secret:        "access-secret",
+			Claims:        jwt.MapClaims{"sub": 1, "role": pkg.RoleUser, "exp": time.Now().Add(time.Hour).Unix()},
+			ExpectedError: pkg.ErrTokenInvalid,
+		},
+		{
+			Name:          "Token without the refresh type is refused",
+			Secret:        "refresh-secret",
+			Claims:        jwt.MapClaims{"sub": 1, "exp": time.Now().Add(time.Hour).Unix()},
+			ExpectedError: pkg.ErrTokenInvalid,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+
+			refreshToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, test.Claims).SignedString([]byte(test.Secret))
+			require.NoError(t, err)
+
+			if test.ExpectedError == nil {
+				sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`role` FROM `users` WHERE id = ? AND `users`.`deleted_at` IS NULL ORDER BY `users`.`id` LIMIT 1")).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "role"}).AddRow(1, pkg.RoleAdmin))
+			}
+
+			res, err := refreshUserService.RefreshToken(context.Background(), refreshToken)
+
+			if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
+				t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
+			}
+
+			if test.ExpectedError != nil {
+				require.ErrorIs(t, err, test.ExpectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			require.NotEmpty(t, res.RefreshToken)
+			require.Greater(t, res.ExpiresAt, time.Now().Unix())
+
+			// the new access token carries the role read again from the db
+			claims := jwt.MapClaims{}
+			_, err = jwt.ParseWithClaims(res.Token, claims, func(*jwt.Token) (interface{}, error) {
+				return []byte("access-secret"), nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, pkg.RoleAdmin, claims["role"])
+		})
+	}
+}
+
+func TestLoginWrongPassword(t *testing.T) {
+	sqlMock.ExpectQuery(regexp.QuoteMeta("FROM `users` WHERE username = ?")).
+		WithArgs("player").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password"}).AddRow(1, "player", "secret"))
+
+	_, err := userService.Login(context.Background(), api.LoginRequest{Username: "player", Password: "guess"})
+
+	if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
+		t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
+	}
+
+	require.ErrorIs(t, err, pkg.ErrInvalidCredentials)
+	require.Equal(t, api.CodeInvalidCredentials, pkg.ErrorCode(err))
+}
@@ -1,24 +1,29 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 
-	"wallet-api/internal/api"
+	"wallet-api/api"
+	"wallet-api/internal/logging"
 	"wallet-api/internal/pkg"
+	"wallet-api/internal/tracing"
 )
 
 type UserService struct {
 	DBConn      *gorm.DB
 	RedisClient *redis.Client
 	logger      *zap.Logger
-	settings    UserServiceSettings
+	settings    atomic.Pointer[UserServiceSettings]
 }
 
 // UserServiceSettings used to affect code flow
@@ -26,29 +31,53 @@ type UserServiceSettings struct {
 	Port      int
 	Hostname  string
 	JWTSecret string
+	// RefreshSecret signs the refresh tokens, which last RefreshExpiry
+	RefreshSecret string
+	RefreshExpiry time.Duration
 }
 
 type UserServices interface {
-	InsertUser(user *api.User) (*api.User, error)
-	GetUsers() ([]api.User, error)
-	GetUserByUsername(username string) (*pkg.User, error)
-	GetUserByID(uID uint) (*api.User, error)
-	Login(request api.LoginRequest) (*api.LoginResponse, error)
+	InsertUser(ctx context.Context, user *api.User) (*api.User, error)
+	GetUsers(ctx context.Context) ([]api.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*pkg.User, error)
+	GetUserByID(ctx context.Context, uID uint) (*api.User, error)
+	Login(ctx context.Context, request api.LoginRequest) (*api.LoginResponse, error)
+	RefreshToken(ctx context.Context, refreshToken string) (*api.LoginResponse, error)
 }
 
 func NewUserService(dbConn *gorm.DB, rc *redis.Client, logger *zap.Logger, settings UserServiceSettings) *UserService {
-	return &UserService{
+	if settings.RefreshExpiry <= 0 {
+		settings.RefreshExpiry = 7 * 24 * time.Hour
+	}
+
+	service := &UserService{
 		DBConn:      dbConn,
 		RedisClient: rc,
 		logger:      logger,
-		settings:    settings,
 	}
+	service.settings.Store(&settings)
+
+	return service
+}
+
+// Settings returns the settings the service currently runs with
+func (service *UserService) Settings() UserServiceSettings {
+	return *service.settings.Load()
+}
+
+// UpdateSettings applies the settings to the running service, the tokens already signed keep their expiry
+func (service *UserService) UpdateSettings(settings UserServiceSettings) {
+	service.settings.Store(&settings)
 }
 
 // InsertUser inserts new user in users table from data passed in arg.
-func (service *UserService) InsertUser(req *api.User) (*api.User, error) {
+func (service *UserService) InsertUser(ctx context.Context, req *api.User) (_ *api.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.InsertUser")
+	defer func() {
+		tracing.End(span, err)
+	}()
 
-	users, err := service.GetUsers()
+	users, err := service.GetUsers(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -73,105 +102,113 @@ func (service *UserService) InsertUser(req *api.User) (*api.User, error) {
 		Password:  req.Password,
 	}
 
-	res := service.DBConn.
+	res := service.DBConn.WithContext(ctx).
 		Select("first_name", "last_name", "email", "age", "username", "password").
 		Create(user)
 	if res.Error != nil {
-		service.logger.Error("something went wrong inserting user", zap.Any("user", user), zap.Error(res.Error))
+		logging.From(ctx, service.logger).Error("something went wrong inserting user", zap.Any("user", user), zap.Error(res.Error))
 		return nil, res.Error
 	}
 
-	service.logger.Debug("rows inserted", zap.Int64("rowsAffected", res.RowsAffected))
+	logging.From(ctx, service.logger).Debug("rows inserted", zap.Int64("rowsAffected", res.RowsAffected))
 
 	return req, nil
 }
 
 // GetUsers returns list of users in db.
-func (service *UserService) GetUsers() ([]api.User, error) {
+func (service *UserService) GetUsers(ctx context.Context) (_ []api.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUsers")
+	defer func() {
+		tracing.End(span, err)
+	}()
 
 	var users []api.User
 
 	// Get all records
-	res := service.DBConn.
+	res := service.DBConn.WithContext(ctx).
 		Select("first_name", "last_name", "email", "age", "username", "created_at", "updated_at", "id").
 		Find(&users)
 	if res.Error != nil {
-		service.logger.Error("something went wrong getting all players", zap.Error(res.Error))
+		logging.From(ctx, service.logger).Error("something went wrong getting all players", zap.Error(res.Error))
 		return nil, res.Error
 	}
 
-	service.logger.Debug("users grabbed", zap.Int64("number", res.RowsAffected))
+	logging.From(ctx, service.logger).Debug("users grabbed", zap.Int64("number", res.RowsAffected))
 
 	return users, nil
 }
 
 // GetUserByUsername attempts to retrieve a single row from the users table.
-func (service *UserService) GetUserByUsername(username string) (*pkg.User, error) {
+func (service *UserService) GetUserByUsername(ctx context.Context, username string) (_ *pkg.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUserByUsername")
+	defer func() {
+		tracing.End(span, err)
+	}()
 
 	var user pkg.User
 	// Get all records
-	res := service.DBConn.
-		Select("id", "first_name", "last_name", "email", "age", "username", "password", "created_at", "updated_at", "last_login_time_stamp").
+	res := service.DBConn.WithContext(ctx).
+		Select("id", "first_name", "last_name", "email", "age", "username", "password", "role", "kyc_tier", "created_at", "updated_at", "last_login_time_stamp").
 		Where("username = ?", username).
 		First(&user)
 	if res.Error != nil {
-		service.logger.Error("something went wrong getting player by username", zap.Error(res.Error), zap.String("username", username))
+		logging.From(ctx, service.logger).Error("something went wrong getting player by username", zap.Error(res.Error), zap.String("username", username))
 		return nil, res.Error
 	}
 
-	service.logger.Debug("user grabbed", zap.Any("user", user))
+	logging.From(ctx, service.logger).Debug("user grabbed", zap.Any("user", user))
 
 	return &user, nil
 }
 
 // GetUserByID grabs from table by id
-func (service *UserService) GetUserByID(uID uint) (*api.User, error) {
+func (service *UserService) GetUserByID(ctx context.Context, uID uint) (_ *api.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUserByID", attribute.Int("user.id", int(uID)))
+	defer func() {
+		tracing.End(span, err)
+	}()
 
 	var user api.User
 	// Get all records
-	res := service.DBConn.
+	res := service.DBConn.WithContext(ctx).
 		Select("first_name", "last_name", "email", "age", "username", "password", "last_login_time_stamp").
 		Where("id = ?", uID).
 		First(&user)
 	if res.Error != nil {
-		service.logger.Error("something went wrong getting player by ID", zap.Error(res.Error))
+		logging.From(ctx, service.logger).Error("something went wrong getting player by ID", zap.Error(res.Error))
 		return nil, res.Error
 	}
 
-	service.logger.Debug("user grabbed", zap.Any("user", user))
+	logging.From(ctx, service.logger).Debug("user grabbed", zap.Any("user", user))
 
 	return &user, nil
 }
 
 // Login is a wrapper for the GetUserByUsername that also validates the password
-func (service *UserService) Login(request api.LoginRequest) (*api.LoginResponse, error) {
+func (service *UserService) Login(ctx context.Context, request api.LoginRequest) (_ *api.LoginResponse, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.Login")
+	defer func() {
+		tracing.End(span, err)
+	}()
 
-	user, err := service.GetUserByUsername(request.Username)
+	user, err := service.GetUserByUsername(ctx, request.Username)
 	if err != nil {
 		return nil, err
 	}
 
 	if user.Password != request.Password {
-		return nil, fmt.Errorf("invalid passord for user")
+		return nil, pkg.ErrInvalidCredentials
 	}
 
-	// save userID in jwt token for requests
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub": user.ID,
-		"exp": time.Now().Add(time.Hour).Unix(),
-	})
-
-	// Sign and get the complete encoded token as a string using the secret
-	tokenString, err := token.SignedString([]byte(service.settings.JWTSecret))
+	tokens, err := service.newTokens(ctx, user)
 	if err != nil {
-		service.logger.Error("failed to create token", zap.Error(err))
 		return nil, err
 	}
 
 	unixCT := service.DBConn.NowFunc()
 
 	// update record with login timestamp
-	res := service.DBConn.
+	res := service.DBConn.WithContext(ctx).
 		Table("users").
 		Where("id = ?", user.ID).
 		Updates(map[string]interface{}{
@@ -179,9 +216,92 @@ func (service *UserService) Login(request api.LoginRequest) (*api.LoginResponse,
 			"updated_at":            unixCT,
 		})
 	if res.Error != nil {
-		service.logger.Error("something went wrong updating a player", zap.Error(res.Error))
+		logging.From(ctx, service.logger).Error("something went wrong updating a player", zap.Error(res.Error))
+		return nil, res.Error
+	}
+
+	return tokens, nil
+}
+
+// RefreshToken swaps a valid refresh token for a new pair, reading the role again in case it changed since the login
+func (service *UserService) RefreshToken(ctx context.Context, refreshToken string) (_ *api.LoginResponse, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.RefreshToken")
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	token, err := jwt.Parse(refreshToken, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return []byte(service.Settings().RefreshSecret), nil
+	})
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, pkg.ErrTokenExpired
+		}
+		return nil, pkg.ErrTokenInvalid
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != pkg.TokenRefresh {
+		return nil, pkg.ErrTokenInvalid
+	}
+
+	sub, ok := claims["sub"].(float64)
+	if !ok {
+		return nil, pkg.ErrTokenInvalid
+	}
+
+	var user pkg.User
+	res := service.DBConn.WithContext(ctx).
+		Select("id", "role").
+		Where("id = ?", int(sub)).
+		First(&user)
+	if res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong getting user to refresh token", zap.Error(res.Error), zap.Int("user_id", int(sub)))
 		return nil, res.Error
 	}
 
-	return &api.LoginResponse{Token: tokenString}, nil
+	return service.newTokens(ctx, &user)
+}
+
+// newTokens signs an access token with the user's id and role for requests and a longer lived refresh token to get new ones
+func (service *UserService) newTokens(ctx context.Context, user *pkg.User) (*api.LoginResponse, error) {
+	settings := service.Settings()
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":  user.ID,
+		"role": user.Role,
+		"typ":  pkg.TokenAccess,
+		"exp":  expiresAt.Unix(),
+	})
+
+	// Sign and get the complete encoded token as a string using the secret
+	tokenString, err := token.SignedString([]byte(settings.JWTSecret))
+	if err != nil {
+		logging.From(ctx, service.logger).Error("failed to create token", zap.Error(err))
+		return nil, err
+	}
+
+	refresh := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": user.ID,
+		"typ": pkg.TokenRefresh,
+		"exp": now.Add(settings.RefreshExpiry).Unix(),
+	})
+
+	refreshString, err := refresh.SignedString([]byte(settings.RefreshSecret))
+	if err != nil {
+		logging.From(ctx, service.logger).Error("failed to create refresh token", zap.Error(err))
+		return nil, err
+	}
+
+	return &api.LoginResponse{
+		Token:        tokenString,
+		RefreshToken: refreshString,
+		ExpiresAt:    expiresAt.Unix(),
+	}, nil
 }
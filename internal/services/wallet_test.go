@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"regexp"
 	"testing"
 	"time"
@@ -11,10 +12,21 @@ import (
 	"github.com/stretchr/testify/require"
 	"gorm.io/gorm"
 
-	"wallet-api/internal/api"
+	"wallet-api/api"
 	"wallet-api/internal/utils"
 )
 
+// expectLockedWallets expects the wallets to be locked before their funds change, as id and funds in id order
+func expectLockedWallets(wallets ...[2]int) {
+	rows := sqlmock.NewRows([]string{"id", "funds"})
+	for _, wallet := range wallets {
+		rows.AddRow(wallet[0], wallet[1])
+	}
+
+	sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`funds` FROM `wallets` WHERE id IN (") + `.*` + regexp.QuoteMeta(") ORDER BY id FOR UPDATE")).
+		WillReturnRows(rows)
+}
+
 type balanceTestCase struct {
 	Name           string
 	Input          *api.BalanceRequest
@@ -59,7 +71,7 @@ func TestBalance(t *testing.T) {
 			},
 			ExpectedErr: false,
 			SqlMock: func(test balanceTestCase) bool {
-				sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")).
+				sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")).
 					WithArgs(test.Input.WalletId, test.Input.UserId).
 					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).
 						AddRow(test.Input.WalletId, test.Input.UserId, "Wallet 1", 10000))
@@ -85,7 +97,7 @@ func TestBalance(t *testing.T) {
 			},
 			ExpectedErr: false,
 			SqlMock: func(test balanceTestCase) bool {
-				sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")).
+				sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")).
 					WithArgs(test.Input.WalletId, test.Input.UserId).
 					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).
 						AddRow(test.Input.WalletId, test.Input.UserId, "Wallet 1", 0))
@@ -107,7 +119,7 @@ func TestBalance(t *testing.T) {
 			ExpectedResult: nil,
 			ExpectedErr:    true,
 			SqlMock: func(test balanceTestCase) bool {
-				sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")).
+				sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")).
 					WithArgs(test.Input.WalletId, test.Input.UserId).
 					WillReturnError(gorm.ErrRecordNotFound)
 				return true
@@ -127,7 +139,7 @@ func TestBalance(t *testing.T) {
 			sqlM := test.RedisMock(test)
 			redisM := test.SqlMock(test)
 
-			res, err := walletService.Balance(test.Input.UserId, test.Input.WalletId)
+			res, err := walletService.Balance(context.Background(), test.Input.UserId, test.Input.WalletId)
 			if sqlM {
 				if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
 					t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
@@ -148,6 +160,67 @@ func TestBalance(t *testing.T) {
 	}
 }
 
+// TestBalanceUpdateSettings checks the settings updated while the service runs apply to the next balances
+func TestBalanceUpdateSettings(t *testing.T) {
+	settings := walletService.Settings()
+	t.Cleanup(func() { walletService.UpdateSettings(settings) })
+
+	key := utils.GenerateRedisKey(1)
+	expectWallet := func() {
+		sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")).
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).AddRow(1, 1, "Wallet 1", 10000))
+	}
+
+	// a shorter expiry is used for the balances cached next
+	walletService.UpdateSettings(WalletServiceSettings{RedisCacheTimeout: 5 * time.Minute})
+
+	redisClientMock.ExpectGet(key).RedisNil()
+	expectWallet()
+	redisClientMock.Regexp().ExpectSet(key, `^[0-9]`, 5*time.Minute).SetVal("ok")
+
+	res, err := walletService.Balance(context.Background(), 1, 1)
+	require.NoError(t, err)
+	require.Equal(t, "100", res.Balance.String())
+
+	// with the cache bypassed redis isn't read nor written
+	walletService.UpdateSettings(WalletServiceSettings{RedisCacheTimeout: 5 * time.Minute, BypassCache: true})
+
+	expectWallet()
+
+	res, err = walletService.Balance(context.Background(), 1, 1)
+	require.NoError(t, err)
+	require.Equal(t, "100", res.Balance.String())
+
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+	require.NoError(t, redisClientMock.ExpectationsWereMet())
+}
+
+// TestBalanceDeadline checks the deadline of the request reaches the db, the query is given up rather than waited for
+func TestBalanceDeadline(t *testing.T) {
+	key := utils.GenerateRedisKey(1)
+	redisClientMock.ExpectGet(key).RedisNil()
+	sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")).
+		WithArgs(1, 1).
+		WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).AddRow(1, 1, "Wallet 1", 10000))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	res, err := walletService.Balance(ctx, 1, 1)
+
+	require.Error(t, err)
+	require.Nil(t, res)
+	require.Less(t, time.Since(start), time.Second)
+	require.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+
+	if redisMockErr := redisClientMock.ExpectationsWereMet(); redisMockErr != nil {
+		t.Errorf("there were unfulfilled expectations: %s", redisMockErr)
+	}
+}
+
 func TestCredit(t *testing.T) {
 	emptyFunds, _ := decimal.NewFromString("0.00")
 	amount, _ := decimal.NewFromString("14.65")
@@ -169,15 +242,20 @@ func TestCredit(t *testing.T) {
 			},
 			ExpectedErr: false,
 			SqlMock: func(test creditTestCase) bool {
-				sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")).
+				sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")).
 					WithArgs(test.Input.WalletId, test.Input.UserId).
 					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).
 						AddRow(test.Input.WalletId, test.Input.UserId, "Wallet 1", 10000))
 
 				sqlMock.ExpectBegin()
+				expectLockedWallets([2]int{1, 10000})
 				sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE `wallets` SET `funds`=? WHERE `id` = ?")).
 					WithArgs(11465, 1).
 					WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO `transactions`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO `outbox_events`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
 				sqlMock.ExpectCommit()
 
 				return true
@@ -222,7 +300,7 @@ func TestCredit(t *testing.T) {
 			ExpectedResult: nil,
 			ExpectedErr:    true,
 			SqlMock: func(test creditTestCase) bool {
-				sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")).
+				sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")).
 					WithArgs(test.Input.WalletId, test.Input.UserId).
 					WillReturnError(gorm.ErrRecordNotFound)
 				return true
@@ -238,7 +316,7 @@ func TestCredit(t *testing.T) {
 			sqlM := test.RedisMock(test)
 			redisM := test.SqlMock(test)
 
-			res, err := walletService.Credit(test.Input)
+			res, err := walletService.Credit(context.Background(), test.Input)
 
 			if sqlM {
 				if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
@@ -283,15 +361,20 @@ func TestDebit(t *testing.T) {
 			},
 			ExpectedErr: false,
 			SqlMock: func(test debitTestCase) bool {
-				sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")).
+				sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")).
 					WithArgs(test.Input.WalletId, test.Input.UserId).
 					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).
 						AddRow(test.Input.WalletId, test.Input.UserId, "Wallet 1", 10000))
 
 				sqlMock.ExpectBegin()
+				expectLockedWallets([2]int{1, 10000})
 				sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE `wallets` SET `funds`=? WHERE `id` = ?")).
 					WithArgs(8535, 1).
 					WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO `transactions`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO `outbox_events`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
 				sqlMock.ExpectCommit()
 
 				return true
@@ -312,14 +395,48 @@ func TestDebit(t *testing.T) {
 			ExpectedResult: nil,
 			ExpectedErr:    true,
 			SqlMock: func(test debitTestCase) bool {
-				sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")).
+				sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")).
+					WithArgs(test.Input.WalletId, test.Input.UserId).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).
+						AddRow(test.Input.WalletId, test.Input.UserId, "Wallet 1", 10000))
+				return true
+			},
+			RedisMock: func(test debitTestCase) bool { return false },
+		},
+		{
+			Name: "Attempt to deduct funds spent by a concurrent debit",
+			Input: &api.DebitRequest{
+				UserId:   1,
+				WalletId: 1,
+				Amount:   amount,
+			},
+			ExpectedResult: nil,
+			ExpectedErr:    true,
+			SqlMock: func(test debitTestCase) bool {
+				sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")).
 					WithArgs(test.Input.WalletId, test.Input.UserId).
 					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).
 						AddRow(test.Input.WalletId, test.Input.UserId, "Wallet 1", 10000))
+
+				sqlMock.ExpectBegin()
+				expectLockedWallets([2]int{1, 1000})
+				sqlMock.ExpectRollback()
 				return true
 			},
 			RedisMock: func(test debitTestCase) bool { return false },
 		},
+		{
+			Name: "Attempt to deduct less than a cent",
+			Input: &api.DebitRequest{
+				UserId:   1,
+				WalletId: 1,
+				Amount:   decimal.RequireFromString("14.655"),
+			},
+			ExpectedResult: nil,
+			ExpectedErr:    true,
+			SqlMock:        func(test debitTestCase) bool { return false },
+			RedisMock:      func(test debitTestCase) bool { return false },
+		},
 		{
 			Name: "Attempt to deduct Negative funds",
 			Input: &api.DebitRequest{
@@ -354,7 +471,7 @@ func TestDebit(t *testing.T) {
 			ExpectedResult: nil,
 			ExpectedErr:    true,
 			SqlMock: func(test debitTestCase) bool {
-				sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")).
+				sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")).
 					WithArgs(test.Input.WalletId, test.Input.UserId).
 					WillReturnError(gorm.ErrRecordNotFound)
 				return true
@@ -370,7 +487,140 @@ func TestDebit(t *testing.T) {
 			sqlM := test.RedisMock(test)
 			redisM := test.SqlMock(test)
 
-			res, err := walletService.Debit(test.Input)
+			res, err := walletService.Debit(context.Background(), test.Input)
+
+			if sqlM {
+				if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
+					t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
+				}
+			}
+			if redisM {
+				if redisMockErr := redisClientMock.ExpectationsWereMet(); redisMockErr != nil {
+					t.Errorf("there were unfulfilled expectations: %s", redisMockErr)
+				}
+			}
+
+			if test.ExpectedErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, res.Balance.String(), test.ExpectedResult.Balance.String())
+			}
+		})
+	}
+}
+
+type transferTestCase struct {
+	Name           string
+	Input          *api.TransferRequest
+	ExpectedResult *api.TransferResponse
+	ExpectedErr    bool
+	SqlMock        func(test transferTestCase) bool
+	RedisMock      func(test transferTestCase) bool
+}
+
+func TestTransfer(t *testing.T) {
+	amount, _ := decimal.NewFromString("14.65")
+	amountExpected, _ := decimal.NewFromString("85.35")
+
+	testCases := []transferTestCase{
+		{
+			Name: "Simple test, move funds",
+			Input: &api.TransferRequest{
+				UserId:     1,
+				WalletId:   1,
+				ToWalletId: 2,
+				Amount:     amount,
+			},
+			ExpectedResult: &api.TransferResponse{
+				UserID:     1,
+				WalletID:   1,
+				ToWalletID: 2,
+				Balance:    amountExpected,
+			},
+			ExpectedErr: false,
+			SqlMock: func(test transferTestCase) bool {
+				sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")).
+					WithArgs(test.Input.WalletId, test.Input.UserId).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).
+						AddRow(test.Input.WalletId, test.Input.UserId, "Wallet 1", 10000))
+				sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE id = ? ORDER BY `wallets`.`id` LIMIT 1")).
+					WithArgs(test.Input.ToWalletId).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).
+						AddRow(test.Input.ToWalletId, 2, "Main Wallet", 500))
+
+				sqlMock.ExpectBegin()
+				expectLockedWallets([2]int{1, 10000}, [2]int{2, 500})
+				sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE `wallets` SET `funds`=? WHERE `id` = ?")).
+					WithArgs(8535, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO `transactions`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO `outbox_events`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE `wallets` SET `funds`=? WHERE `id` = ?")).
+					WithArgs(1965, 2).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO `transactions`")).
+					WillReturnResult(sqlmock.NewResult(2, 1))
+				sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO `outbox_events`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				sqlMock.ExpectCommit()
+
+				return true
+			},
+			RedisMock: func(test transferTestCase) bool {
+				redisClientMock.Regexp().ExpectSet(utils.GenerateRedisKey(test.Input.WalletId), `^[0-9]`, 60*time.Minute).SetVal("ok")
+				redisClientMock.Regexp().ExpectSet(utils.GenerateRedisKey(test.Input.ToWalletId), `^[0-9]`, 60*time.Minute).SetVal("ok")
+				return true
+			},
+		},
+		{
+			Name: "Attempt to transfer to the same wallet",
+			Input: &api.TransferRequest{
+				UserId:     1,
+				WalletId:   1,
+				ToWalletId: 1,
+				Amount:     amount,
+			},
+			ExpectedResult: nil,
+			ExpectedErr:    true,
+			SqlMock:        func(test transferTestCase) bool { return false },
+			RedisMock:      func(test transferTestCase) bool { return false },
+		},
+		{
+			Name: "Attempt to transfer more than the wallet contains",
+			Input: &api.TransferRequest{
+				UserId:     1,
+				WalletId:   1,
+				ToWalletId: 2,
+				Amount:     amount,
+			},
+			ExpectedResult: nil,
+			ExpectedErr:    true,
+			SqlMock: func(test transferTestCase) bool {
+				sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")).
+					WithArgs(test.Input.WalletId, test.Input.UserId).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).
+						AddRow(test.Input.WalletId, test.Input.UserId, "Wallet 1", 1000))
+				sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE id = ? ORDER BY `wallets`.`id` LIMIT 1")).
+					WithArgs(test.Input.ToWalletId).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds"}).
+						AddRow(test.Input.ToWalletId, 2, "Main Wallet", 500))
+				return true
+			},
+			RedisMock: func(test transferTestCase) bool { return false },
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+
+			// set up the mock results
+			sqlM := test.SqlMock(test)
+			redisM := test.RedisMock(test)
+
+			res, err := walletService.Transfer(context.Background(), test.Input)
 
 			if sqlM {
 				if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
@@ -2,18 +2,23 @@ package services
 
 import (
 	"context"
-	"errors"
-	"fmt"
-	"strconv"
+	"encoding/json"
+	"slices"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
-	"wallet-api/internal/api"
+	"wallet-api/api"
+	"wallet-api/internal/logging"
+	"wallet-api/internal/metrics"
 	"wallet-api/internal/pkg"
+	"wallet-api/internal/tracing"
 	"wallet-api/internal/utils"
 )
 
@@ -21,41 +26,80 @@ type WalletService struct {
 	DBConn      *gorm.DB
 	Cache       *redis.Client
 	logger      *zap.Logger
-	settings    WalletServiceSettings
+	settings    atomic.Pointer[WalletServiceSettings]
 	UserService *UserService
+	Guardian    *GuardianService
+	Limits      *LimitService
+	Gaming      *GamingService
+	KYC         *KYCService
 }
 
 // WalletServiceSettings used to affect code flow
 type WalletServiceSettings struct {
 	Port              int
 	Hostname          string
-	RedisCacheTimeout int
+	RedisCacheTimeout time.Duration
+	// BypassCache serves the balances from the db and drops the cached ones, for while redis misbehaves
+	BypassCache bool
 }
 
 type WalletServices interface {
-	Balance(userID, walletID int) (*api.BalanceResponse, error)
-	Credit(creditReq *api.CreditRequest) (*api.CreditResponse, error)
-	Debit(debitReq *api.DebitRequest) (*api.DebitResponse, error)
-	getUserWalletByID(userID, walletID int) (*pkg.Wallet, error)
-	updateUserWalletByID(wallet *pkg.Wallet) error
+	Balance(ctx context.Context, userID, walletID int) (*api.BalanceResponse, error)
+	Credit(ctx context.Context, creditReq *api.CreditRequest) (*api.CreditResponse, error)
+	CreditWin(ctx context.Context, winReq *api.WinRequest) (*api.CreditResponse, error)
+	Debit(ctx context.Context, debitReq *api.DebitRequest) (*api.DebitResponse, error)
+	Transfer(ctx context.Context, transferReq *api.TransferRequest) (*api.TransferResponse, error)
+	Subscribe(ctx context.Context, userID, walletID int) (<-chan string, error)
+	getUserWalletByID(ctx context.Context, userID, walletID int) (*pkg.Wallet, error)
+	updateUserWalletByID(ctx context.Context, wallet *pkg.Wallet, txn *pkg.Transaction) error
 }
 
 func NewWalletService(dbConn *gorm.DB, rc *redis.Client, logger *zap.Logger, settings WalletServiceSettings, userService *UserService) *WalletService {
-	return &WalletService{
+	service := &WalletService{
 		DBConn:      dbConn,
 		Cache:       rc,
 		logger:      logger,
-		settings:    settings,
 		UserService: userService,
 	}
+	service.settings.Store(&settings)
+
+	return service
+}
+
+// Settings returns the settings the service currently runs with
+func (w *WalletService) Settings() WalletServiceSettings {
+	return *w.settings.Load()
 }
 
-func (w *WalletService) Balance(userID, walletID int) (*api.BalanceResponse, error) {
+// UpdateSettings applies the settings to the running service, the operations already started keep the previous ones
+func (w *WalletService) UpdateSettings(settings WalletServiceSettings) {
+	w.settings.Store(&settings)
+}
+
+func (w *WalletService) Balance(ctx context.Context, userID, walletID int) (_ *api.BalanceResponse, err error) {
+	ctx, span := tracing.Start(ctx, "WalletService.Balance", attribute.Int("user.id", userID), attribute.Int("wallet.id", walletID))
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	if w.Settings().BypassCache {
+		wallet, err := w.getUserWalletByID(ctx, userID, walletID)
+		if err != nil {
+			return nil, err
+		}
+
+		return &api.BalanceResponse{
+			UserID:   userID,
+			WalletID: walletID,
+			Balance:  decimal.NewFromInt(int64(wallet.Funds)).Div(decimal.NewFromInt(100)),
+		}, nil
+	}
 
 	redisKey := utils.GenerateRedisKey(walletID)
-	walletBalance, err := w.Cache.Get(context.TODO(), redisKey).Result()
+	walletBalance, err := w.Cache.Get(ctx, redisKey).Result()
 	if err != nil && err != redis.Nil {
-		w.logger.Error(
+		metrics.RecordBalanceCache(metrics.CacheError)
+		logging.From(ctx, w.logger).Error(
 			"something went wrong getting the wallet from cache",
 			zap.Error(err),
 			zap.Int64("user_id", int64(userID)),
@@ -65,9 +109,11 @@ func (w *WalletService) Balance(userID, walletID int) (*api.BalanceResponse, err
 	}
 
 	if walletBalance != "" {
+		metrics.RecordBalanceCache(metrics.CacheHit)
+
 		wBalance, err := decimal.NewFromString(walletBalance)
 		if err != nil {
-			w.logger.Error(
+			logging.From(ctx, w.logger).Error(
 				"something parsing the wallet balance",
 				zap.Error(err),
 				zap.Int64("user_id", int64(userID)),
@@ -82,16 +128,18 @@ func (w *WalletService) Balance(userID, walletID int) (*api.BalanceResponse, err
 		}, nil
 	}
 
-	wallet, err := w.getUserWalletByID(userID, walletID)
+	metrics.RecordBalanceCache(metrics.CacheMiss)
+
+	wallet, err := w.getUserWalletByID(ctx, userID, walletID)
 	if err != nil {
 		return nil, err
 	}
 
-	w.logger.Debug("wallet grabbed", zap.Any("wallet", wallet))
+	logging.From(ctx, w.logger).Debug("wallet grabbed", zap.Any("wallet", wallet))
 
-	err = w.Cache.Set(context.TODO(), redisKey, wallet.Funds, time.Duration(w.settings.RedisCacheTimeout*int(time.Minute))).Err()
+	err = w.Cache.Set(ctx, redisKey, wallet.Funds, w.Settings().RedisCacheTimeout).Err()
 	if err != nil {
-		w.logger.Error(
+		logging.From(ctx, w.logger).Error(
 			"something went wrong saving the balance in cache",
 			zap.Error(err),
 			zap.Any("wallet-balance", wallet.Funds),
@@ -106,15 +154,15 @@ func (w *WalletService) Balance(userID, walletID int) (*api.BalanceResponse, err
 	}, nil
 }
 
-func (w *WalletService) getUserWalletByID(userID, walletID int) (*pkg.Wallet, error) {
+func (w *WalletService) getUserWalletByID(ctx context.Context, userID, walletID int) (*pkg.Wallet, error) {
 	var wallet pkg.Wallet
 	// Get all records
-	res := w.DBConn.
-		Select("id", "user_id", "name", "funds").
+	res := w.DBConn.WithContext(ctx).
+		Select("id", "user_id", "name", "funds", "status", "block_credits").
 		Where(map[string]interface{}{"id": walletID, "user_id": userID}).
 		First(&wallet)
 	if res.Error != nil {
-		w.logger.Error(
+		logging.From(ctx, w.logger).Error(
 			"something went wrong getting the wallet",
 			zap.Error(res.Error),
 			zap.Int64("user_id", int64(userID)),
@@ -126,72 +174,349 @@ func (w *WalletService) getUserWalletByID(userID, walletID int) (*pkg.Wallet, er
 	return &wallet, nil
 }
 
-func (w *WalletService) updateUserWalletByID(wallet *pkg.Wallet) error {
-	// Get all records
-	res := w.DBConn.Model(&wallet).Update("funds", wallet.Funds)
+// getWalletByID grabs any wallet, used for the receiving end of transfers and the wins
+func (w *WalletService) getWalletByID(ctx context.Context, walletID int) (*pkg.Wallet, error) {
+	var wallet pkg.Wallet
+	res := w.DBConn.WithContext(ctx).
+		Select("id", "user_id", "name", "funds", "status", "block_credits").
+		Where("id = ?", walletID).
+		First(&wallet)
 	if res.Error != nil {
-		w.logger.Error(
-			"something went wrong updating the wallet",
+		logging.From(ctx, w.logger).Error(
+			"something went wrong getting the wallet",
 			zap.Error(res.Error),
+			zap.Int64("wallet_id", int64(walletID)),
+		)
+		return nil, res.Error
+	}
+
+	return &wallet, nil
+}
+
+// updateUserWalletByID applies the ledger entry to the funds of the wallet and saves both in one db transaction
+func (w *WalletService) updateUserWalletByID(ctx context.Context, wallet *pkg.Wallet, txn *pkg.Transaction) error {
+	err := w.saveEntries(ctx, nil, walletEntry{wallet: wallet, txn: txn})
+	if err != nil {
+		logging.From(ctx, w.logger).Error(
+			"something went wrong updating the wallet",
+			zap.Error(err),
 			zap.Any("wallet", wallet),
 		)
-		return res.Error
+		return err
 	}
 
 	return nil
 }
 
-func (w *WalletService) Credit(creditReq *api.CreditRequest) (*api.CreditResponse, error) {
+// walletEntry is a ledger entry along with the wallet whose funds it changes
+type walletEntry struct {
+	wallet *pkg.Wallet
+	txn    *pkg.Transaction
+}
+
+// saveEntries applies the entries to the funds of their wallets and saves them with their outbox events in one db
+// transaction. The wallets are locked in id order first and their funds read again from the locked rows, so concurrent
+// operations on a wallet queue up instead of overdrawing it from funds read before the others committed. locked, when
+// given, runs once the wallets are locked, followed by the limits and the KYC balance caps so the usage and balances
+// they read can't change under them either. The wallets and entries passed get the new balances.
+func (w *WalletService) saveEntries(ctx context.Context, locked func(tx *gorm.DB) error, entries ...walletEntry) error {
+	ids := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, entry.wallet.ID)
+	}
+	slices.Sort(ids)
+
+	return w.DBConn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var wallets []pkg.Wallet
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "funds").
+			Where("id IN ?", ids).
+			Order("id").
+			Find(&wallets)
+		if res.Error != nil {
+			return res.Error
+		}
 
-	if creditReq.Amount.IsNegative() || creditReq.Amount.IsZero() {
-		err := errors.New(pkg.WrongAmount)
-		w.logger.Error(
-			"attempted to credit invalid amount",
+		funds := make(map[int]int, len(wallets))
+		for _, wallet := range wallets {
+			funds[wallet.ID] = wallet.Funds
+		}
+
+		if locked != nil {
+			if err := locked(tx); err != nil {
+				return err
+			}
+		}
+
+		if w.Limits != nil {
+			for _, entry := range entries {
+				if err := w.Limits.checkLimits(ctx, tx, entry.wallet, entry.txn); err != nil {
+					return err
+				}
+			}
+		}
+
+		if w.KYC != nil {
+			if err := w.KYC.checkBalances(ctx, tx, entries); err != nil {
+				return err
+			}
+		}
+
+		for _, entry := range entries {
+			balance, ok := funds[entry.wallet.ID]
+			if !ok {
+				return gorm.ErrRecordNotFound
+			}
+
+			if entry.txn.Type == pkg.TransactionDebit {
+				balance -= entry.txn.Amount
+			} else {
+				balance += entry.txn.Amount
+			}
+
+			if balance < 0 {
+				return pkg.ErrNotEnoughFunds
+			}
+
+			funds[entry.wallet.ID] = balance
+			entry.wallet.Funds, entry.txn.Balance = balance, balance
+
+			if res := tx.Model(entry.wallet).Update("funds", balance); res.Error != nil {
+				return res.Error
+			}
+			if res := tx.Save(entry.txn); res.Error != nil {
+				return res.Error
+			}
+			if err := saveOutboxEvent(tx, entry.txn); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Subscribe returns the payloads of the wallet's events as they're published, the channel is closed once the context is done
+func (w *WalletService) Subscribe(ctx context.Context, userID, walletID int) (<-chan string, error) {
+
+	if _, err := w.getUserWalletByID(ctx, userID, walletID); err != nil {
+		return nil, err
+	}
+
+	pubsub := w.Cache.Subscribe(ctx, utils.GenerateEventsChannel(walletID))
+
+	// wait for the subscription so no event is missed between the balance sent and the first one streamed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		logging.From(ctx, w.logger).Error(
+			"something went wrong subscribing to the wallet events",
 			zap.Error(err),
-			zap.Any("creditReq", creditReq),
+			zap.Int64("wallet_id", int64(walletID)),
 		)
 		return nil, err
 	}
 
-	wallet, err := w.getUserWalletByID(creditReq.UserId, creditReq.WalletId)
+	payloads := make(chan string)
+	go func() {
+		defer close(payloads)
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				select {
+				case payloads <- msg.Payload:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return payloads, nil
+}
+
+// saveOutboxEvent writes the event describing the ledger entry, it has to run in the db transaction saving the entry
+func saveOutboxEvent(tx *gorm.DB, txn *pkg.Transaction) error {
+	eventType := pkg.EventWalletCredited
+	switch {
+	case txn.Category == pkg.CategoryTransfer && txn.Type == pkg.TransactionDebit:
+		eventType = pkg.EventWalletTransferredOut
+	case txn.Category == pkg.CategoryTransfer:
+		eventType = pkg.EventWalletTransferredIn
+	case txn.Type == pkg.TransactionDebit:
+		eventType = pkg.EventWalletDebited
+	}
+
+	occurredAt := txn.UpdatedAt
+	if occurredAt.IsZero() {
+		occurredAt = tx.NowFunc()
+	}
+
+	payload, err := json.Marshal(api.WalletEvent{
+		Type:             eventType,
+		TransactionID:    txn.ID,
+		WalletID:         txn.WalletID,
+		UserID:           txn.UserID,
+		Amount:           fromCents(txn.Amount),
+		Balance:          fromCents(txn.Balance),
+		Category:         txn.Category,
+		TransferWalletID: txn.TransferWalletID,
+		OccurredAt:       occurredAt,
+	})
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	amountToAdd := creditReq.Amount.Mul(decimal.NewFromFloat(100))
+	return tx.Create(&pkg.OutboxEvent{Type: eventType, WalletID: txn.WalletID, UserID: txn.UserID, Payload: string(payload)}).Error
+}
 
-	walletFunds := decimal.NewFromInt(int64(wallet.Funds)) // should already be in 100s
+// cacheBalance saves the latest funds of the wallet, in case of error the cached amount is removed. While the cache is
+// bypassed it's removed too, so it isn't served stale once the cache is back.
+func (w *WalletService) cacheBalance(ctx context.Context, walletID, funds int) {
+	settings := w.Settings()
+	redisKey := utils.GenerateRedisKey(walletID)
 
-	newBalance := walletFunds.Add(amountToAdd)
+	if settings.BypassCache {
+		if err := w.Cache.Del(ctx, redisKey).Err(); err != nil {
+			logging.From(ctx, w.logger).Error(
+				"something went wrong deleting the cached balance",
+				zap.Error(err),
+				zap.Int64("wallet_id", int64(walletID)),
+			)
+		}
+		return
+	}
+
+	err := w.Cache.Set(ctx, redisKey, funds, settings.RedisCacheTimeout).Err()
+	if err != nil {
+		_ = w.Cache.Del(ctx, redisKey)
+		logging.From(ctx, w.logger).Error(
+			"something went wrong updating the cached data, deleting",
+			zap.Error(err),
+			zap.Int64("wallet_id", int64(walletID)),
+		)
+	}
+}
 
-	wallet.Funds, _ = strconv.Atoi(newBalance.String())
+func (w *WalletService) Credit(ctx context.Context, creditReq *api.CreditRequest) (res *api.CreditResponse, err error) {
+	ctx, span := tracing.Start(ctx, "WalletService.Credit", attribute.Int("user.id", creditReq.UserId), attribute.Int("wallet.id", creditReq.WalletId))
+	defer func() {
+		metrics.RecordOperation(pkg.TransactionCredit, creditReq.Amount, err)
+		tracing.End(span, err)
+	}()
 
-	if err = w.updateUserWalletByID(wallet); err != nil {
+	if !validAmount(creditReq.Amount) {
+		err := pkg.ErrWrongAmount
+		logging.From(ctx, w.logger).Error(
+			"attempted to credit invalid amount",
+			zap.Error(err),
+			zap.Any("creditReq", creditReq),
+		)
 		return nil, err
 	}
 
-	err = w.Cache.Set(context.TODO(), utils.GenerateRedisKey(creditReq.WalletId), newBalance.String(), time.Duration(w.settings.RedisCacheTimeout*int(time.Minute))).Err()
+	// wins are kept out of the deposit limit, they're only taken from game servers through CreditWin
+	if creditReq.Category == pkg.CategoryWin {
+		err := pkg.ErrGameServerOnly
+		logging.From(ctx, w.logger).Error(
+			"attempted to credit a win as a player",
+			zap.Error(err),
+			zap.Any("creditReq", creditReq),
+		)
+		return nil, err
+	}
+
+	wallet, err := w.getUserWalletByID(ctx, creditReq.UserId, creditReq.WalletId)
 	if err != nil {
-		// in case of error just delete the cached amount
-		_ = w.Cache.Del(context.TODO(), utils.GenerateRedisKey(creditReq.WalletId))
-		w.logger.Error(
-			"something went wrong updating the cached data",
+		return nil, err
+	}
+
+	return w.credit(ctx, wallet, toCents(creditReq.Amount), creditReq.Category)
+}
+
+// CreditWin credits a player's win sent by a game server, to any wallet. Unlike the credits of the players it isn't a
+// deposit so it's left out of the deposit limit and lowers the net loss.
+func (w *WalletService) CreditWin(ctx context.Context, winReq *api.WinRequest) (res *api.CreditResponse, err error) {
+	ctx, span := tracing.Start(ctx, "WalletService.CreditWin", attribute.Int("wallet.id", winReq.WalletId))
+	defer func() {
+		metrics.RecordOperation(pkg.TransactionCredit, winReq.Amount, err)
+		tracing.End(span, err)
+	}()
+
+	if !validAmount(winReq.Amount) {
+		err := pkg.ErrWrongAmount
+		logging.From(ctx, w.logger).Error(
+			"attempted to credit invalid win",
 			zap.Error(err),
-			zap.Any("wallet", wallet),
+			zap.Any("winReq", winReq),
 		)
+		return nil, err
 	}
 
+	wallet, err := w.getWalletByID(ctx, winReq.WalletId)
+	if err != nil {
+		return nil, err
+	}
+
+	return w.credit(ctx, wallet, toCents(winReq.Amount), pkg.CategoryWin)
+}
+
+// credit adds the amount to the wallet once it passes the checks of the services attached
+func (w *WalletService) credit(ctx context.Context, wallet *pkg.Wallet, amount int, category string) (*api.CreditResponse, error) {
+
+	if err := w.checkWalletStatus(ctx, wallet, pkg.TransactionCredit); err != nil {
+		return nil, err
+	}
+
+	txn := &pkg.Transaction{
+		WalletID: wallet.ID,
+		UserID:   wallet.UserID,
+		Type:     pkg.TransactionCredit,
+		Amount:   amount,
+		Category: category,
+		Status:   pkg.TransactionCompleted,
+	}
+
+	if w.Gaming != nil {
+		if err := w.Gaming.checkCredit(ctx, wallet, txn); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.updateUserWalletByID(ctx, wallet, txn); err != nil {
+		return nil, err
+	}
+
+	w.cacheBalance(ctx, wallet.ID, wallet.Funds)
+
 	return &api.CreditResponse{
-		UserID:   creditReq.UserId,
-		WalletID: creditReq.WalletId,
-		Balance:  newBalance.Div(decimal.NewFromFloat(100)),
+		UserID:        wallet.UserID,
+		WalletID:      wallet.ID,
+		Balance:       fromCents(wallet.Funds),
+		TransactionID: txn.ID,
 	}, nil
 }
 
-func (w *WalletService) Debit(debitReq *api.DebitRequest) (*api.DebitResponse, error) {
-	if debitReq.Amount.IsNegative() || debitReq.Amount.IsZero() {
-		err := errors.New(pkg.WrongAmount)
-		w.logger.Error(
+func (w *WalletService) Debit(ctx context.Context, debitReq *api.DebitRequest) (res *api.DebitResponse, err error) {
+	ctx, span := tracing.Start(ctx, "WalletService.Debit", attribute.Int("user.id", debitReq.UserId), attribute.Int("wallet.id", debitReq.WalletId))
+	defer func() {
+		// debits waiting for the guardian are recorded when they're approved
+		if res == nil || res.Status != pkg.TransactionPending {
+			metrics.RecordOperation(pkg.TransactionDebit, debitReq.Amount, err)
+		}
+		tracing.End(span, err)
+	}()
+
+	if !validAmount(debitReq.Amount) {
+		err := pkg.ErrWrongAmount
+		logging.From(ctx, w.logger).Error(
 			"attempted to debit invalid amount",
 			zap.Error(err),
 			zap.Any("debitReq", debitReq),
@@ -199,46 +524,278 @@ func (w *WalletService) Debit(debitReq *api.DebitRequest) (*api.DebitResponse, e
 		return nil, err
 	}
 
-	wallet, err := w.getUserWalletByID(debitReq.UserId, debitReq.WalletId)
+	wallet, err := w.getUserWalletByID(ctx, debitReq.UserId, debitReq.WalletId)
 	if err != nil {
 		return nil, err
 	}
 
-	amountToAdd := debitReq.Amount.Mul(decimal.NewFromFloat(100))
+	if err = w.checkWalletStatus(ctx, wallet, pkg.TransactionDebit); err != nil {
+		return nil, err
+	}
 
-	walletFunds := decimal.NewFromInt(int64(wallet.Funds)) // should already be in 100s
+	amountToDeduct := toCents(debitReq.Amount)
 
-	newBalance := walletFunds.Sub(amountToAdd)
+	txn := &pkg.Transaction{
+		WalletID: wallet.ID,
+		UserID:   wallet.UserID,
+		Type:     pkg.TransactionDebit,
+		Amount:   amountToDeduct,
+		Category: debitReq.Category,
+	}
 
-	if newBalance.IsNegative() {
-		err = errors.New(pkg.NotEnoughFunds)
-		w.logger.Error(
-			"attempted to debit with insufficient funds",
+	if w.Gaming != nil {
+		if err = w.Gaming.checkDebit(ctx, w.DBConn, wallet, txn); err != nil {
+			return nil, err
+		}
+	}
+
+	if w.Guardian != nil {
+		needsApproval, err := w.Guardian.checkDebit(ctx, wallet, txn)
+		if err != nil {
+			return nil, err
+		}
+
+		// debits needing the guardian's approval are saved without touching the funds, the funds and limits are
+		// checked again with the wallet locked once it's approved
+		if needsApproval {
+			if wallet.Funds < txn.Amount {
+				err = pkg.ErrNotEnoughFunds
+				logging.From(ctx, w.logger).Error(
+					"attempted to debit with insufficient funds",
+					zap.Error(err),
+					zap.Any("transaction", txn),
+				)
+				return nil, err
+			}
+
+			if w.Limits != nil {
+				if err = w.Limits.checkLimits(ctx, w.DBConn, wallet, txn); err != nil {
+					return nil, err
+				}
+			}
+
+			txn.Balance = wallet.Funds
+			txn.Status = pkg.TransactionPending
+			if res := w.DBConn.WithContext(ctx).Create(txn); res.Error != nil {
+				logging.From(ctx, w.logger).Error("something went wrong saving the pending debit", zap.Error(res.Error), zap.Any("transaction", txn))
+				return nil, res.Error
+			}
+
+			return &api.DebitResponse{
+				UserID:        debitReq.UserId,
+				WalletID:      debitReq.WalletId,
+				Balance:       fromCents(wallet.Funds),
+				TransactionID: txn.ID,
+				Status:        txn.Status,
+			}, nil
+		}
+	}
+
+	if err = w.debitWallet(ctx, wallet, txn); err != nil {
+		return nil, err
+	}
+
+	return &api.DebitResponse{
+		UserID:        debitReq.UserId,
+		WalletID:      debitReq.WalletId,
+		Balance:       fromCents(wallet.Funds),
+		TransactionID: txn.ID,
+		Status:        txn.Status,
+	}, nil
+}
+
+// Transfer moves funds from the user's wallet to any other wallet, saving a debit and a credit in one db transaction
+func (w *WalletService) Transfer(ctx context.Context, transferReq *api.TransferRequest) (res *api.TransferResponse, err error) {
+	ctx, span := tracing.Start(ctx, "WalletService.Transfer",
+		attribute.Int("user.id", transferReq.UserId),
+		attribute.Int("wallet.id", transferReq.WalletId),
+		attribute.Int("to_wallet.id", transferReq.ToWalletId),
+	)
+	defer func() {
+		metrics.RecordOperation(pkg.CategoryTransfer, transferReq.Amount, err)
+		tracing.End(span, err)
+	}()
+
+	if !validAmount(transferReq.Amount) {
+		err := pkg.ErrWrongAmount
+		logging.From(ctx, w.logger).Error(
+			"attempted to transfer invalid amount",
 			zap.Error(err),
-			zap.Any("debitReq", debitReq),
+			zap.Any("transferReq", transferReq),
 		)
 		return nil, err
 	}
 
-	wallet.Funds, _ = strconv.Atoi(newBalance.String())
+	if transferReq.WalletId == transferReq.ToWalletId {
+		return nil, pkg.ErrSameWallet
+	}
 
-	if err = w.updateUserWalletByID(wallet); err != nil {
+	from, err := w.getUserWalletByID(ctx, transferReq.UserId, transferReq.WalletId)
+	if err != nil {
 		return nil, err
 	}
 
-	err = w.Cache.Set(context.TODO(), fmt.Sprintf("%d-balance", debitReq.UserId), newBalance.String(), time.Duration(w.settings.RedisCacheTimeout*int(time.Minute))).Err()
+	to, err := w.getWalletByID(ctx, transferReq.ToWalletId)
 	if err != nil {
-		_ = w.Cache.Del(context.TODO(), fmt.Sprintf("%d-balance", debitReq.UserId))
-		w.logger.Error(
-			"something went wrong updating the cached data, deleting",
+		return nil, err
+	}
+
+	if err = w.checkWalletStatus(ctx, from, pkg.TransactionDebit); err != nil {
+		return nil, err
+	}
+
+	if err = w.checkWalletStatus(ctx, to, pkg.TransactionCredit); err != nil {
+		return nil, err
+	}
+
+	amount := toCents(transferReq.Amount)
+
+	debit := &pkg.Transaction{
+		WalletID:         from.ID,
+		UserID:           from.UserID,
+		Type:             pkg.TransactionDebit,
+		Amount:           amount,
+		Category:         pkg.CategoryTransfer,
+		Status:           pkg.TransactionCompleted,
+		TransferWalletID: to.ID,
+	}
+	credit := &pkg.Transaction{
+		WalletID:         to.ID,
+		UserID:           to.UserID,
+		Type:             pkg.TransactionCredit,
+		Amount:           amount,
+		Category:         pkg.CategoryTransfer,
+		Status:           pkg.TransactionCompleted,
+		TransferWalletID: from.ID,
+	}
+
+	if w.Gaming != nil {
+		if err = w.Gaming.checkDebit(ctx, w.DBConn, from, debit); err != nil {
+			return nil, err
+		}
+		if err = w.Gaming.checkCredit(ctx, to, credit); err != nil {
+			return nil, err
+		}
+	}
+
+	// the receiver's balance cap is checked once the wallets are locked
+	if w.KYC != nil {
+		if err = w.KYC.checkTransferOut(ctx, from); err != nil {
+			return nil, err
+		}
+	}
+
+	// transfers can't wait for approval as the receiving wallet would be left hanging
+	if w.Guardian != nil {
+		needsApproval, err := w.Guardian.checkDebit(ctx, from, debit)
+		if err != nil {
+			return nil, err
+		}
+		if needsApproval {
+			return nil, pkg.ErrTransferNeedsApproval
+		}
+	}
+
+	if from.Funds < amount {
+		err = pkg.ErrNotEnoughFunds
+		logging.From(ctx, w.logger).Error(
+			"attempted to transfer with insufficient funds",
 			zap.Error(err),
-			zap.Any("wallet", wallet),
+			zap.Any("transferReq", transferReq),
 		)
+		return nil, err
 	}
 
-	return &api.DebitResponse{
-		UserID:   debitReq.UserId,
-		WalletID: debitReq.WalletId,
-		Balance:  newBalance.Div(decimal.NewFromFloat(100)),
+	err = w.saveEntries(ctx, nil, walletEntry{wallet: from, txn: debit}, walletEntry{wallet: to, txn: credit})
+	if err != nil {
+		logging.From(ctx, w.logger).Error(
+			"something went wrong saving the transfer",
+			zap.Error(err),
+			zap.Any("transferReq", transferReq),
+		)
+		return nil, err
+	}
+
+	w.cacheBalance(ctx, from.ID, from.Funds)
+	w.cacheBalance(ctx, to.ID, to.Funds)
+
+	return &api.TransferResponse{
+		UserID:        transferReq.UserId,
+		WalletID:      from.ID,
+		ToWalletID:    to.ID,
+		Balance:       fromCents(from.Funds),
+		TransactionID: debit.ID,
 	}, nil
 }
+
+// debitWallet deducts the transaction amount from the wallet and completes the transaction, the funds read with the
+// wallet are checked again once it's locked
+func (w *WalletService) debitWallet(ctx context.Context, wallet *pkg.Wallet, txn *pkg.Transaction) error {
+
+	if wallet.Funds < txn.Amount {
+		err := pkg.ErrNotEnoughFunds
+		logging.From(ctx, w.logger).Error(
+			"attempted to debit with insufficient funds",
+			zap.Error(err),
+			zap.Any("transaction", txn),
+		)
+		return err
+	}
+
+	txn.Status = pkg.TransactionCompleted
+
+	if err := w.updateUserWalletByID(ctx, wallet, txn); err != nil {
+		return err
+	}
+
+	w.cacheBalance(ctx, wallet.ID, wallet.Funds)
+
+	return nil
+}
+
+// checkWalletStatus refuses anything on closed wallets and debits on frozen ones, credits too if the freeze blocks them
+func (w *WalletService) checkWalletStatus(ctx context.Context, wallet *pkg.Wallet, operation string) error {
+	var err error
+
+	switch {
+	case wallet.Status == pkg.WalletClosed:
+		err = pkg.ErrWalletIsClosed
+	case wallet.Status == pkg.WalletFrozen && (operation == pkg.TransactionDebit || wallet.BlockCredits):
+		err = pkg.ErrWalletIsFrozen
+	default:
+		return nil
+	}
+
+	logging.From(ctx, w.logger).Error(
+		"attempted to "+operation+" wallet that's not active",
+		zap.Error(err),
+		zap.Int64("wallet_id", int64(wallet.ID)),
+	)
+
+	return err
+}
+
+// validAmount checks the amount moved is positive and in whole cents
+func validAmount(amount decimal.Decimal) bool {
+	return amount.IsPositive() && inCents(amount)
+}
+
+// validLimit checks the limit set is in whole cents, 0 meaning no limit
+func validLimit(amount decimal.Decimal) bool {
+	return !amount.IsNegative() && inCents(amount)
+}
+
+// inCents checks the amount has at most 2 decimals, anything smaller can't be saved and is refused rather than dropped
+func inCents(amount decimal.Decimal) bool {
+	return amount.Equal(amount.Truncate(2))
+}
+
+// toCents converts the amount received in requests to the 100s saved in the db, see inCents
+func toCents(amount decimal.Decimal) int {
+	return int(amount.Mul(decimal.NewFromInt(100)).IntPart())
+}
+
+// fromCents converts the 100s saved in the db to the amount sent in responses
+func fromCents(funds int) decimal.Decimal {
+	return decimal.NewFromInt(int64(funds)).Div(decimal.NewFromInt(100))
+}
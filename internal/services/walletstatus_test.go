@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+
+	"wallet-api/api"
+	"wallet-api/internal/pkg"
+)
+
+type walletStatusTestCase struct {
+	Name          string
+	Status        string
+	BlockCredits  bool
+	Credit        bool
+	ExpectedError error
+}
+
+func TestWalletStatus(t *testing.T) {
+	statusWalletService := NewWalletService(gormDB, rd, log, WalletServiceSettings{}, userService)
+
+	walletQuery := regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE `id` = ? AND `user_id` = ? ORDER BY `wallets`.`id` LIMIT 1")
+
+	testCases := []walletStatusTestCase{
+		{
+			Name:          "Debit on a frozen wallet is refused",
+			Status:        pkg.WalletFrozen,
+			ExpectedError: pkg.ErrWalletIsFrozen,
+		},
+		{
+			Name:          "Credit on a frozen wallet blocking credits is refused",
+			Status:        pkg.WalletFrozen,
+			BlockCredits:  true,
+			Credit:        true,
+			ExpectedError: pkg.ErrWalletIsFrozen,
+		},
+		{
+			Name:          "Credit on a closed wallet is refused",
+			Status:        pkg.WalletClosed,
+			Credit:        true,
+			ExpectedError: pkg.ErrWalletIsClosed,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+
+			sqlMock.ExpectQuery(walletQuery).
+				WithArgs(1, 1).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds", "status", "block_credits"}).
+					AddRow(1, 1, "Wallet 1", 10000, test.Status, test.BlockCredits))
+
+			var err error
+			if test.Credit {
+				_, err = statusWalletService.Credit(context.Background(), &api.CreditRequest{UserId: 1, WalletId: 1, Amount: decimal.NewFromInt(5)})
+			} else {
+				_, err = statusWalletService.Debit(context.Background(), &api.DebitRequest{UserId: 1, WalletId: 1, Amount: decimal.NewFromInt(5)})
+			}
+
+			if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
+				t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
+			}
+
+			require.ErrorIs(t, err, test.ExpectedError)
+		})
+	}
+}
+
+func TestCloseWalletWithFunds(t *testing.T) {
+	walletStatusService := NewWalletStatusService(gormDB, log, NewWalletService(gormDB, rd, log, WalletServiceSettings{}, userService))
+
+	sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`name`,`funds`,`status`,`block_credits` FROM `wallets` WHERE id = ? ORDER BY `wallets`.`id` LIMIT 1")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "funds", "status", "block_credits"}).
+			AddRow(1, 1, "Wallet 1", 10000, pkg.WalletFrozen, false))
+
+	_, err := walletStatusService.Close(context.Background(), 1, 1, &api.WalletStatusRequest{Reason: pkg.ReasonCustomerRequest})
+
+	if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
+		t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
+	}
+
+	require.ErrorIs(t, err, pkg.ErrWalletNotEmpty)
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"wallet-api/api"
+	"wallet-api/internal/logging"
+	"wallet-api/internal/pkg"
+)
+
+type WalletStatusService struct {
+	DBConn        *gorm.DB
+	logger        *zap.Logger
+	WalletService *WalletService
+}
+
+type WalletStatusServices interface {
+	GetStatus(ctx context.Context, walletID int) (*api.WalletStatusResponse, error)
+	Freeze(ctx context.Context, adminID, walletID int, req *api.WalletStatusRequest) (*api.WalletStatusResponse, error)
+	Unfreeze(ctx context.Context, adminID, walletID int, req *api.WalletStatusRequest) (*api.WalletStatusResponse, error)
+	Close(ctx context.Context, adminID, walletID int, req *api.WalletStatusRequest) (*api.WalletStatusResponse, error)
+}
+
+func NewWalletStatusService(dbConn *gorm.DB, logger *zap.Logger, walletService *WalletService) *WalletStatusService {
+	return &WalletStatusService{
+		DBConn:        dbConn,
+		logger:        logger,
+		WalletService: walletService,
+	}
+}
+
+// GetStatus returns the wallet's status along with the history of changes
+func (service *WalletStatusService) GetStatus(ctx context.Context, walletID int) (*api.WalletStatusResponse, error) {
+
+	wallet, err := service.WalletService.getWalletByID(ctx, walletID)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []pkg.WalletStatusChange
+	if res := service.DBConn.WithContext(ctx).Where("wallet_id = ?", walletID).Order("id desc").Find(&changes); res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong getting the wallet status history", zap.Error(res.Error), zap.Int("wallet_id", walletID))
+		return nil, res.Error
+	}
+
+	status := &api.WalletStatusResponse{
+		WalletID:     wallet.ID,
+		Status:       wallet.Status,
+		BlockCredits: wallet.BlockCredits,
+		History:      make([]api.WalletStatusChangeResponse, 0, len(changes)),
+	}
+
+	if status.Status == "" {
+		status.Status = pkg.WalletActive
+	}
+
+	for _, change := range changes {
+		status.History = append(status.History, api.WalletStatusChangeResponse{
+			ID:           change.ID,
+			AdminID:      change.AdminID,
+			FromStatus:   change.FromStatus,
+			ToStatus:     change.ToStatus,
+			Reason:       change.Reason,
+			Notes:        change.Notes,
+			BlockCredits: change.BlockCredits,
+			CreatedAt:    change.CreatedAt,
+		})
+	}
+
+	return status, nil
+}
+
+// Freeze stops debits on the wallet, and credits too if requested, freezing a frozen wallet updates the freeze
+func (service *WalletStatusService) Freeze(ctx context.Context, adminID, walletID int, req *api.WalletStatusRequest) (*api.WalletStatusResponse, error) {
+	return service.changeStatus(ctx, adminID, walletID, pkg.WalletFrozen, req)
+}
+
+// Unfreeze makes a frozen wallet active again
+func (service *WalletStatusService) Unfreeze(ctx context.Context, adminID, walletID int, req *api.WalletStatusRequest) (*api.WalletStatusResponse, error) {
+	return service.changeStatus(ctx, adminID, walletID, pkg.WalletActive, req)
+}
+
+// Close stops everything on an empty wallet for good
+func (service *WalletStatusService) Close(ctx context.Context, adminID, walletID int, req *api.WalletStatusRequest) (*api.WalletStatusResponse, error) {
+	return service.changeStatus(ctx, adminID, walletID, pkg.WalletClosed, req)
+}
+
+func (service *WalletStatusService) changeStatus(ctx context.Context, adminID, walletID int, status string, req *api.WalletStatusRequest) (*api.WalletStatusResponse, error) {
+
+	wallet, err := service.WalletService.getWalletByID(ctx, walletID)
+	if err != nil {
+		return nil, err
+	}
+
+	current := wallet.Status
+	if current == "" {
+		current = pkg.WalletActive
+	}
+
+	switch {
+	case current == pkg.WalletClosed,
+		status == pkg.WalletActive && current != pkg.WalletFrozen:
+		return nil, pkg.ErrInvalidStatusChange
+	case status == pkg.WalletClosed && wallet.Funds != 0:
+		return nil, pkg.ErrWalletNotEmpty
+	}
+
+	change := &pkg.WalletStatusChange{
+		WalletID:     walletID,
+		AdminID:      adminID,
+		FromStatus:   current,
+		ToStatus:     status,
+		Reason:       req.Reason,
+		Notes:        req.Notes,
+		BlockCredits: status == pkg.WalletFrozen && req.BlockCredits,
+	}
+
+	err = service.DBConn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(wallet).Updates(map[string]interface{}{"status": status, "block_credits": change.BlockCredits})
+		if res.Error != nil {
+			return res.Error
+		}
+
+		return tx.Create(change).Error
+	})
+	if err != nil {
+		logging.From(ctx, service.logger).Error("something went wrong changing the wallet status", zap.Error(err), zap.Any("change", change))
+		return nil, err
+	}
+
+	logging.From(ctx, service.logger).Info("wallet status changed", zap.Any("change", change))
+
+	return service.GetStatus(ctx, walletID)
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+
+	"wallet-api/api"
+	"wallet-api/internal/pkg"
+)
+
+type webhookTestCase struct {
+	Name             string
+	ReceiverStatus   int
+	Attempts         int
+	ExpectedStatus   string
+	ExpectedAttempts int
+	ExpectedRetry    bool
+}
+
+func TestRedeliver(t *testing.T) {
+	secret := "webhook-secret"
+	payload := `{"type":"wallet.credited","wallet_ID":1}`
+
+	var receiverStatus int
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get("X-Wallet-Timestamp"), 10, 64)
+
+		require.Equal(t, payload, string(body))
+		require.Equal(t, pkg.EventWalletCredited, r.Header.Get("X-Wallet-Event"))
+		require.Equal(t, pkg.WebhookSignature(secret, timestamp, body), r.Header.Get("X-Wallet-Signature"))
+
+		if receiverStatus == http.StatusFound {
+			w.Header().Set("Location", "http://169.254.169.254/")
+		}
+		w.WriteHeader(receiverStatus)
+	}))
+	defer receiver.Close()
+
+	// the receiver listens on the loopback
+	webhookService := NewWebhookService(gormDB, log, WebhookServiceSettings{MaxAttempts: 3, BackoffBase: 10 * time.Second, AllowInsecure: true})
+
+	testCases := []webhookTestCase{
+		{
+			Name:             "Accepted delivery is marked as delivered",
+			ReceiverStatus:   http.StatusOK,
+			ExpectedStatus:   pkg.DeliveryDelivered,
+			ExpectedAttempts: 1,
+		},
+		{
+			Name:             "Refused delivery is retried later",
+			ReceiverStatus:   http.StatusInternalServerError,
+			ExpectedStatus:   pkg.DeliveryPending,
+			ExpectedAttempts: 1,
+			ExpectedRetry:    true,
+		},
+		{
+			Name:             "Redirects aren't followed",
+			ReceiverStatus:   http.StatusFound,
+			ExpectedStatus:   pkg.DeliveryPending,
+			ExpectedAttempts: 1,
+			ExpectedRetry:    true,
+		},
+		{
+			Name:             "Refused delivery without attempts left fails",
+			ReceiverStatus:   http.StatusBadGateway,
+			Attempts:         2,
+			ExpectedStatus:   pkg.DeliveryFailed,
+			ExpectedAttempts: 3,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			receiverStatus = test.ReceiverStatus
+
+			sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `webhooks` WHERE id = ? AND user_id = ? ORDER BY `webhooks`.`id` LIMIT 1")).
+				WithArgs(1, 1).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "url", "secret", "events", "active"}).
+					AddRow(1, 1, receiver.URL, secret, "", true))
+			sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `webhook_deliveries` WHERE id = ? AND webhook_id = ? ORDER BY `webhook_deliveries`.`id` LIMIT 1")).
+				WithArgs(5, 1).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "webhook_id", "event_id", "event_type", "payload", "status", "attempts"}).
+					AddRow(5, 1, 9, pkg.EventWalletCredited, payload, pkg.DeliveryPending, test.Attempts))
+			sqlMock.ExpectBegin()
+			sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE `webhook_deliveries`")).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			sqlMock.ExpectCommit()
+
+			delivery, err := webhookService.Redeliver(context.Background(), 1, 1, 5)
+
+			if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
+				t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.ExpectedStatus, delivery.Status)
+			require.Equal(t, test.ExpectedAttempts, delivery.Attempts)
+			require.Equal(t, test.ReceiverStatus, delivery.LastStatusCode)
+			require.Equal(t, test.ExpectedRetry, delivery.NextAttemptAt != nil)
+		})
+	}
+}
+
+func TestWebhookPrivateAddresses(t *testing.T) {
+	webhookService := NewWebhookService(gormDB, log, WebhookServiceSettings{MaxAttempts: 3})
+
+	for _, url := range []string{"http://example.com/hook", "https://127.0.0.1/hook", "https://10.0.0.8/hook", "https://[::1]/hook", "https://169.254.169.254/latest"} {
+		_, err := webhookService.CreateWebhook(context.Background(), 1, &api.WebhookRequest{URL: url})
+		require.ErrorIs(t, err, pkg.ErrInvalidWebhookURL, url)
+	}
+
+	// the host is checked once resolved, and the transport error isn't shown to the owner
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the private receiver was reached")
+	}))
+	defer receiver.Close()
+
+	_, port, err := net.SplitHostPort(receiver.Listener.Addr().String())
+	require.NoError(t, err)
+
+	sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `webhooks` WHERE id = ? AND user_id = ? ORDER BY `webhooks`.`id` LIMIT 1")).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "url", "secret", "events", "active"}).
+			AddRow(1, 1, "https://localhost:"+port+"/hook", "webhook-secret", "", true))
+	sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `webhook_deliveries` WHERE id = ? AND webhook_id = ? ORDER BY `webhook_deliveries`.`id` LIMIT 1")).
+		WithArgs(5, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "webhook_id", "event_id", "event_type", "payload", "status", "attempts"}).
+			AddRow(5, 1, 9, pkg.EventWalletCredited, `{}`, pkg.DeliveryPending, 0))
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE `webhook_deliveries`")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectCommit()
+
+	delivery, err := webhookService.Redeliver(context.Background(), 1, 1, 5)
+
+	if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
+		t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
+	}
+
+	require.NoError(t, err)
+	require.Equal(t, pkg.DeliveryPending, delivery.Status)
+	require.Equal(t, webhookRequestFailed, delivery.LastError)
+}
+
+func TestDeliverDueStopsWhenDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the api shuts down while the first delivery is sent
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	webhookService := NewWebhookService(gormDB, log, WebhookServiceSettings{Timeout: time.Second, AllowInsecure: true})
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `webhook_deliveries` WHERE status = ? AND next_attempt_at <= ? ORDER BY id LIMIT 100 FOR UPDATE SKIP LOCKED")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "webhook_id", "event_id", "event_type", "payload", "status"}).
+			AddRow(5, 1, 9, pkg.EventWalletCredited, `{}`, pkg.DeliveryPending).
+			AddRow(6, 1, 10, pkg.EventWalletDebited, `{}`, pkg.DeliveryPending))
+	sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE `webhook_deliveries` SET `next_attempt_at`=?,`updated_at`=? WHERE id IN (?,?)")).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	sqlMock.ExpectCommit()
+	sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `webhooks` WHERE id IN (?,?)")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "url", "secret", "events", "active"}).
+			AddRow(1, 1, receiver.URL, "webhook-secret", "", true))
+
+	// the delivery in flight is saved, the next one is handed back
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE `webhook_deliveries`")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectCommit()
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE `webhook_deliveries` SET `next_attempt_at`=?,`updated_at`=? WHERE id IN (?) AND status = ?")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 6, pkg.DeliveryPending).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectCommit()
+
+	sent, err := webhookService.DeliverDue(ctx)
+
+	if sqlMockErr := sqlMock.ExpectationsWereMet(); sqlMockErr != nil {
+		t.Errorf("there were unfulfilled expectations: %s", sqlMockErr)
+	}
+
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, 1, sent)
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	settings := NewWebhookService(gormDB, log, WebhookServiceSettings{BackoffBase: 30 * time.Second, BackoffMax: time.Hour}).settings
+
+	require.Equal(t, 30*time.Second, settings.backoff(1))
+	require.Equal(t, 2*time.Minute, settings.backoff(3))
+	require.Equal(t, time.Hour, settings.backoff(8))
+	require.Equal(t, time.Hour, settings.backoff(100))
+}
@@ -0,0 +1,572 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"wallet-api/api"
+	"wallet-api/internal/logging"
+	"wallet-api/internal/pkg"
+)
+
+type WebhookService struct {
+	DBConn   *gorm.DB
+	logger   *zap.Logger
+	settings WebhookServiceSettings
+	Client   *http.Client
+}
+
+// WebhookServiceSettings holds the request timeout and poll interval, the attempts before a delivery is given up on and
+// the delay before the first retry, doubled on each one after
+type WebhookServiceSettings struct {
+	Timeout     time.Duration
+	Interval    time.Duration
+	BatchSize   int
+	MaxAttempts int
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// AllowInsecure lets webhooks use http and reach private addresses, for receivers running locally in development
+	AllowInsecure bool
+}
+
+// webhookRequestFailed is saved as the error of the deliveries the receiver couldn't be reached for, the transport
+// errors are logged only as they tell about the network the api runs in
+const webhookRequestFailed = "webhook request failed"
+
+type WebhookServices interface {
+	CreateWebhook(ctx context.Context, userID int, req *api.WebhookRequest) (*api.WebhookResponse, error)
+	GetWebhooks(ctx context.Context, userID int) ([]api.WebhookResponse, error)
+	DeleteWebhook(ctx context.Context, userID, webhookID int) error
+	GetDeliveries(ctx context.Context, userID, webhookID int) ([]api.WebhookDeliveryResponse, error)
+	Redeliver(ctx context.Context, userID, webhookID, deliveryID int) (*api.WebhookDeliveryResponse, error)
+}
+
+func NewWebhookService(dbConn *gorm.DB, logger *zap.Logger, settings WebhookServiceSettings) *WebhookService {
+	if settings.Timeout <= 0 {
+		settings.Timeout = 5 * time.Second
+	}
+	if settings.Interval <= 0 {
+		settings.Interval = time.Second
+	}
+	if settings.BatchSize <= 0 {
+		settings.BatchSize = 100
+	}
+	if settings.MaxAttempts <= 0 {
+		settings.MaxAttempts = 8
+	}
+	if settings.BackoffBase <= 0 {
+		settings.BackoffBase = 30 * time.Second
+	}
+	if settings.BackoffMax < settings.BackoffBase {
+		settings.BackoffMax = max(6*time.Hour, settings.BackoffBase)
+	}
+
+	return &WebhookService{
+		DBConn:   dbConn,
+		logger:   logger,
+		settings: settings,
+		Client:   webhookClient(settings),
+	}
+}
+
+// webhookClient doesn't follow redirects nor use proxies, and checks the address it dials once the host is resolved so
+// a webhook can't be pointed at the api's network, unless insecure webhooks are allowed
+func webhookClient(settings WebhookServiceSettings) *http.Client {
+	dialer := &net.Dialer{Timeout: settings.Timeout}
+	if !settings.AllowInsecure {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return pkg.ErrInvalidWebhookURL
+			}
+
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   settings.Timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// publicIP checks the address is routable on the internet rather than a loopback, private or link-local one
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified()
+}
+
+// checkURL refuses webhooks that aren't https or whose host is a private address, hosts resolving to one are refused
+// when they're dialed
+func (service *WebhookService) checkURL(rawURL string) error {
+	if service.settings.AllowInsecure {
+		return nil
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Scheme != "https" || parsed.Hostname() == "" {
+		return pkg.ErrInvalidWebhookURL
+	}
+
+	if ip := net.ParseIP(parsed.Hostname()); ip != nil && !publicIP(ip) {
+		return pkg.ErrInvalidWebhookURL
+	}
+
+	return nil
+}
+
+// CreateWebhook registers the endpoint with a new secret, the only time the secret is returned
+func (service *WebhookService) CreateWebhook(ctx context.Context, userID int, req *api.WebhookRequest) (*api.WebhookResponse, error) {
+
+	if err := service.checkURL(req.URL); err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		logging.From(ctx, service.logger).Error("something went wrong generating the webhook secret", zap.Error(err))
+		return nil, err
+	}
+
+	webhook := &pkg.Webhook{
+		UserID: userID,
+		URL:    req.URL,
+		Secret: hex.EncodeToString(secret),
+		Events: strings.Join(req.Events, ","),
+		Active: true,
+	}
+
+	if res := service.DBConn.WithContext(ctx).Create(webhook); res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong saving the webhook", zap.Error(res.Error), zap.Int("user_id", userID))
+		return nil, res.Error
+	}
+
+	res := webhookResponse(webhook)
+	res.Secret = webhook.Secret
+
+	return res, nil
+}
+
+// GetWebhooks returns the endpoints the user registered
+func (service *WebhookService) GetWebhooks(ctx context.Context, userID int) ([]api.WebhookResponse, error) {
+
+	var webhooks []pkg.Webhook
+	if res := service.DBConn.WithContext(ctx).Where("user_id = ?", userID).Order("id").Find(&webhooks); res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong getting the webhooks", zap.Error(res.Error), zap.Int("user_id", userID))
+		return nil, res.Error
+	}
+
+	list := make([]api.WebhookResponse, 0, len(webhooks))
+	for i := range webhooks {
+		list = append(list, *webhookResponse(&webhooks[i]))
+	}
+
+	return list, nil
+}
+
+// DeleteWebhook removes the endpoint along with its delivery log
+func (service *WebhookService) DeleteWebhook(ctx context.Context, userID, webhookID int) error {
+
+	if _, err := service.userWebhook(ctx, userID, webhookID); err != nil {
+		return err
+	}
+
+	err := service.DBConn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if res := tx.Where("webhook_id = ?", webhookID).Delete(&pkg.WebhookDelivery{}); res.Error != nil {
+			return res.Error
+		}
+
+		return tx.Delete(&pkg.Webhook{}, webhookID).Error
+	})
+	if err != nil {
+		logging.From(ctx, service.logger).Error("something went wrong deleting the webhook", zap.Error(err), zap.Int("webhook_id", webhookID))
+		return err
+	}
+
+	return nil
+}
+
+// GetDeliveries returns the latest deliveries of the webhook, newest first
+func (service *WebhookService) GetDeliveries(ctx context.Context, userID, webhookID int) ([]api.WebhookDeliveryResponse, error) {
+
+	if _, err := service.userWebhook(ctx, userID, webhookID); err != nil {
+		return nil, err
+	}
+
+	var deliveries []pkg.WebhookDelivery
+	res := service.DBConn.WithContext(ctx).
+		Where("webhook_id = ?", webhookID).
+		Order("id desc").
+		Limit(service.settings.BatchSize).
+		Find(&deliveries)
+	if res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong getting the webhook deliveries", zap.Error(res.Error), zap.Int("webhook_id", webhookID))
+		return nil, res.Error
+	}
+
+	list := make([]api.WebhookDeliveryResponse, 0, len(deliveries))
+	for i := range deliveries {
+		list = append(list, *webhookDeliveryResponse(&deliveries[i]))
+	}
+
+	return list, nil
+}
+
+// Redeliver sends the delivery again straight away whatever its status, it counts as one more attempt
+func (service *WebhookService) Redeliver(ctx context.Context, userID, webhookID, deliveryID int) (*api.WebhookDeliveryResponse, error) {
+
+	webhook, err := service.userWebhook(ctx, userID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	var delivery pkg.WebhookDelivery
+	if res := service.DBConn.WithContext(ctx).Where("id = ? AND webhook_id = ?", deliveryID, webhookID).First(&delivery); res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong getting the webhook delivery", zap.Error(res.Error), zap.Int("delivery_id", deliveryID))
+		return nil, res.Error
+	}
+
+	if err = service.attempt(ctx, webhook, &delivery); err != nil {
+		return nil, err
+	}
+
+	return webhookDeliveryResponse(&delivery), nil
+}
+
+// Publish queues a delivery of the event for each of the user's webhooks wanting it, so the outbox relay can feed the
+// webhooks, deliveries already queued for the event are left alone when the relay sends it again
+func (service *WebhookService) Publish(ctx context.Context, event *pkg.OutboxEvent) error {
+
+	var webhooks []pkg.Webhook
+	res := service.DBConn.WithContext(ctx).Where("user_id = ? AND active = ?", event.UserID, true).Find(&webhooks)
+	if res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong getting the webhooks", zap.Error(res.Error), zap.Int("event_id", event.ID))
+		return res.Error
+	}
+
+	now := service.DBConn.NowFunc()
+
+	deliveries := make([]pkg.WebhookDelivery, 0, len(webhooks))
+	for i := range webhooks {
+		if webhooks[i].Wants(event.Type) {
+			deliveries = append(deliveries, pkg.WebhookDelivery{
+				WebhookID:     webhooks[i].ID,
+				EventID:       event.ID,
+				EventType:     event.Type,
+				Payload:       event.Payload,
+				Status:        pkg.DeliveryPending,
+				NextAttemptAt: sql.NullTime{Time: now, Valid: true},
+			})
+		}
+	}
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	res = service.DBConn.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&deliveries)
+	if res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong queuing the webhook deliveries", zap.Error(res.Error), zap.Int("event_id", event.ID))
+		return res.Error
+	}
+
+	return nil
+}
+
+// Run sends the due deliveries until the context is cancelled, meant to be started in its own goroutine. The delivery
+// in flight is finished before returning so it isn't counted as failed for being cut, the rest of the batch is left for
+// the next start.
+func (service *WebhookService) Run(ctx context.Context) {
+	ticker := time.NewTicker(service.settings.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, _ = service.DeliverDue(ctx)
+		}
+	}
+}
+
+// DeliverDue claims the pending deliveries whose next attempt is due and sends them, stopping between deliveries once
+// the context is done
+func (service *WebhookService) DeliverDue(ctx context.Context) (int, error) {
+
+	deliveries, err := service.claimDue(ctx)
+	if err != nil || len(deliveries) == 0 {
+		return 0, err
+	}
+
+	ids := make([]int, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		ids = append(ids, delivery.WebhookID)
+	}
+
+	var webhooks []pkg.Webhook
+	if res := service.DBConn.WithContext(ctx).Where("id IN ?", ids).Find(&webhooks); res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong getting the webhooks", zap.Error(res.Error))
+		return 0, res.Error
+	}
+
+	byID := make(map[int]*pkg.Webhook, len(webhooks))
+	for i := range webhooks {
+		byID[webhooks[i].ID] = &webhooks[i]
+	}
+
+	for i := range deliveries {
+		if ctx.Err() != nil {
+			service.release(deliveries[i:])
+			return i, ctx.Err()
+		}
+
+		// a delivery started is finished, the client's timeout bounds it
+		if err = service.attempt(context.WithoutCancel(ctx), byID[deliveries[i].WebhookID], &deliveries[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(deliveries), nil
+}
+
+// claimDue locks the due deliveries, skipping the ones another instance locked, and moves their next attempt past the
+// time the batch can take so they aren't claimed again while they're sent. The deliveries of an instance that stopped
+// without saving them are due again once that time is over.
+func (service *WebhookService) claimDue(ctx context.Context) ([]pkg.WebhookDelivery, error) {
+
+	now := service.DBConn.NowFunc()
+
+	var deliveries []pkg.WebhookDelivery
+	err := service.DBConn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", pkg.DeliveryPending, now).
+			Order("id").
+			Limit(service.settings.BatchSize).
+			Find(&deliveries)
+		if res.Error != nil || len(deliveries) == 0 {
+			return res.Error
+		}
+
+		ids := make([]int, 0, len(deliveries))
+		for _, delivery := range deliveries {
+			ids = append(ids, delivery.ID)
+		}
+
+		lease := now.Add(service.settings.Timeout * time.Duration(len(deliveries)+1))
+
+		return tx.Model(&pkg.WebhookDelivery{}).Where("id IN ?", ids).Update("next_attempt_at", lease).Error
+	})
+	if err != nil {
+		logging.From(ctx, service.logger).Error("something went wrong claiming the due webhook deliveries", zap.Error(err))
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// release makes the claimed deliveries that weren't sent due again, so the next start doesn't wait for the claim to end
+func (service *WebhookService) release(deliveries []pkg.WebhookDelivery) {
+
+	ids := make([]int, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		ids = append(ids, delivery.ID)
+	}
+
+	res := service.DBConn.Model(&pkg.WebhookDelivery{}).
+		Where("id IN ? AND status = ?", ids, pkg.DeliveryPending).
+		Update("next_attempt_at", service.DBConn.NowFunc())
+	if res.Error != nil {
+		service.logger.Warn("something went wrong releasing the webhook deliveries", zap.Error(res.Error), zap.Ints("delivery_ids", ids))
+	}
+}
+
+// attempt posts the delivery to the webhook and saves the outcome, scheduling a retry if it failed and any are left
+func (service *WebhookService) attempt(ctx context.Context, webhook *pkg.Webhook, delivery *pkg.WebhookDelivery) error {
+
+	now := service.DBConn.NowFunc()
+	delivery.Attempts++
+
+	statusCode, err := service.post(ctx, webhook, delivery, now)
+	delivery.LastStatusCode = statusCode
+
+	switch {
+	case err == nil:
+		delivery.Status = pkg.DeliveryDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = sql.NullTime{Time: now, Valid: true}
+		delivery.NextAttemptAt = sql.NullTime{}
+	case webhook == nil || !webhook.Active || delivery.Attempts >= service.settings.MaxAttempts:
+		delivery.Status = pkg.DeliveryFailed
+		delivery.LastError = deliveryError(err)
+		delivery.NextAttemptAt = sql.NullTime{}
+	default:
+		backoff := service.settings.backoff(delivery.Attempts)
+		delivery.Status = pkg.DeliveryPending
+		delivery.LastError = deliveryError(err)
+		delivery.NextAttemptAt = sql.NullTime{Time: now.Add(backoff), Valid: true}
+	}
+
+	if res := service.DBConn.WithContext(ctx).Save(delivery); res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong saving the webhook delivery", zap.Error(res.Error), zap.Int("delivery_id", delivery.ID))
+		return res.Error
+	}
+
+	if err != nil {
+		logging.From(ctx, service.logger).Warn("webhook delivery failed", zap.Error(err), zap.Int("delivery_id", delivery.ID), zap.Int("attempts", delivery.Attempts))
+	}
+
+	return nil
+}
+
+// backoff is the time before the next attempt, doubling from the base after each one up to the maximum
+func (settings WebhookServiceSettings) backoff(attempts int) time.Duration {
+	backoff := settings.BackoffBase
+	for i := 1; i < attempts && backoff < settings.BackoffMax; i++ {
+		backoff *= 2
+	}
+
+	return min(backoff, settings.BackoffMax)
+}
+
+// post sends the signed payload, anything other than a 2xx is an error
+func (service *WebhookService) post(ctx context.Context, webhook *pkg.Webhook, delivery *pkg.WebhookDelivery, now time.Time) (int, error) {
+
+	if webhook == nil || !webhook.Active {
+		return 0, &deliveryErr{fmt.Errorf("webhook %d no longer active", delivery.WebhookID)}
+	}
+
+	// webhooks saved before the urls were checked are refused too
+	if err := service.checkURL(webhook.URL); err != nil {
+		return 0, &deliveryErr{err}
+	}
+
+	body := []byte(delivery.Payload)
+	timestamp := now.Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Wallet-Event", delivery.EventType)
+	req.Header.Set("X-Wallet-Delivery", strconv.Itoa(delivery.ID))
+	req.Header.Set("X-Wallet-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Wallet-Signature", pkg.WebhookSignature(webhook.Secret, timestamp, body))
+
+	res, err := service.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, &deliveryErr{fmt.Errorf("webhook responded with %d", res.StatusCode)}
+	}
+
+	return res.StatusCode, nil
+}
+
+// deliveryErr is an error of a delivery whose message can be shown to the webhook's owner
+type deliveryErr struct {
+	err error
+}
+
+func (e *deliveryErr) Error() string {
+	return e.err.Error()
+}
+
+func (e *deliveryErr) Unwrap() error {
+	return e.err
+}
+
+// deliveryError returns the error saved with the delivery, the ones the owner can't be shown are replaced by a generic
+// one
+func deliveryError(err error) string {
+	var shown *deliveryErr
+	if errors.As(err, &shown) {
+		return shown.Error()
+	}
+
+	return webhookRequestFailed
+}
+
+func (service *WebhookService) userWebhook(ctx context.Context, userID, webhookID int) (*pkg.Webhook, error) {
+
+	var webhook pkg.Webhook
+	if res := service.DBConn.WithContext(ctx).Where("id = ? AND user_id = ?", webhookID, userID).First(&webhook); res.Error != nil {
+		logging.From(ctx, service.logger).Error("something went wrong getting the webhook", zap.Error(res.Error), zap.Int("webhook_id", webhookID))
+		return nil, res.Error
+	}
+
+	return &webhook, nil
+}
+
+func webhookResponse(webhook *pkg.Webhook) *api.WebhookResponse {
+	events := []string{}
+	if webhook.Events != "" {
+		events = strings.Split(webhook.Events, ",")
+	}
+
+	return &api.WebhookResponse{
+		ID:        webhook.ID,
+		URL:       webhook.URL,
+		Events:    events,
+		Active:    webhook.Active,
+		CreatedAt: webhook.CreatedAt,
+	}
+}
+
+func webhookDeliveryResponse(delivery *pkg.WebhookDelivery) *api.WebhookDeliveryResponse {
+	res := &api.WebhookDeliveryResponse{
+		ID:             delivery.ID,
+		WebhookID:      delivery.WebhookID,
+		EventID:        delivery.EventID,
+		EventType:      delivery.EventType,
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		LastStatusCode: delivery.LastStatusCode,
+		LastError:      delivery.LastError,
+		CreatedAt:      delivery.CreatedAt,
+	}
+
+	if delivery.NextAttemptAt.Valid {
+		res.NextAttemptAt = &delivery.NextAttemptAt.Time
+	}
+	if delivery.DeliveredAt.Valid {
+		res.DeliveredAt = &delivery.DeliveredAt.Time
+	}
+
+	return res
+}
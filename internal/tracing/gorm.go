@@ -0,0 +1,83 @@
+package tracing
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// gormSpanKey keeps the span of a statement between its before and after callbacks
+const gormSpanKey = "tracing:span"
+
+// gormPlugin opens a span for each statement run with a ctx holding a span, the ones run outside a request (migrations,
+// the relay polls) aren't traced so they don't start a trace of their own every second
+type gormPlugin struct{}
+
+// InstrumentGORM traces the statements of the db, the ctx is passed to them with WithContext
+func InstrumentGORM(db *gorm.DB) error {
+	return db.Use(&gormPlugin{})
+}
+
+func (p *gormPlugin) Name() string {
+	return "tracing"
+}
+
+func (p *gormPlugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+
+	return errors.Join(
+		callbacks.Create().Before("*").Register("tracing:before_create", p.before("create")),
+		callbacks.Create().After("*").Register("tracing:after_create", p.after),
+		callbacks.Query().Before("*").Register("tracing:before_query", p.before("query")),
+		callbacks.Query().After("*").Register("tracing:after_query", p.after),
+		callbacks.Update().Before("*").Register("tracing:before_update", p.before("update")),
+		callbacks.Update().After("*").Register("tracing:after_update", p.after),
+		callbacks.Delete().Before("*").Register("tracing:before_delete", p.before("delete")),
+		callbacks.Delete().After("*").Register("tracing:after_delete", p.after),
+		callbacks.Row().Before("*").Register("tracing:before_row", p.before("row")),
+		callbacks.Row().After("*").Register("tracing:after_row", p.after),
+		callbacks.Raw().Before("*").Register("tracing:before_raw", p.before("raw")),
+		callbacks.Raw().After("*").Register("tracing:after_raw", p.after),
+	)
+}
+
+func (p *gormPlugin) before(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if !trace.SpanContextFromContext(ctx).IsValid() {
+			return
+		}
+
+		_, span := Tracer().Start(ctx, "gorm."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemMySQL, semconv.DBOperation(operation)),
+		)
+		db.InstanceSet(gormSpanKey, span)
+	}
+}
+
+func (p *gormPlugin) after(db *gorm.DB) {
+	value, ok := db.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+
+	// the statement keeps its placeholders, the values never reach the span
+	span.SetAttributes(
+		semconv.DBStatement(db.Statement.SQL.String()),
+		semconv.DBSQLTable(db.Statement.Table),
+		attribute.Int64("db.rows_affected", db.RowsAffected),
+	)
+
+	err := db.Error
+	// not finding a row is an answer, not a failure of the db
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = nil
+	}
+
+	End(span, err)
+}
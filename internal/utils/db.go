@@ -3,6 +3,9 @@ package utils
 import (
 	"database/sql"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -18,14 +21,14 @@ import (
 )
 
 // GetDBConnectionString uses configs to generate a connection string to the db
-func GetDBConnectionString(user, pass, host, dbName string) string {
-	return fmt.Sprintf(config.WalletConfigs.DBConnectionFormat, user, pass, host, dbName)
+func GetDBConnectionString(cfg config.Configurations) string {
+	return fmt.Sprintf(cfg.DBConnectionFormat, cfg.DBUser, cfg.DBPassword, cfg.Host, cfg.DBName)
 }
 
-// GetDBConnection uses string passed to connect to mysql database
-func GetDBConnection(user, pass, host, dbName string, logger *zap.Logger) (*gorm.DB, error) {
+// GetDBConnection uses the configs to connect to mysql database
+func GetDBConnection(cfg config.Configurations, logger *zap.Logger) (*gorm.DB, error) {
 
-	dsn := GetDBConnectionString(user, pass, host, dbName)
+	dsn := GetDBConnectionString(cfg)
 
 	db, err := gorm.Open(gormMysql.Open(dsn), &gorm.Config{
 		NowFunc: func() time.Time {
@@ -41,9 +44,9 @@ func GetDBConnection(user, pass, host, dbName string, logger *zap.Logger) (*gorm
 }
 
 // SetUpDBConnection gets the connection and applies all the configs to it
-func SetUpDBConnection(user, pass, host, dbName string, logger *zap.Logger) (*gorm.DB, error) {
+func SetUpDBConnection(cfg config.Configurations, logger *zap.Logger) (*gorm.DB, error) {
 
-	db, err := GetDBConnection(user, pass, host, dbName, logger)
+	db, err := GetDBConnection(cfg, logger)
 	if err != nil {
 		return nil, err
 	}
@@ -55,19 +58,13 @@ func SetUpDBConnection(user, pass, host, dbName string, logger *zap.Logger) (*go
 	}
 
 	// SetMaxIdleConns sets the maximum number of connections in the idle connection pool.
-	sqlDB.SetMaxIdleConns(config.WalletConfigs.MaxIdleConnections)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConnections)
 
 	// SetMaxOpenConns sets the maximum number of open connections to the database.
-	sqlDB.SetMaxOpenConns(config.WalletConfigs.MaxConnections)
-
-	lifeTime, err := time.ParseDuration(fmt.Sprintf("%vh", config.WalletConfigs.MaxLifetime))
-	if err != nil {
-		logger.Error("❌ something went wrong formatting the lifetime duration from the configurations", zap.String("method", "SetUpDBConnection"), zap.Error(err))
-		return nil, err
-	}
+	sqlDB.SetMaxOpenConns(cfg.MaxConnections)
 
 	// SetConnMaxLifetime sets the maximum amount of time a connection may be reused.
-	sqlDB.SetConnMaxLifetime(lifeTime)
+	sqlDB.SetConnMaxLifetime(cfg.MaxLifetime)
 
 	return db, nil
 }
@@ -78,6 +75,17 @@ func SetUpSchema(db *gorm.DB, logger *zap.Logger) (err error) {
 	err = db.Set("gorm:table_options", "ENGINE=InnoDB").AutoMigrate(
 		&pkg.User{},
 		&pkg.Wallet{},
+		&pkg.Transaction{},
+		&pkg.GuardianLink{},
+		&pkg.WalletControl{},
+		&pkg.Limit{},
+		&pkg.GamingControl{},
+		&pkg.KYCDocument{},
+		&pkg.KYCVerification{},
+		&pkg.WalletStatusChange{},
+		&pkg.OutboxEvent{},
+		&pkg.Webhook{},
+		&pkg.WebhookDelivery{},
 	)
 	if err != nil {
 		logger.Error("something went wrong migrating schema", zap.Error(err))
@@ -86,11 +94,33 @@ func SetUpSchema(db *gorm.DB, logger *zap.Logger) (err error) {
 	return
 }
 
+// SetUpAdmins gives the admin role to the users named in the comma separated list, the others keep theirs
+func SetUpAdmins(db *gorm.DB, usernames string, logger *zap.Logger) error {
+	var admins []string
+	for _, username := range strings.Split(usernames, ",") {
+		if username = strings.TrimSpace(username); username != "" {
+			admins = append(admins, username)
+		}
+	}
+
+	if len(admins) == 0 {
+		return nil
+	}
+
+	res := db.Model(&pkg.User{}).Where("username IN ?", admins).Update("role", pkg.RoleAdmin)
+	if res.Error != nil {
+		logger.Error("something went wrong setting up the admins", zap.Error(res.Error), zap.Strings("admins", admins))
+		return res.Error
+	}
+
+	return nil
+}
+
 // RunUpMigrations uses db connection and locations of migration to run all the up migrations
-func RunUpMigrations(db *sql.DB, logger *zap.Logger) (err error) {
+func RunUpMigrations(db *sql.DB, migrationsDir string, logger *zap.Logger) (err error) {
 
 	driver, _ := migrateMysql.WithInstance(db, &migrateMysql.Config{})
-	fileLocation := fmt.Sprintf("file://%s", config.WalletConfigs.MigrationsDir)
+	fileLocation := fmt.Sprintf("file://%s", migrationsDir)
 	m, err := migrate.NewWithDatabaseInstance(fileLocation, "sql", driver)
 	if err != nil {
 		logger.Error("❌ failed to get migration instance", zap.String("fileLocation", fileLocation), zap.Error(err))
@@ -107,3 +137,28 @@ func RunUpMigrations(db *sql.DB, logger *zap.Logger) (err error) {
 
 	return nil
 }
+
+// LatestMigrationVersion returns the version of the last up migration in the directory, the number their files start with
+func LatestMigrationVersion(dir string) (uint, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var latest uint
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".up.sql") {
+			continue
+		}
+
+		number, _, _ := strings.Cut(entry.Name(), "_")
+		version, err := strconv.ParseUint(number, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("migration %s doesn't start with its version: %w", entry.Name(), err)
+		}
+
+		latest = max(latest, uint(version))
+	}
+
+	return latest, nil
+}
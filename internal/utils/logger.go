@@ -6,10 +6,13 @@ import (
 	"go.uber.org/zap"
 )
 
-// SetUpLogger uses configs to generate a logger based on
-func SetUpLogger() (*zap.Logger, error) {
+// SetUpLogger uses configs to generate a logger based on, logging from the level given which can be changed while it runs
+func SetUpLogger(level zap.AtomicLevel) (*zap.Logger, error) {
 
-	logger, err := zap.NewProduction()
+	cfg := zap.NewProductionConfig()
+	cfg.Level = level
+
+	logger, err := cfg.Build()
 	if err != nil {
 		log.Fatalf("can't initialize zap logger: %v", err)
 	}
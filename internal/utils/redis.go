@@ -7,3 +7,8 @@ import (
 func GenerateRedisKey(id int) string {
 	return fmt.Sprintf("%d-balance", id)
 }
+
+// GenerateEventsChannel is the pub/sub channel the wallet's events are sent to for streaming
+func GenerateEventsChannel(id int) string {
+	return fmt.Sprintf("%d-events", id)
+}